@@ -2,50 +2,200 @@ package adapters
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"sync"
 	"time"
 
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/event"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
-var (
-	Client *mongo.Client
-	onceDb sync.Once
-)
+// MongoOptions tunes the MongoDB client pool and how connecting is retried.
+// Zero values keep the driver defaults.
+type MongoOptions struct {
+	URI                    string
+	MaxPoolSize            uint64
+	MinPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	Retry                  RetryPolicy
+	// PoolEvents receives every event of the connection pool, after it is logged
+	PoolEvents func(*event.PoolEvent)
+	// Commands monitors the commands sent to the server when set
+	Commands *event.CommandMonitor
+	// SlowQueries times the query commands when set
+	SlowQueries *SlowQueries
+}
+
+// ConnectToMongoDb creates the client and waits for the primary to answer a
+// ping, retrying with backoff so the service can start before the database
+func ConnectToMongoDb(opts MongoOptions, logger zerolog.Logger) (*mongo.Client, error) {
+	client, err := NewMongoClient(opts, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := PingMongo(context.Background(), client, opts, logger); err != nil {
+		logger.Error().Msg(fmt.Sprintf("MongoDB ping error: => %v", err))
+		DisconnectMongo(client, logger)
+		return nil, err
+	}
+
+	logger.Info().Msg("📻 Connected to MongoDB!")
+
+	return client, nil
+}
+
+// NewMongoClient creates the client without contacting the server, which
+// happens on the first operation. It only fails on invalid options.
+func NewMongoClient(opts MongoOptions, logger zerolog.Logger) (*mongo.Client, error) {
+	clientOpts := options.Client().
+		ApplyURI(opts.URI).
+		SetMinPoolSize(opts.MinPoolSize).
+		SetPoolMonitor(mongoPoolMonitor(logger, opts.PoolEvents))
+	var monitors []*event.CommandMonitor
+	if opts.SlowQueries != nil {
+		monitors = append(monitors, opts.SlowQueries.Monitor())
+	}
+	if opts.Commands != nil {
+		monitors = append(monitors, opts.Commands)
+	}
+	if len(monitors) > 0 {
+		clientOpts.SetMonitor(chainCommandMonitors(monitors...))
+	}
+	if opts.MaxPoolSize > 0 {
+		clientOpts.SetMaxPoolSize(opts.MaxPoolSize)
+	}
+	if opts.MaxConnIdleTime > 0 {
+		clientOpts.SetMaxConnIdleTime(opts.MaxConnIdleTime)
+	}
+	if opts.ConnectTimeout > 0 {
+		clientOpts.SetConnectTimeout(opts.ConnectTimeout)
+	}
+	if opts.ServerSelectionTimeout > 0 {
+		clientOpts.SetServerSelectionTimeout(opts.ServerSelectionTimeout)
+	}
 
-func ConnectToMongoDb(url string) (*mongo.Client, error) {
-	var err error
-	onceDb.Do(func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	client, err := mongo.Connect(clientOpts)
+	if err != nil {
+		logger.Error().Msg(fmt.Sprintf("☠️ MongoDB connection failed: %v", err))
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// PingMongo pings the primary until it answers, as often as the retry policy allows
+func PingMongo(ctx context.Context, client *mongo.Client, opts MongoOptions, logger zerolog.Logger) error {
+	timeout := opts.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return opts.Retry.Do(ctx, logger, "MongoDB ping", func(ctx context.Context) error {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
 
-		Client, err = mongo.Connect(options.Client().ApplyURI(url))
-		if err != nil {
-			Logger.Fatal().Msg(fmt.Sprintf("☠️ MongoDB connection failed: %v", err))
-			return
+		return client.Ping(pingCtx, readpref.Primary())
+	})
+}
+
+// mongoPoolMonitor logs the lifecycle of pooled connections and forwards every
+// event to next when set. Check outs are not logged, there is one for every operation.
+func mongoPoolMonitor(logger zerolog.Logger, next func(*event.PoolEvent)) *event.PoolMonitor {
+	return &event.PoolMonitor{Event: func(e *event.PoolEvent) {
+		switch e.Type {
+		case event.ConnectionPoolReady:
+			logger.Info().Str("address", e.Address).Msg("MongoDB connection pool ready")
+		case event.ConnectionPoolCleared:
+			logger.Warn().Str("address", e.Address).Err(e.Error).Msg("⚠️ MongoDB connection pool cleared")
+		case event.ConnectionCreated:
+			logger.Debug().Str("address", e.Address).Int64("connection_id", e.ConnectionID).Msg("MongoDB connection created")
+		case event.ConnectionClosed:
+			logger.Debug().Str("address", e.Address).Int64("connection_id", e.ConnectionID).Str("reason", e.Reason).Msg("MongoDB connection closed")
+		case event.ConnectionCheckOutFailed:
+			logger.Warn().Str("address", e.Address).Str("reason", e.Reason).Msg("⚠️ Could not check out a MongoDB connection")
 		}
 
-		if err = Client.Ping(ctx, readpref.Primary()); err != nil {
-			Logger.Fatal().Msg(fmt.Sprintf("MongoDB ping error: => %v", err))
-			return
+		if next != nil {
+			next(e)
 		}
+	}}
+}
 
-		Logger.Info().Msg("📻 Connected to MongoDB!")
-	})
+// chainCommandMonitors passes every command event to each monitor in turn
+func chainCommandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	if len(monitors) == 1 {
+		return monitors[0]
+	}
 
-	return Client, err
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Started != nil {
+					monitor.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				if monitor.Succeeded != nil {
+					monitor.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				if monitor.Failed != nil {
+					monitor.Failed(ctx, e)
+				}
+			}
+		},
+	}
 }
 
-func DisconnectMongo(client *mongo.Client) {
+func DisconnectMongo(client *mongo.Client, logger zerolog.Logger) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Disconnect(ctx); err != nil {
-		Logger.Warn().Msg(fmt.Sprintf("⚠️ Error disconnecting MongoDB: %v", err))
+		logger.Warn().Msg(fmt.Sprintf("⚠️ Error disconnecting MongoDB: %v", err))
+	} else {
+		logger.Info().Msg("👋 Disconnected from MongoDB.")
+	}
+}
+
+// ConnectToSQL opens the database of a SQL storage backend and checks that it is reachable
+func ConnectToSQL(dialect *db.SQLDialect, dsn string, logger zerolog.Logger) (*sql.DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := dialect.Open(dsn)
+	if err != nil {
+		logger.Error().Msg(fmt.Sprintf("☠️ %s connection failed: %v", dialect.Name, err))
+		return nil, err
+	}
+
+	if err := conn.PingContext(ctx); err != nil {
+		logger.Error().Msg(fmt.Sprintf("%s ping error: => %v", dialect.Name, err))
+		_ = conn.Close()
+		return nil, err
+	}
+
+	logger.Info().Msg(fmt.Sprintf("📻 Connected to %s!", dialect.Name))
+
+	return conn, nil
+}
+
+func DisconnectSQL(conn *sql.DB, logger zerolog.Logger) {
+	if err := conn.Close(); err != nil {
+		logger.Warn().Msg(fmt.Sprintf("⚠️ Error closing the SQL database: %v", err))
 	} else {
-		Logger.Info().Msg("👋 Disconnected from MongoDB.")
+		logger.Info().Msg("👋 Closed the SQL database.")
 	}
 }
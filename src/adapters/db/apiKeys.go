@@ -0,0 +1,489 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// APIKeyScope grants access to a group of endpoints
+type APIKeyScope string
+
+const (
+	ScopeRead  APIKeyScope = "read"
+	ScopeWrite APIKeyScope = "write"
+	ScopeAdmin APIKeyScope = "admin"
+)
+
+// ? DB Model for an API key. Only the SHA-256 hash of the secret is stored,
+// the prefix is kept in clear so people can tell their keys apart.
+type APIKey struct {
+	ID         bson.ObjectID `bson:"_id" json:"id"`
+	Name       string        `bson:"name" json:"name"`
+	Prefix     string        `bson:"prefix" json:"prefix"`
+	Hash       string        `bson:"hash" json:"-"`
+	Scopes     []APIKeyScope `bson:"scopes" json:"scopes"`
+	CreatedAt  time.Time     `bson:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time    `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time    `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time    `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants scope. Admin grants every scope and write grants read.
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, granted := range k.Scopes {
+		switch {
+		case granted == scope, granted == ScopeAdmin:
+			return true
+		case granted == ScopeWrite && scope == ScopeRead:
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expired reports whether the key is past its expiry at now
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// ? Struct for a new API key
+type CreateAPIKey struct {
+	Name      string        `json:"name" validate:"required,min=3,max=100"`
+	Scopes    []APIKeyScope `json:"scopes" validate:"required,min=1,dive,oneof=read write admin"`
+	ExpiresAt *time.Time    `json:"expires_at"`
+}
+
+// APIKeyIndexes declares the unique index used to look keys up by the hash of their secret
+func APIKeyIndexes(collection string) CollectionIndexes {
+	return CollectionIndexes{
+		Collection: collection,
+		Indexes: []IndexSpec{
+			{Name: "api_keys_by_hash", Keys: bson.D{{Key: "hash", Value: 1}}, Unique: true},
+		},
+	}
+}
+
+type APIKeyRepository struct {
+	Client     *mongo.Client
+	Database   *mongo.Database
+	Collection CollectionInterface
+}
+
+func NewAPIKeyRepository(client *mongo.Client, dbName, collectionName string) *APIKeyRepository {
+	database := client.Database(dbName)
+
+	return &APIKeyRepository{
+		Client:     client,
+		Database:   database,
+		Collection: database.Collection(collectionName),
+	}
+}
+
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	_, err := r.Collection.InsertOne(ctx, key)
+	return classifyAPIKeyError("CreateAPIKey", err)
+}
+
+// ListAPIKeys returns every key, revoked ones included, oldest first
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.Collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, classifyAPIKeyError("ListAPIKeys", err)
+	}
+
+	keys := []APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, classifyAPIKeyError("ListAPIKeys", err)
+	}
+
+	return keys, nil
+}
+
+func (r *APIKeyRepository) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidAPIKeyIDError("GetAPIKey", id, err)
+	}
+
+	var key APIKey
+	err = r.Collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&key)
+	if err != nil {
+		return nil, classifyAPIKeyError("GetAPIKey", err)
+	}
+
+	return &key, nil
+}
+
+func (r *APIKeyRepository) FindAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	var key APIKey
+	err := r.Collection.FindOne(ctx, bson.M{"hash": hash}).Decode(&key)
+	if err != nil {
+		return nil, classifyAPIKeyError("FindAPIKeyByHash", err)
+	}
+
+	return &key, nil
+}
+
+// ReplaceAPIKeySecret swaps the secret of a key that is not revoked, the old one stops working at once
+func (r *APIKeyRepository) ReplaceAPIKeySecret(ctx context.Context, id, prefix, hash string) (*APIKey, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidAPIKeyIDError("ReplaceAPIKeySecret", id, err)
+	}
+
+	var key APIKey
+	err = r.Collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": objID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"prefix": prefix, "hash": hash}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&key)
+	if err != nil {
+		return nil, classifyAPIKeyError("ReplaceAPIKeySecret", err)
+	}
+
+	return &key, nil
+}
+
+// RevokeAPIKey disables a key for good. Revoking it again keeps the first revocation time.
+func (r *APIKeyRepository) RevokeAPIKey(ctx context.Context, id string, at time.Time) (*APIKey, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidAPIKeyIDError("RevokeAPIKey", id, err)
+	}
+
+	_, err = r.Collection.UpdateOne(ctx,
+		bson.M{"_id": objID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": at}})
+	if err != nil {
+		return nil, classifyAPIKeyError("RevokeAPIKey", err)
+	}
+
+	return r.GetAPIKey(ctx, id)
+}
+
+// TouchAPIKey records the last time a key was used
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id bson.ObjectID, at time.Time) error {
+	_, err := r.Collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": at}})
+	return classifyAPIKeyError("TouchAPIKey", err)
+}
+
+// MemoryAPIKeyStore keeps API keys in process memory, for the memory storage backend
+type MemoryAPIKeyStore struct {
+	mu   sync.Mutex
+	keys map[bson.ObjectID]*APIKey
+}
+
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: make(map[bson.ObjectID]*APIKey)}
+}
+
+func (s *MemoryAPIKeyStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.keys {
+		if existing.Hash == key.Hash {
+			return &RepositoryError{Kind: KindConflict, Op: "CreateAPIKey", Detail: "API key already exists"}
+		}
+	}
+
+	s.keys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+// ListAPIKeys returns every key, revoked ones included, oldest first
+func (s *MemoryAPIKeyStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, *copyAPIKey(key))
+	}
+	slices.SortFunc(keys, func(a, b APIKey) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.find("GetAPIKey", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyAPIKey(key), nil
+}
+
+func (s *MemoryAPIKeyStore) FindAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return copyAPIKey(key), nil
+		}
+	}
+
+	return nil, apiKeyNotFoundError("FindAPIKeyByHash")
+}
+
+// ReplaceAPIKeySecret swaps the secret of a key that is not revoked, the old one stops working at once
+func (s *MemoryAPIKeyStore) ReplaceAPIKeySecret(ctx context.Context, id, prefix, hash string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.find("ReplaceAPIKeySecret", id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, apiKeyNotFoundError("ReplaceAPIKeySecret")
+	}
+
+	key.Prefix, key.Hash = prefix, hash
+	return copyAPIKey(key), nil
+}
+
+// RevokeAPIKey disables a key for good. Revoking it again keeps the first revocation time.
+func (s *MemoryAPIKeyStore) RevokeAPIKey(ctx context.Context, id string, at time.Time) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.find("RevokeAPIKey", id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+	}
+
+	return copyAPIKey(key), nil
+}
+
+// TouchAPIKey records the last time a key was used
+func (s *MemoryAPIKeyStore) TouchAPIKey(ctx context.Context, id bson.ObjectID, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.keys[id]; ok {
+		key.LastUsedAt = &at
+	}
+
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) find(op, id string) (*APIKey, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidAPIKeyIDError(op, id, err)
+	}
+
+	key, ok := s.keys[objID]
+	if !ok {
+		return nil, apiKeyNotFoundError(op)
+	}
+
+	return key, nil
+}
+
+func copyAPIKey(key *APIKey) *APIKey {
+	copied := *key
+	copied.Scopes = slices.Clone(key.Scopes)
+	return &copied
+}
+
+// SQLAPIKeyStore keeps API keys in the database of a SQL store, scopes are stored as a JSON array
+type SQLAPIKeyStore struct {
+	DB      *sql.DB
+	dialect *SQLDialect
+}
+
+func NewSQLAPIKeyStore(conn *sql.DB, dialect *SQLDialect) *SQLAPIKeyStore {
+	return &SQLAPIKeyStore{DB: conn, dialect: dialect}
+}
+
+const apiKeyColumns = "id, name, prefix, hash, scopes, created_at, expires_at, last_used_at, revoked_at"
+
+func (s *SQLAPIKeyStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn().ExecContext(ctx,
+		"INSERT INTO api_keys ("+apiKeyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		key.ID.Hex(), key.Name, key.Prefix, key.Hash, string(scopes), sqlTime(key.CreatedAt),
+		sqlNullTime(key.ExpiresAt), sqlNullTime(key.LastUsedAt), sqlNullTime(key.RevokedAt))
+	return classifySQLError(s.dialect, "CreateAPIKey", err)
+}
+
+// ListAPIKeys returns every key, revoked ones included, oldest first
+func (s *SQLAPIKeyStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at, id")
+	if err != nil {
+		return nil, classifySQLError(s.dialect, "ListAPIKeys", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanSQLAPIKey(rows)
+		if err != nil {
+			return nil, classifySQLError(s.dialect, "ListAPIKeys", err)
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, classifySQLError(s.dialect, "ListAPIKeys", rows.Err())
+}
+
+func (s *SQLAPIKeyStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	if _, err := bson.ObjectIDFromHex(id); err != nil {
+		return nil, invalidAPIKeyIDError("GetAPIKey", id, err)
+	}
+
+	return s.queryOne(ctx, "GetAPIKey", "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id)
+}
+
+func (s *SQLAPIKeyStore) FindAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error) {
+	return s.queryOne(ctx, "FindAPIKeyByHash", "SELECT "+apiKeyColumns+" FROM api_keys WHERE hash = ?", hash)
+}
+
+// ReplaceAPIKeySecret swaps the secret of a key that is not revoked, the old one stops working at once
+func (s *SQLAPIKeyStore) ReplaceAPIKeySecret(ctx context.Context, id, prefix, hash string) (*APIKey, error) {
+	if _, err := bson.ObjectIDFromHex(id); err != nil {
+		return nil, invalidAPIKeyIDError("ReplaceAPIKeySecret", id, err)
+	}
+
+	result, err := s.conn().ExecContext(ctx,
+		"UPDATE api_keys SET prefix = ?, hash = ? WHERE id = ? AND revoked_at IS NULL", prefix, hash, id)
+	if err != nil {
+		return nil, classifySQLError(s.dialect, "ReplaceAPIKeySecret", err)
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		if err != nil {
+			return nil, classifySQLError(s.dialect, "ReplaceAPIKeySecret", err)
+		}
+		return nil, apiKeyNotFoundError("ReplaceAPIKeySecret")
+	}
+
+	return s.GetAPIKey(ctx, id)
+}
+
+// RevokeAPIKey disables a key for good. Revoking it again keeps the first revocation time.
+func (s *SQLAPIKeyStore) RevokeAPIKey(ctx context.Context, id string, at time.Time) (*APIKey, error) {
+	if _, err := bson.ObjectIDFromHex(id); err != nil {
+		return nil, invalidAPIKeyIDError("RevokeAPIKey", id, err)
+	}
+
+	_, err := s.conn().ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", sqlTime(at), id)
+	if err != nil {
+		return nil, classifySQLError(s.dialect, "RevokeAPIKey", err)
+	}
+
+	return s.GetAPIKey(ctx, id)
+}
+
+// TouchAPIKey records the last time a key was used
+func (s *SQLAPIKeyStore) TouchAPIKey(ctx context.Context, id bson.ObjectID, at time.Time) error {
+	_, err := s.conn().ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", sqlTime(at), id.Hex())
+	return classifySQLError(s.dialect, "TouchAPIKey", err)
+}
+
+func (s *SQLAPIKeyStore) queryOne(ctx context.Context, op, query string, args ...any) (*APIKey, error) {
+	key, err := scanSQLAPIKey(s.conn().QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apiKeyNotFoundError(op)
+	}
+	if err != nil {
+		return nil, classifySQLError(s.dialect, op, err)
+	}
+
+	return key, nil
+}
+
+func (s *SQLAPIKeyStore) conn() sqlConn {
+	return sqlConn{q: s.DB, dialect: s.dialect}
+}
+
+func scanSQLAPIKey(row interface{ Scan(dest ...any) error }) (*APIKey, error) {
+	var (
+		key                              APIKey
+		id, scopes                       string
+		createdAt                        int64
+		expiresAt, lastUsedAt, revokedAt sql.NullInt64
+	)
+
+	err := row.Scan(&id, &key.Name, &key.Prefix, &key.Hash, &scopes, &createdAt, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.ID, err = bson.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+		return nil, err
+	}
+	key.CreatedAt = fromSQLTime(createdAt)
+	key.ExpiresAt = fromSQLNullTime(expiresAt)
+	key.LastUsedAt = fromSQLNullTime(lastUsedAt)
+	key.RevokedAt = fromSQLNullTime(revokedAt)
+
+	return &key, nil
+}
+
+func fromSQLNullTime(ms sql.NullInt64) *time.Time {
+	if !ms.Valid {
+		return nil
+	}
+
+	t := fromSQLTime(ms.Int64)
+	return &t
+}
+
+func invalidAPIKeyIDError(op, id string, err error) error {
+	return &RepositoryError{
+		Kind:   KindInvalidID,
+		Op:     op,
+		Detail: fmt.Sprintf("%q is not a valid API key id", id),
+		Err:    err,
+	}
+}
+
+func apiKeyNotFoundError(op string) error {
+	return &RepositoryError{Kind: KindNotFound, Op: op, Detail: "API key not found"}
+}
+
+// classifyAPIKeyError is classifyError with details speaking of API keys instead of tasks
+func classifyAPIKeyError(op string, err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &RepositoryError{Kind: KindNotFound, Op: op, Detail: "API key not found", Err: err}
+	case mongo.IsDuplicateKeyError(err):
+		return &RepositoryError{Kind: KindConflict, Op: op, Detail: "API key already exists", Err: err}
+	default:
+		return classifyError(op, err)
+	}
+}
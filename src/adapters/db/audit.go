@@ -0,0 +1,28 @@
+package db
+
+import "context"
+
+const systemActor = "system"
+
+type auditKey struct{}
+
+// Audit identifies who triggered a change and the request it came from
+type Audit struct {
+	Actor     string
+	RequestID string
+}
+
+func WithAudit(ctx context.Context, audit Audit) context.Context {
+	return context.WithValue(ctx, auditKey{}, audit)
+}
+
+// AuditFromContext returns the audit information of ctx. Changes made outside
+// of a request, such as background jobs, are attributed to the system actor.
+func AuditFromContext(ctx context.Context) Audit {
+	audit, _ := ctx.Value(auditKey{}).(Audit)
+	if audit.Actor == "" {
+		audit.Actor = systemActor
+	}
+
+	return audit
+}
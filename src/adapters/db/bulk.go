@@ -0,0 +1,433 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const MaxBulkOperations = 500
+
+type BulkOpKind string
+
+const (
+	BulkCreate BulkOpKind = "create"
+	BulkUpdate BulkOpKind = "update"
+	BulkDelete BulkOpKind = "delete"
+)
+
+type BulkStatus string
+
+const (
+	BulkCreated BulkStatus = "created"
+	BulkUpdated BulkStatus = "updated"
+	BulkDeleted BulkStatus = "deleted"
+	BulkFailed  BulkStatus = "failed"
+	BulkSkipped BulkStatus = "skipped"
+)
+
+// BulkOperation is a single create, update or delete of a bulk request.
+// Err is set by the caller when the operation was already rejected, for
+// example because its payload did not pass validation.
+type BulkOperation struct {
+	Kind    BulkOpKind
+	ID      string
+	Version *int64
+	Create  *CreateNewTask
+	Update  *UpdateTask
+	Err     *BulkItemError
+}
+
+type BulkOptions struct {
+	Ordered bool
+	Atomic  bool
+}
+
+type BulkItemError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Fields  any    `json:"fields,omitempty"`
+}
+
+type BulkItemResult struct {
+	Index   int            `json:"index"`
+	Op      BulkOpKind     `json:"op"`
+	Status  BulkStatus     `json:"status"`
+	ID      string         `json:"id,omitempty"`
+	Version int64          `json:"version,omitempty"`
+	Error   *BulkItemError `json:"error,omitempty"`
+}
+
+// ? Pending write of a bulk operation that passed every pre-check. Creates
+// insert after, updates and deletes apply update to the task matching filter.
+type bulkWrite struct {
+	index  int
+	filter bson.M
+	update bson.M
+	before *Tasks
+	after  *Tasks
+}
+
+var (
+	errBulkAborted   = &BulkItemError{Code: "aborted", Message: "not applied because another operation of the atomic batch failed"}
+	errBulkSkipped   = &BulkItemError{Code: "skipped", Message: "not applied because an earlier operation of the ordered batch failed"}
+	errBulkConflict  = &BulkItemError{Code: "conflict", Message: "task was modified concurrently"}
+	errBulkDuplicate = &BulkItemError{Code: "duplicate_target", Message: "task is already targeted by an earlier operation of the batch"}
+)
+
+// errBulkRollback aborts the transaction of an atomic batch
+var errBulkRollback = errors.New("bulk write rolled back")
+
+// BulkWrite runs a batch of operations, writing them one by one so the outcome
+// of every write is known. Ordered batches stop at the first failure, atomic
+// ones run in a transaction and are applied entirely or not at all. The result
+// has one entry per operation, in order.
+func (r *TaskRepository) BulkWrite(ctx context.Context, ops []BulkOperation, opts BulkOptions) ([]BulkItemResult, error) {
+	current, err := r.prefetchBulkTargets(ctx, ops)
+	if err != nil {
+		return nil, err
+	}
+
+	results, writes := planBulkBatch(ops, opts, current, time.Now())
+
+	var writeErrs map[int]*BulkItemError
+	if len(writes) > 0 {
+		if opts.Atomic {
+			writeErrs, err = r.runBulkTransaction(ctx, writes)
+		} else {
+			writeErrs, err = r.runBulkWrite(ctx, writes, opts.Ordered)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// ? A history failure does not stop the others from being recorded, the first one is reported
+	var historyErr error
+	results = settleBulkBatch(ops, opts, results, writes, writeErrs, func(kind BulkOpKind, write bulkWrite) {
+		if err := r.recordBulkHistory(ctx, kind, write); err != nil && historyErr == nil {
+			historyErr = err
+		}
+	})
+	if historyErr != nil {
+		return nil, historyErr
+	}
+
+	return results, nil
+}
+
+// planBulkBatch checks every operation against the current live tasks and returns
+// the initial results along with the writes to run. Ordered and atomic batches stop
+// planning at the first failure, and an atomic batch with a failure runs nothing.
+func planBulkBatch(ops []BulkOperation, opts BulkOptions, current map[bson.ObjectID]*Tasks, now time.Time) ([]BulkItemResult, []bulkWrite) {
+	results := make([]BulkItemResult, len(ops))
+	for i, op := range ops {
+		results[i] = BulkItemResult{Index: i, Op: op.Kind, ID: op.ID, Error: op.Err}
+	}
+
+	writes := make([]bulkWrite, 0, len(ops))
+	targeted := make(map[bson.ObjectID]bool, len(ops))
+	for i, op := range ops {
+		// ? Creates target no existing task, and an invalid id targets none either
+		if op.Kind != BulkCreate {
+			objID, err := bson.ObjectIDFromHex(op.ID)
+			switch {
+			case err != nil:
+				if results[i].Error == nil {
+					results[i].Error = invalidBulkID(op.ID)
+				}
+			case targeted[objID]:
+				if results[i].Error == nil {
+					results[i].Error = errBulkDuplicate
+				}
+			default:
+				targeted[objID] = true
+			}
+		}
+
+		if results[i].Error == nil {
+			var write *bulkWrite
+			write, results[i].Error = planBulkWrite(op, current, now)
+			if write != nil {
+				write.index = i
+				writes = append(writes, *write)
+			}
+		}
+
+		if results[i].Error != nil && (opts.Ordered || opts.Atomic) {
+			break
+		}
+	}
+
+	if opts.Atomic && firstBulkFailure(results) >= 0 {
+		writes = nil
+	}
+
+	return results, writes
+}
+
+// settleBulkBatch gives every operation its final status once the writes ran.
+// applied is called for each write that took effect, in order.
+func settleBulkBatch(ops []BulkOperation, opts BulkOptions, results []BulkItemResult, writes []bulkWrite, writeErrs map[int]*BulkItemError, applied func(BulkOpKind, bulkWrite)) []BulkItemResult {
+	done := make(map[int]bool, len(writes))
+	for _, write := range writes {
+		if itemErr, failed := writeErrs[write.index]; failed {
+			// ? Writes never attempted are settled as skipped below, like the ones never planned
+			if itemErr != errBulkSkipped && itemErr != errBulkAborted {
+				results[write.index].Error = itemErr
+			}
+			continue
+		}
+
+		done[write.index] = true
+		results[write.index].ID = write.after.ID.Hex()
+		results[write.index].Version = write.after.Version
+		applied(ops[write.index].Kind, write)
+	}
+
+	anyFailed := firstBulkFailure(results) >= 0
+	for i := range results {
+		switch {
+		case done[i]:
+			results[i].Status = bulkStatus(ops[i].Kind)
+		case results[i].Error != nil:
+			results[i].Status = BulkFailed
+		case opts.Atomic && anyFailed:
+			results[i].Status, results[i].Error = BulkSkipped, errBulkAborted
+		default:
+			results[i].Status, results[i].Error = BulkSkipped, errBulkSkipped
+		}
+	}
+
+	return results
+}
+
+// prefetchBulkTargets loads the live tasks targeted by updates and deletes, both
+// to check they exist and to know their previous values for the history
+func (r *TaskRepository) prefetchBulkTargets(ctx context.Context, ops []BulkOperation) (map[bson.ObjectID]*Tasks, error) {
+	ids := make([]bson.ObjectID, 0, len(ops))
+	for _, op := range ops {
+		if op.Kind == BulkCreate {
+			continue
+		}
+		if id, err := bson.ObjectIDFromHex(op.ID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	current := make(map[bson.ObjectID]*Tasks, len(ids))
+	if len(ids) == 0 {
+		return current, nil
+	}
+
+	cursor, err := r.Collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "deleted_at": nil})
+	if err != nil {
+		return nil, classifyError("BulkWrite", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var task Tasks
+		if err := cursor.Decode(&task); err != nil {
+			return nil, err
+		}
+		current[task.ID] = &task
+	}
+
+	return current, classifyError("BulkWrite", cursor.Err())
+}
+
+// planBulkWrite checks an operation against the current tasks and builds its
+// write model. Updates and deletes are guarded by the prefetched version, so a
+// task modified in between is reported as a conflict instead of being overwritten.
+func planBulkWrite(op BulkOperation, current map[bson.ObjectID]*Tasks, now time.Time) (*bulkWrite, *BulkItemError) {
+	if op.Kind == BulkCreate {
+		task := &Tasks{
+			ID:        bson.NewObjectID(),
+			Title:     op.Create.Title,
+			Timestamp: *op.Create.Timestamp,
+			Completed: op.Create.Completed,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Version:   1,
+		}
+
+		return &bulkWrite{after: task}, nil
+	}
+
+	objID, err := bson.ObjectIDFromHex(op.ID)
+	if err != nil {
+		return nil, invalidBulkID(op.ID)
+	}
+
+	before, found := current[objID]
+	if !found {
+		return nil, &BulkItemError{Code: string(KindNotFound), Message: "task not found"}
+	}
+	if op.Version != nil && *op.Version != before.Version {
+		return nil, &BulkItemError{Code: string(KindConflict), Message: "task has been modified since it was read"}
+	}
+
+	after := *before
+	after.Version++
+
+	var update bson.M
+	if op.Kind == BulkUpdate {
+		if op.Update.IsEmpty() {
+			return nil, &BulkItemError{Code: string(KindValidation), Message: "payload can not be empty"}
+		}
+		op.Update.applyTo(&after)
+		after.UpdatedAt = now
+		update = bson.M{"$set": op.Update.toSet(now), "$inc": bson.M{"version": 1}}
+	} else {
+		after.DeletedAt = &now
+		update = bson.M{"$set": bson.M{"deleted_at": now}, "$inc": bson.M{"version": 1}}
+	}
+
+	filter := bson.M{"_id": objID, "deleted_at": nil}
+	withVersion(filter, &before.Version)
+
+	return &bulkWrite{filter: filter, update: update, before: before, after: &after}, nil
+}
+
+// runBulkWrite executes the writes in order and returns the error of every write
+// that failed. An update or delete matching nothing was beaten by a concurrent
+// change to its task. An ordered batch stops at the first failure, and the writes
+// it did not attempt are reported as skipped.
+func (r *TaskRepository) runBulkWrite(ctx context.Context, writes []bulkWrite, ordered bool) (map[int]*BulkItemError, error) {
+	failures := make(map[int]*BulkItemError)
+	for i, write := range writes {
+		itemErr, err := r.runSingleBulkWrite(ctx, write)
+		if err != nil {
+			return nil, err
+		}
+		if itemErr == nil {
+			continue
+		}
+
+		failures[write.index] = itemErr
+		if ordered {
+			for _, skipped := range writes[i+1:] {
+				failures[skipped.index] = errBulkSkipped
+			}
+			break
+		}
+	}
+
+	return failures, nil
+}
+
+// runSingleBulkWrite executes one write. Errors the write itself caused are
+// returned as its item error, the others fail the whole batch.
+func (r *TaskRepository) runSingleBulkWrite(ctx context.Context, write bulkWrite) (*BulkItemError, error) {
+	var err error
+	if write.filter == nil {
+		_, err = r.Collection.InsertOne(ctx, write.after)
+	} else {
+		var result *mongo.UpdateResult
+		result, err = r.Collection.UpdateOne(ctx, write.filter, write.update)
+		if err == nil && result.MatchedCount == 0 {
+			return errBulkConflict, nil
+		}
+	}
+
+	var writeErr mongo.WriteException
+	switch {
+	case err == nil:
+		return nil, nil
+	case errors.As(err, &writeErr) && len(writeErr.WriteErrors) > 0:
+		return bulkWriteError(writeErr.WriteErrors[0]), nil
+	default:
+		return nil, classifyError("BulkWrite", err)
+	}
+}
+
+// runBulkTransaction executes the writes in a transaction that is rolled back
+// as soon as one of them fails or targets a task that changed in between
+func (r *TaskRepository) runBulkTransaction(ctx context.Context, writes []bulkWrite) (map[int]*BulkItemError, error) {
+	session, err := r.Client.StartSession()
+	if err != nil {
+		return nil, classifyError("BulkWrite", err)
+	}
+	defer session.EndSession(ctx)
+
+	var failures map[int]*BulkItemError
+	_, err = session.WithTransaction(ctx, func(txCtx context.Context) (any, error) {
+		var runErr error
+		failures, runErr = r.runBulkWrite(txCtx, writes, true)
+		if runErr != nil {
+			return nil, runErr
+		}
+		if len(failures) > 0 {
+			return nil, errBulkRollback
+		}
+
+		return nil, nil
+	})
+
+	if errors.Is(err, errBulkRollback) {
+		for _, write := range writes {
+			if _, failed := failures[write.index]; !failed || failures[write.index] == errBulkSkipped {
+				failures[write.index] = errBulkAborted
+			}
+		}
+		return failures, nil
+	}
+	if err != nil {
+		return nil, classifyError("BulkWrite", err)
+	}
+
+	return failures, nil
+}
+
+func (r *TaskRepository) recordBulkHistory(ctx context.Context, kind BulkOpKind, write bulkWrite) error {
+	return r.recordHistory(ctx, write.after.ID, bulkHistoryAction(kind), write.before, write.after)
+}
+
+func invalidBulkID(id string) *BulkItemError {
+	return &BulkItemError{Code: string(KindInvalidID), Message: fmt.Sprintf("%q is not a valid task id", id)}
+}
+
+func bulkWriteError(err mongo.WriteError) *BulkItemError {
+	if err.HasErrorCode(11000) {
+		return &BulkItemError{Code: string(KindConflict), Message: "task already exists"}
+	}
+
+	return &BulkItemError{Code: "write_error", Message: "the operation could not be written"}
+}
+
+func bulkStatus(kind BulkOpKind) BulkStatus {
+	switch kind {
+	case BulkCreate:
+		return BulkCreated
+	case BulkUpdate:
+		return BulkUpdated
+	default:
+		return BulkDeleted
+	}
+}
+
+func bulkHistoryAction(kind BulkOpKind) HistoryAction {
+	switch kind {
+	case BulkCreate:
+		return ActionCreated
+	case BulkUpdate:
+		return ActionUpdated
+	default:
+		return ActionDeleted
+	}
+}
+
+func firstBulkFailure(results []BulkItemResult) int {
+	for i, result := range results {
+		if result.Error != nil {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// Tasks changed by filter are processed in batches of this size
+	filterWriteBatchSize = MaxBulkOperations
+	// Number of matching task ids returned by a dry run
+	filterSampleSize = 10
+)
+
+// ? Outcome of an update or delete by filter. A dry run only fills Matched and SampleIDs.
+type FilterWriteResult struct {
+	DryRun    bool     `json:"dry_run"`
+	Matched   int64    `json:"matched"`
+	Affected  int64    `json:"affected"`
+	Failed    int64    `json:"failed"`
+	SampleIDs []string `json:"sample_ids,omitempty"`
+}
+
+// PreviewByFilter counts the live tasks matching the filter and returns a few of their ids
+func (r *TaskRepository) PreviewByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error) {
+	query := filter.toBson()
+
+	total, err := r.Collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, classifyError("PreviewByFilter", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(filterSampleSize).
+		SetProjection(bson.M{"_id": 1})
+
+	cursor, err := r.Collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, classifyError("PreviewByFilter", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := &FilterWriteResult{DryRun: true, Matched: total, SampleIDs: make([]string, 0, filterSampleSize)}
+	for cursor.Next(ctx) {
+		var task Tasks
+		if err := cursor.Decode(&task); err != nil {
+			return nil, err
+		}
+		result.SampleIDs = append(result.SampleIDs, task.ID.Hex())
+	}
+
+	return result, classifyError("PreviewByFilter", cursor.Err())
+}
+
+// UpdateByFilter applies the payload to every live task matching the filter
+func (r *TaskRepository) UpdateByFilter(ctx context.Context, filter TaskFilter, payload *UpdateTask) (*FilterWriteResult, error) {
+	if payload.IsEmpty() {
+		return nil, validationError("UpdateByFilter", "payload can not be empty")
+	}
+
+	return r.writeByFilter(ctx, "UpdateByFilter", filter, BulkOperation{Kind: BulkUpdate, Update: payload})
+}
+
+// DeleteByFilter moves every live task matching the filter to the trash
+func (r *TaskRepository) DeleteByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error) {
+	return r.writeByFilter(ctx, "DeleteByFilter", filter, BulkOperation{Kind: BulkDelete})
+}
+
+// each batch of them. Every write is guarded by the version the task
+// each batch with a bulk write. Every write is guarded by the version the task
+// had when read, so tasks modified in between are counted as failed rather
+// than overwritten, and only tasks actually changed get a history entry.
+func (r *TaskRepository) writeByFilter(ctx context.Context, op string, filter TaskFilter, template BulkOperation) (*FilterWriteResult, error) {
+	query := filter.toBson()
+	result := &FilterWriteResult{}
+	now := time.Now()
+
+	var lastID bson.ObjectID
+	for {
+		batchQuery := query
+		if !lastID.IsZero() {
+			batchQuery = bson.M{"$and": bson.A{query, bson.M{"_id": bson.M{"$gt": lastID}}}}
+		}
+
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(filterWriteBatchSize)
+		cursor, err := r.Collection.Find(ctx, batchQuery, opts)
+		if err != nil {
+			return nil, classifyError(op, err)
+		}
+
+		var tasks []*Tasks
+		for cursor.Next(ctx) {
+			var task Tasks
+			if err := cursor.Decode(&task); err != nil {
+				cursor.Close(ctx)
+				return nil, err
+			}
+			tasks = append(tasks, &task)
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return nil, classifyError(op, err)
+		}
+
+		if len(tasks) == 0 {
+			break
+		}
+		result.Matched += int64(len(tasks))
+		lastID = tasks[len(tasks)-1].ID
+
+		if err := r.writeFilterBatch(ctx, tasks, template, now, result); err != nil {
+			return nil, classifyError(op, err)
+		}
+
+		if len(tasks) < filterWriteBatchSize {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (r *TaskRepository) writeFilterBatch(ctx context.Context, tasks []*Tasks, template BulkOperation, now time.Time, result *FilterWriteResult) error {
+	current := make(map[bson.ObjectID]*Tasks, len(tasks))
+	for _, task := range tasks {
+		current[task.ID] = task
+	}
+
+	writes := make([]bulkWrite, 0, len(tasks))
+	for i, task := range tasks {
+		op := template
+		op.ID = task.ID.Hex()
+
+		write, itemErr := planBulkWrite(op, current, now)
+		if itemErr != nil {
+			result.Failed++
+			continue
+		}
+		write.index = i
+		writes = append(writes, *write)
+	}
+
+	if len(writes) == 0 {
+		return nil
+	}
+
+	failures, err := r.runBulkWrite(ctx, writes, false)
+	if err != nil {
+		return err
+	}
+
+	var historyErr error
+	for _, write := range writes {
+		if failures[write.index] != nil {
+			result.Failed++
+			continue
+		}
+		result.Affected++
+		if err := r.recordBulkHistory(ctx, template.Kind, write); err != nil && historyErr == nil {
+			historyErr = err
+		}
+	}
+
+	return historyErr
+}
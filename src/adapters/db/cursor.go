@@ -0,0 +1,248 @@
+package db
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// PageCursor is a decoded keyset position: the sort value and _id of the
+// boundary task, and whether the page lies before or after it
+type PageCursor struct {
+	Value    any
+	ID       bson.ObjectID
+	Backward bool
+}
+
+// CursorCodec signs and verifies the opaque cursors handed out to clients
+type CursorCodec struct {
+	secret []byte
+}
+
+// ? Wire format of a cursor before it is signed and encoded
+type cursorPayload struct {
+	Sort     string          `json:"s"`
+	Desc     bool            `json:"d,omitempty"`
+	Value    json.RawMessage `json:"v,omitempty"`
+	ID       string          `json:"i"`
+	Backward bool            `json:"b,omitempty"`
+	Filter   string          `json:"f"`
+}
+
+// NewCursorCodec creates the codec used to sign task cursors. An empty secret
+// generates a random one, so cursors only stay valid for the process lifetime.
+func NewCursorCodec(secret []byte) *CursorCodec {
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		_, _ = rand.Read(secret)
+	}
+
+	return &CursorCodec{secret: secret}
+}
+
+// Encode returns the cursor pointing at task for the given query
+func (c *CursorCodec) Encode(query *TaskListQuery, task *Tasks, backward bool) string {
+	payload := cursorPayload{
+		Sort:     query.Sort.Field,
+		Desc:     query.Sort.Desc,
+		ID:       task.ID.Hex(),
+		Backward: backward,
+		Filter:   queryFingerprint(query),
+	}
+
+	if value := task.sortValue(query.Sort.Field); value != nil {
+		payload.Value, _ = json.Marshal(value)
+	}
+
+	raw, _ := json.Marshal(payload)
+	encoding := base64.RawURLEncoding
+
+	return encoding.EncodeToString(raw) + "." + encoding.EncodeToString(c.sign(raw))
+}
+
+// Decode verifies a cursor and checks that it was issued for the same filter and sort as query
+func (c *CursorCodec) Decode(token string, query *TaskListQuery) (*PageCursor, error) {
+	invalid := &QueryError{Param: "cursor", Reason: "is malformed or has been tampered with"}
+	encoding := base64.RawURLEncoding
+
+	rawPayload, rawSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, invalid
+	}
+
+	raw, err := encoding.DecodeString(rawPayload)
+	if err != nil {
+		return nil, invalid
+	}
+	signature, err := encoding.DecodeString(rawSignature)
+	if err != nil || !hmac.Equal(signature, c.sign(raw)) {
+		return nil, invalid
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, invalid
+	}
+
+	if payload.Filter != queryFingerprint(query) || payload.Sort != query.Sort.Field || payload.Desc != query.Sort.Desc {
+		return nil, &QueryError{Param: "cursor", Reason: "was issued for a different filter or sort"}
+	}
+
+	id, err := bson.ObjectIDFromHex(payload.ID)
+	if err != nil {
+		return nil, invalid
+	}
+
+	value, err := decodeSortValue(payload.Sort, payload.Value)
+	if err != nil {
+		return nil, invalid
+	}
+
+	return &PageCursor{Value: value, ID: id, Backward: payload.Backward}, nil
+}
+
+// Paginate fills in the next and previous cursors of a page returned for query
+func (c *CursorCodec) Paginate(query *TaskListQuery, page *TaskPage) {
+	if len(page.Items) == 0 {
+		return
+	}
+
+	if page.HasMore {
+		page.NextCursor = c.Encode(query, &page.Items[len(page.Items)-1], false)
+	}
+	if page.HasPrev {
+		page.PrevCursor = c.Encode(query, &page.Items[0], true)
+	}
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// queryFingerprint identifies the filter and sort a cursor belongs to
+func queryFingerprint(query *TaskListQuery) string {
+	raw, _ := json.Marshal(struct {
+		Filter TaskFilter
+		Sort   TaskSort
+	}{query.Filter.normalized(), query.Sort})
+
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// normalized returns a copy of the filter with every time in UTC, so equal
+// instants given with different offsets produce the same fingerprint
+func (f TaskFilter) normalized() TaskFilter {
+	for _, t := range []**time.Time{
+		&f.TimestampFrom, &f.TimestampTo,
+		&f.CreatedFrom, &f.CreatedTo,
+		&f.UpdatedFrom, &f.UpdatedTo,
+	} {
+		if *t != nil {
+			utc := (*t).UTC()
+			*t = &utc
+		}
+	}
+
+	return f
+}
+
+// sortValue returns the value of the field used for sorting, nil when sorting by id
+func (t *Tasks) sortValue(field string) any {
+	switch field {
+	case "title":
+		return t.Title
+	case "completed":
+		return t.Completed
+	case "timestamp":
+		return t.Timestamp
+	case "created_at":
+		return t.CreatedAt
+	case "updated_at":
+		return t.UpdatedAt
+	default:
+		return nil
+	}
+}
+
+func decodeSortValue(field string, raw json.RawMessage) (any, error) {
+	var err error
+
+	switch field {
+	case "title":
+		var value string
+		err = json.Unmarshal(raw, &value)
+		return value, err
+	case "completed":
+		var value bool
+		err = json.Unmarshal(raw, &value)
+		return value, err
+	case "timestamp", "created_at", "updated_at":
+		var value time.Time
+		err = json.Unmarshal(raw, &value)
+		return value, err
+	default:
+		return nil, nil
+	}
+}
+
+// toBson returns the keyset condition selecting the tasks past the cursor
+func (c *PageCursor) toBson(sort TaskSort) bson.M {
+	op := "$gt"
+	if sort.Desc != c.Backward {
+		op = "$lt"
+	}
+
+	field := taskSortFields[sort.Field]
+	if field == "" || field == "_id" {
+		return bson.M{"_id": bson.M{op: c.ID}}
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{op: c.Value}},
+		bson.M{field: c.Value, "_id": bson.M{op: c.ID}},
+	}}
+}
+
+// toSQL returns the keyset condition selecting the rows past the cursor and its arguments
+func (c *PageCursor) toSQL(sort TaskSort) (string, []any) {
+	op := ">"
+	if sort.Desc != c.Backward {
+		op = "<"
+	}
+
+	column := sqlSortColumn(sort.Field)
+	if column == "id" {
+		return "id " + op + " ?", []any{c.ID.Hex()}
+	}
+
+	value := c.Value
+	if t, ok := value.(time.Time); ok {
+		value = sqlTime(t)
+	}
+
+	condition := "(" + column + " " + op + " ? OR (" + column + " = ? AND id " + op + " ?))"
+	return condition, []any{value, value, c.ID.Hex()}
+}
+
+// admits reports whether task lies past the cursor, like the condition returned by toBson
+func (c *PageCursor) admits(sort TaskSort, task *Tasks) bool {
+	order := compareSortValues(task.sortValue(sort.Field), c.Value)
+	if order == 0 {
+		order = bytes.Compare(task.ID[:], c.ID[:])
+	}
+
+	if sort.Desc != c.Backward {
+		return order < 0
+	}
+	return order > 0
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type ErrorKind string
+
+const (
+	KindNotFound    ErrorKind = "not_found"
+	KindInvalidID   ErrorKind = "invalid_id"
+	KindConflict    ErrorKind = "conflict"
+	KindValidation  ErrorKind = "validation"
+	KindUnavailable ErrorKind = "unavailable"
+)
+
+// ? Sentinels to match a RepositoryError kind with errors.Is
+var (
+	ErrNotFound    = &RepositoryError{Kind: KindNotFound}
+	ErrInvalidID   = &RepositoryError{Kind: KindInvalidID}
+	ErrConflict    = &RepositoryError{Kind: KindConflict}
+	ErrValidation  = &RepositoryError{Kind: KindValidation}
+	ErrUnavailable = &RepositoryError{Kind: KindUnavailable}
+)
+
+// ErrVersionMismatch is wrapped by the conflict returned when a task is no longer at the expected version
+var ErrVersionMismatch = errors.New("task version mismatch")
+
+// RepositoryError is a classified failure of a repository operation.
+// Detail is safe to show to clients, Err is the underlying cause and must not be.
+type RepositoryError struct {
+	Kind   ErrorKind
+	Op     string
+	Detail string
+	Err    error
+}
+
+func (e *RepositoryError) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = string(e.Kind)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Op != "" {
+		msg = e.Op + ": " + msg
+	}
+
+	return msg
+}
+
+func (e *RepositoryError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any RepositoryError of the same kind, so sentinels work with errors.Is
+func (e *RepositoryError) Is(target error) bool {
+	t, ok := target.(*RepositoryError)
+	return ok && t.Kind == e.Kind
+}
+
+func invalidIDError(op, id string, err error) error {
+	return &RepositoryError{
+		Kind:   KindInvalidID,
+		Op:     op,
+		Detail: fmt.Sprintf("%q is not a valid task id", id),
+		Err:    err,
+	}
+}
+
+func versionMismatchError(op string, expected, current int64) error {
+	return &RepositoryError{
+		Kind:   KindConflict,
+		Op:     op,
+		Detail: "task has been modified since it was read",
+		Err:    fmt.Errorf("%w: expected version %d, current version %d", ErrVersionMismatch, expected, current),
+	}
+}
+
+func notFoundError(op string) error {
+	return &RepositoryError{Kind: KindNotFound, Op: op, Detail: "task not found"}
+}
+
+func validationError(op, detail string) error {
+	return &RepositoryError{Kind: KindValidation, Op: op, Detail: detail}
+}
+
+// classifyError turns a driver error into a RepositoryError when it maps to a
+// known kind. Unrecognised errors are returned untouched and treated as internal.
+func classifyError(op string, err error) error {
+	var repoErr *RepositoryError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &repoErr):
+		return err
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &RepositoryError{Kind: KindNotFound, Op: op, Detail: "task not found", Err: err}
+	case mongo.IsDuplicateKeyError(err):
+		return &RepositoryError{Kind: KindConflict, Op: op, Detail: "task already exists", Err: err}
+	case isDocumentValidationFailure(err):
+		return &RepositoryError{Kind: KindValidation, Op: op, Detail: "task does not match the collection schema", Err: err}
+	case mongo.IsTimeout(err), mongo.IsNetworkError(err), errors.Is(err, mongo.ErrClientDisconnected):
+		return &RepositoryError{Kind: KindUnavailable, Op: op, Detail: "database is unavailable", Err: err}
+	default:
+		return err
+	}
+}
+
+// isDocumentValidationFailure reports whether a write was rejected by the collection validator
+func isDocumentValidationFailure(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(codeDocumentValidationFailure)
+}
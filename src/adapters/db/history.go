@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type HistoryAction string
+
+const (
+	ActionCreated  HistoryAction = "created"
+	ActionUpdated  HistoryAction = "updated"
+	ActionDeleted  HistoryAction = "deleted"
+	ActionRestored HistoryAction = "restored"
+	ActionPurged   HistoryAction = "purged"
+)
+
+// ? Before and after value of a single task field
+type FieldChange struct {
+	Field  string `bson:"field" json:"field"`
+	Before any    `bson:"before" json:"before"`
+	After  any    `bson:"after" json:"after"`
+}
+
+// ? DB Model for an immutable task history entry
+type TaskHistoryEntry struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	TaskID    bson.ObjectID `bson:"task_id" json:"task_id"`
+	Action    HistoryAction `bson:"action" json:"action"`
+	Changes   []FieldChange `bson:"changes" json:"changes"`
+	RequestID string        `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	Actor     string        `bson:"actor" json:"actor"`
+	Timestamp time.Time     `bson:"timestamp" json:"timestamp"`
+}
+
+type HistoryPage struct {
+	Items   []TaskHistoryEntry `json:"items"`
+	Total   int64              `json:"total"`
+	Limit   int64              `json:"limit"`
+	Offset  int64              `json:"offset"`
+	HasMore bool               `json:"has_more"`
+}
+
+// HistoryRepository only appends and reads entries, history is never modified
+type HistoryRepository struct {
+	Client     *mongo.Client
+	Database   *mongo.Database
+	Collection CollectionInterface
+}
+
+func NewHistoryRepository(client *mongo.Client, dbName, collectionName string) *HistoryRepository {
+	database := client.Database(dbName)
+
+	repository := &HistoryRepository{
+		Client:     client,
+		Database:   database,
+		Collection: database.Collection(collectionName),
+	}
+
+	return repository
+}
+
+// Record appends a history entry for a change on a task, stamped with the audit information of ctx
+func (h *HistoryRepository) Record(ctx context.Context, taskID bson.ObjectID, action HistoryAction, changes []FieldChange) error {
+	entry := newHistoryEntry(ctx, taskID, action, changes)
+
+	if _, err := h.Collection.InsertOne(ctx, entry); err != nil {
+		return classifyError("RecordHistory", err)
+	}
+
+	return nil
+}
+
+func newHistoryEntry(ctx context.Context, taskID bson.ObjectID, action HistoryAction, changes []FieldChange) *TaskHistoryEntry {
+	audit := AuditFromContext(ctx)
+
+	return &TaskHistoryEntry{
+		TaskID:    taskID,
+		Action:    action,
+		Changes:   changes,
+		RequestID: audit.RequestID,
+		Actor:     audit.Actor,
+		Timestamp: time.Now(),
+	}
+}
+
+// ListByTask retrieves one page of the history of a task, newest entries first
+func (h *HistoryRepository) ListByTask(ctx context.Context, id string, query *HistoryQuery) (*HistoryPage, error) {
+	taskID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError("ListHistory", id, err)
+	}
+
+	filter := bson.M{"task_id": taskID}
+
+	total, err := h.Collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, classifyError("ListHistory", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(query.Offset).
+		SetLimit(query.Limit)
+
+	cursor, err := h.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, classifyError("ListHistory", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]TaskHistoryEntry, 0)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, classifyError("ListHistory", err)
+	}
+
+	return &HistoryPage{
+		Items:   entries,
+		Total:   total,
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+		HasMore: query.Offset+int64(len(entries)) < total,
+	}, nil
+}
+
+// recordHistory writes a history entry when a history repository is configured.
+// The change is already applied by then, so a failure can not undo it. It is
+// returned instead, so the caller knows the change went unaudited.
+func (r *TaskRepository) recordHistory(ctx context.Context, taskID bson.ObjectID, action HistoryAction, before, after *Tasks) error {
+	if r.History == nil {
+		return nil
+	}
+
+	if err := r.History.Record(ctx, taskID, action, DiffTasks(before, after)); err != nil {
+		return fmt.Errorf("task %s was %s but its history entry could not be recorded: %w", taskID.Hex(), action, err)
+	}
+
+	return nil
+}
+
+// DiffTasks lists the user visible fields that differ between two versions of a task.
+// A nil before or after stands for a task that does not exist yet or anymore.
+func DiffTasks(before, after *Tasks) []FieldChange {
+	fields := func(t *Tasks) map[string]any {
+		if t == nil {
+			return map[string]any{}
+		}
+
+		values := map[string]any{
+			"title":     t.Title,
+			"completed": t.Completed,
+			"timestamp": t.Timestamp,
+		}
+		if t.DeletedAt != nil {
+			values["deleted_at"] = *t.DeletedAt
+		}
+
+		return values
+	}
+
+	old, current := fields(before), fields(after)
+	changes := make([]FieldChange, 0)
+
+	for _, field := range []string{"title", "completed", "timestamp", "deleted_at"} {
+		prev, next := old[field], current[field]
+		if prevTime, ok := prev.(time.Time); ok {
+			if nextTime, ok := next.(time.Time); ok && prevTime.Equal(nextTime) {
+				continue
+			}
+		} else if reflect.DeepEqual(prev, next) {
+			continue
+		}
+
+		changes = append(changes, FieldChange{Field: field, Before: prev, After: next})
+	}
+
+	return changes
+}
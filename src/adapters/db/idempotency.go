@@ -0,0 +1,328 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ? DB Model for the stored outcome of an idempotent request
+type IdempotencyRecord struct {
+	Key         string            `bson:"_id"`
+	Fingerprint string            `bson:"fingerprint"`
+	Completed   bool              `bson:"completed"`
+	Status      int               `bson:"status,omitempty"`
+	Headers     map[string]string `bson:"headers,omitempty"`
+	Body        []byte            `bson:"body,omitempty"`
+	CreatedAt   time.Time         `bson:"created_at"`
+	// Token identifies the reservation, only the request holding it may complete or release the key
+	Token string `bson:"token"`
+	// ReservedUntil is when a reservation not completed by then is considered
+	// left by a crashed request, and may be taken over by a retry
+	ReservedUntil time.Time `bson:"reserved_until"`
+}
+
+// stale reports whether the request that reserved the key is given up on
+func (r *IdempotencyRecord) stale(now time.Time, lease time.Duration) bool {
+	return lease > 0 && !r.Completed && r.ReservedUntil.Before(now)
+}
+
+// newReservationToken returns the token of a new reservation
+func newReservationToken() string {
+	return bson.NewObjectID().Hex()
+}
+
+// reservationLostError reports a reservation that was taken over or has expired
+func reservationLostError(op string) error {
+	return &RepositoryError{Kind: KindConflict, Op: op, Detail: "idempotency key is no longer reserved by this request"}
+}
+
+type IdempotencyRepository struct {
+	Client     *mongo.Client
+	Database   *mongo.Database
+	Collection CollectionInterface
+	// Lease is how long a reservation is held before a retry may take it over, zero holds it until it expires
+	Lease time.Duration
+}
+
+func NewIdempotencyRepository(client *mongo.Client, dbName, collectionName string, lease time.Duration) *IdempotencyRepository {
+	database := client.Database(dbName)
+
+	repository := &IdempotencyRepository{
+		Client:     client,
+		Database:   database,
+		Collection: database.Collection(collectionName),
+		Lease:      lease,
+	}
+
+	return repository
+}
+
+// Reserve claims a key for a new request. When the key was free or its
+// reservation went stale, it returns no record and the token of the new
+// reservation, otherwise the record left by the request that claimed it first.
+// The unique _id guarantees that only one of several concurrent requests gets the key.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key, fingerprint string) (*IdempotencyRecord, string, error) {
+	now := time.Now()
+	record := &IdempotencyRecord{
+		Key:           key,
+		Fingerprint:   fingerprint,
+		CreatedAt:     now,
+		Token:         newReservationToken(),
+		ReservedUntil: now.Add(r.Lease),
+	}
+
+	_, err := r.Collection.InsertOne(ctx, record)
+	if err == nil {
+		return nil, record.Token, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, "", classifyError("ReserveIdempotencyKey", err)
+	}
+
+	if r.Lease > 0 {
+		// ? Records written before leases existed have no reserved_until, $not matches them too
+		filter := bson.M{"_id": key, "completed": false, "reserved_until": bson.M{"$not": bson.M{"$gte": now}}}
+		update := bson.M{"$set": bson.M{"fingerprint": fingerprint, "created_at": now, "token": record.Token, "reserved_until": record.ReservedUntil}}
+		result, err := r.Collection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return nil, "", classifyError("ReserveIdempotencyKey", err)
+		}
+		if result.ModifiedCount == 1 {
+			return nil, record.Token, nil
+		}
+	}
+
+	var existing IdempotencyRecord
+	if err := r.Collection.FindOne(ctx, bson.M{"_id": key}).Decode(&existing); err != nil {
+		return nil, "", classifyError("ReserveIdempotencyKey", err)
+	}
+
+	return &existing, "", nil
+}
+
+// Complete stores the response of the request holding the reservation token.
+// A reservation taken over by a retry is left alone and reported as a conflict.
+func (r *IdempotencyRepository) Complete(ctx context.Context, key, token string, status int, headers map[string]string, body []byte) error {
+	update := bson.M{"$set": bson.M{
+		"completed": true,
+		"status":    status,
+		"headers":   headers,
+		"body":      body,
+	}}
+
+	result, err := r.Collection.UpdateOne(ctx, bson.M{"_id": key, "token": token}, update)
+	if err != nil {
+		return classifyError("CompleteIdempotencyKey", err)
+	}
+	if result.MatchedCount == 0 {
+		return reservationLostError("CompleteIdempotencyKey")
+	}
+
+	return nil
+}
+
+// Release frees a key reserved with token so the request can be retried
+func (r *IdempotencyRepository) Release(ctx context.Context, key, token string) error {
+	result, err := r.Collection.DeleteOne(ctx, bson.M{"_id": key, "token": token})
+	if err != nil {
+		return classifyError("ReleaseIdempotencyKey", err)
+	}
+	if result.DeletedCount == 0 {
+		return reservationLostError("ReleaseIdempotencyKey")
+	}
+
+	return nil
+}
+
+// MemoryIdempotencyStore keeps idempotency records in process memory, for the
+// memory storage backend. Records older than the TTL are treated as expired,
+// a zero TTL keeps them forever.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	lease   time.Duration
+	records map[string]*IdempotencyRecord
+}
+
+// NewMemoryIdempotencyStore keeps records for ttl, and reservations for lease
+// before a retry may take them over. A zero lease holds them until they expire.
+func NewMemoryIdempotencyStore(ttl, lease time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{ttl: ttl, lease: lease, records: make(map[string]*IdempotencyRecord)}
+}
+
+// Reserve claims a key for a new request. When the key was free or its
+// reservation went stale, it returns no record and the token of the new
+// reservation, otherwise a copy of the record left by the request that claimed it first.
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string) (*IdempotencyRecord, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	existing, ok := s.records[key]
+	if ok && (s.ttl <= 0 || now.Sub(existing.CreatedAt) < s.ttl) && !existing.stale(now, s.lease) {
+		copied := *existing
+		return &copied, "", nil
+	}
+
+	token := newReservationToken()
+	s.records[key] = &IdempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: now, Token: token, ReservedUntil: now.Add(s.lease)}
+	return nil, token, nil
+}
+
+// Complete stores the response of the request holding the reservation token.
+// A reservation taken over by a retry is left alone and reported as a conflict.
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key, token string, status int, headers map[string]string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || record.Token != token {
+		return reservationLostError("CompleteIdempotencyKey")
+	}
+
+	record.Completed = true
+	record.Status = status
+	record.Headers = headers
+	record.Body = append([]byte(nil), body...)
+
+	return nil
+}
+
+// Release frees a key reserved with token so the request can be retried
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; !ok || record.Token != token {
+		return reservationLostError("ReleaseIdempotencyKey")
+	}
+	delete(s.records, key)
+	return nil
+}
+
+// SQLIdempotencyStore keeps idempotency records in the database of a SQL store.
+// Records older than the TTL are treated as expired, a zero TTL keeps them forever.
+type SQLIdempotencyStore struct {
+	DB      *sql.DB
+	dialect *SQLDialect
+	ttl     time.Duration
+	lease   time.Duration
+}
+
+// NewSQLIdempotencyStore keeps records for ttl, and reservations for lease
+// before a retry may take them over. A zero lease holds them until they expire.
+func NewSQLIdempotencyStore(conn *sql.DB, dialect *SQLDialect, ttl, lease time.Duration) *SQLIdempotencyStore {
+	return &SQLIdempotencyStore{DB: conn, dialect: dialect, ttl: ttl, lease: lease}
+}
+
+// Reserve claims a key for a new request. When the key was free or its
+// reservation went stale, it returns no record and the token of the new
+// reservation, otherwise the record left by the request that claimed it first.
+// The primary key guarantees that only one of several concurrent requests gets the key.
+func (s *SQLIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string) (*IdempotencyRecord, string, error) {
+	now := time.Now()
+
+	if s.ttl > 0 {
+		_, err := s.conn().ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idempotency_key = ? AND created_at < ?", key, sqlTime(now.Add(-s.ttl)))
+		if err != nil {
+			return nil, "", classifySQLError(s.dialect, "ReserveIdempotencyKey", err)
+		}
+	}
+
+	token := newReservationToken()
+	reservedUntil := sqlTime(now.Add(s.lease))
+	result, err := s.conn().ExecContext(ctx,
+		`INSERT INTO idempotency_keys (idempotency_key, fingerprint, completed, status, headers, created_at, token, reserved_until)
+		VALUES (?, ?, ?, 0, '{}', ?, ?, ?) ON CONFLICT (idempotency_key) DO NOTHING`,
+		key, fingerprint, false, sqlTime(now), token, reservedUntil)
+	if err != nil {
+		return nil, "", classifySQLError(s.dialect, "ReserveIdempotencyKey", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, "", classifySQLError(s.dialect, "ReserveIdempotencyKey", err)
+	}
+	if inserted == 1 {
+		return nil, token, nil
+	}
+
+	if s.lease > 0 {
+		result, err := s.conn().ExecContext(ctx,
+			`UPDATE idempotency_keys SET fingerprint = ?, created_at = ?, token = ?, reserved_until = ?
+			WHERE idempotency_key = ? AND completed = ? AND reserved_until < ?`,
+			fingerprint, sqlTime(now), token, reservedUntil, key, false, sqlTime(now))
+		if err != nil {
+			return nil, "", classifySQLError(s.dialect, "ReserveIdempotencyKey", err)
+		}
+		takenOver, err := result.RowsAffected()
+		if err != nil {
+			return nil, "", classifySQLError(s.dialect, "ReserveIdempotencyKey", err)
+		}
+		if takenOver == 1 {
+			return nil, token, nil
+		}
+	}
+
+	existing := IdempotencyRecord{Key: key}
+	var headers string
+	var createdAt, reservedUntilMs int64
+	err = s.conn().QueryRowContext(ctx,
+		"SELECT fingerprint, completed, status, headers, body, created_at, reserved_until FROM idempotency_keys WHERE idempotency_key = ?", key).
+		Scan(&existing.Fingerprint, &existing.Completed, &existing.Status, &headers, &existing.Body, &createdAt, &reservedUntilMs)
+	if err != nil {
+		return nil, "", classifySQLError(s.dialect, "ReserveIdempotencyKey", err)
+	}
+	if err := json.Unmarshal([]byte(headers), &existing.Headers); err != nil {
+		return nil, "", err
+	}
+	existing.CreatedAt = fromSQLTime(createdAt)
+	existing.ReservedUntil = fromSQLTime(reservedUntilMs)
+
+	return &existing, "", nil
+}
+
+// Complete stores the response of the request holding the reservation token.
+// A reservation taken over by a retry is left alone and reported as a conflict.
+func (s *SQLIdempotencyStore) Complete(ctx context.Context, key, token string, status int, headers map[string]string, body []byte) error {
+	encodedHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.conn().ExecContext(ctx,
+		"UPDATE idempotency_keys SET completed = ?, status = ?, headers = ?, body = ? WHERE idempotency_key = ? AND token = ?",
+		true, status, string(encodedHeaders), body, key, token)
+	return s.ownedWrite("CompleteIdempotencyKey", result, err)
+}
+
+// Release frees a key reserved with token so the request can be retried
+func (s *SQLIdempotencyStore) Release(ctx context.Context, key, token string) error {
+	result, err := s.conn().ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idempotency_key = ? AND token = ?", key, token)
+	return s.ownedWrite("ReleaseIdempotencyKey", result, err)
+}
+
+// ownedWrite checks a write conditioned on the reservation token found its row
+func (s *SQLIdempotencyStore) ownedWrite(op string, result sql.Result, err error) error {
+	if err != nil {
+		return classifySQLError(s.dialect, op, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return classifySQLError(s.dialect, op, err)
+	}
+	if affected == 0 {
+		return reservationLostError(op)
+	}
+
+	return nil
+}
+
+func (s *SQLIdempotencyStore) conn() sqlConn {
+	return sqlConn{q: s.DB, dialect: s.dialect}
+}
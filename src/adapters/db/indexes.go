@@ -0,0 +1,340 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// IndexState tells how an index found in the database compares to the registry
+type IndexState string
+
+const (
+	IndexOK        IndexState = "ok"
+	IndexMissing   IndexState = "missing"
+	IndexCreated   IndexState = "created"
+	IndexDrifted   IndexState = "drifted"
+	IndexUnmanaged IndexState = "unmanaged"
+)
+
+// ? Declaration of an index the service relies on
+type IndexSpec struct {
+	Name   string
+	Keys   bson.D
+	Unique bool
+	// ExpireAfter turns the index into a TTL index when set
+	ExpireAfter *time.Duration
+}
+
+// ? Indexes declared for a single collection
+type CollectionIndexes struct {
+	Collection string
+	Indexes    []IndexSpec
+}
+
+// IndexRegistry is the full set of indexes the service expects in its database
+type IndexRegistry []CollectionIndexes
+
+// ? Index as listed by Mongo
+type IndexDescription struct {
+	Name        string `bson:"name"`
+	Keys        bson.D `bson:"key"`
+	Unique      bool   `bson:"unique,omitempty"`
+	ExpireAfter *int64 `bson:"expireAfterSeconds,omitempty"`
+}
+
+// ? Desired and actual definition of an index, rendered for people
+type IndexStatus struct {
+	Collection string     `json:"collection"`
+	Name       string     `json:"name"`
+	State      IndexState `json:"state"`
+	Desired    string     `json:"desired,omitempty"`
+	Actual     string     `json:"actual,omitempty"`
+	Detail     string     `json:"detail,omitempty"`
+}
+
+type IndexReport struct {
+	Indexes []IndexStatus `json:"indexes"`
+}
+
+// Drifted returns the indexes whose definition differs from the registry
+func (r *IndexReport) Drifted() []IndexStatus {
+	var drifted []IndexStatus
+	for _, status := range r.Indexes {
+		if status.State == IndexDrifted {
+			drifted = append(drifted, status)
+		}
+	}
+
+	return drifted
+}
+
+// TaskIndexes declares the indexes backing task listings. Every task query
+// narrows down on deleted_at first, and sorts fall back to _id to stay stable.
+func TaskIndexes(collection string) CollectionIndexes {
+	return CollectionIndexes{
+		Collection: collection,
+		Indexes: []IndexSpec{
+			{Name: "tasks_by_timestamp", Keys: bson.D{{Key: "deleted_at", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}},
+			{Name: "tasks_by_created_at", Keys: bson.D{{Key: "deleted_at", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+			{Name: "tasks_by_updated_at", Keys: bson.D{{Key: "deleted_at", Value: 1}, {Key: "updated_at", Value: 1}, {Key: "_id", Value: 1}}},
+			{Name: "tasks_by_completed", Keys: bson.D{{Key: "deleted_at", Value: 1}, {Key: "completed", Value: 1}, {Key: "timestamp", Value: 1}}},
+		},
+	}
+}
+
+// HistoryIndexes declares the index serving the history of a task, newest entries first
+func HistoryIndexes(collection string) CollectionIndexes {
+	return CollectionIndexes{
+		Collection: collection,
+		Indexes: []IndexSpec{
+			{Name: "history_by_task", Keys: bson.D{{Key: "task_id", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+		},
+	}
+}
+
+// IdempotencyIndexes declares the TTL index making Mongo expire stored responses once they are older than ttl
+func IdempotencyIndexes(collection string, ttl time.Duration) CollectionIndexes {
+	return CollectionIndexes{
+		Collection: collection,
+		Indexes: []IndexSpec{
+			{Name: "created_at_ttl", Keys: bson.D{{Key: "created_at", Value: 1}}, ExpireAfter: &ttl},
+		},
+	}
+}
+
+// Inspect compares the indexes of the database with the registry without changing anything
+func (r IndexRegistry) Inspect(ctx context.Context, database *mongo.Database) (*IndexReport, error) {
+	report := &IndexReport{Indexes: []IndexStatus{}}
+	for _, declared := range r {
+		actual, err := listIndexes(ctx, database.Collection(declared.Collection))
+		if err != nil {
+			return nil, classifyError("InspectIndexes", err)
+		}
+		report.Indexes = append(report.Indexes, DiffIndexes(declared, actual)...)
+	}
+
+	return report, nil
+}
+
+// Ensure creates the missing indexes of the registry, so running it again is a
+// no-op. Drifted indexes are reported but left alone, since rebuilding an index
+// on a large collection is a decision for an operator.
+func (r IndexRegistry) Ensure(ctx context.Context, database *mongo.Database) (*IndexReport, error) {
+	report, err := r.Inspect(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, status := range report.Indexes {
+		if status.State != IndexMissing {
+			continue
+		}
+
+		spec := r.spec(status.Collection, status.Name)
+		_, err := database.Collection(status.Collection).Indexes().CreateOne(ctx, spec.model())
+		if err != nil {
+			return nil, classifyError("EnsureIndexes", err)
+		}
+		report.Indexes[i].State = IndexCreated
+	}
+
+	return report, nil
+}
+
+func (r IndexRegistry) spec(collection, name string) IndexSpec {
+	for _, declared := range r {
+		if declared.Collection != collection {
+			continue
+		}
+		for _, spec := range declared.Indexes {
+			if spec.Name == name {
+				return spec
+			}
+		}
+	}
+
+	return IndexSpec{}
+}
+
+// DiffIndexes matches the declared indexes of a collection with the actual ones.
+// Indexes are matched by name, or by keys when an equivalent index exists under
+// another name. Actual indexes left over, apart from _id, are reported as unmanaged.
+func DiffIndexes(declared CollectionIndexes, actual []IndexDescription) []IndexStatus {
+	statuses := make([]IndexStatus, 0, len(declared.Indexes))
+	matched := make(map[string]bool, len(actual))
+
+	for _, spec := range declared.Indexes {
+		status := IndexStatus{Collection: declared.Collection, Name: spec.Name, State: IndexMissing, Desired: spec.describe()}
+
+		index := slices.IndexFunc(actual, func(a IndexDescription) bool { return a.Name == spec.Name })
+		if index < 0 {
+			index = slices.IndexFunc(actual, func(a IndexDescription) bool { return sameIndexKeys(a.Keys, spec.Keys) })
+		}
+		if index >= 0 {
+			found := actual[index]
+			matched[found.Name] = true
+			status.Actual = found.describe()
+
+			status.State = IndexOK
+			if detail := spec.drift(found); detail != "" {
+				status.State, status.Detail = IndexDrifted, detail
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	for _, found := range actual {
+		if found.Name == "_id_" || matched[found.Name] {
+			continue
+		}
+		statuses = append(statuses, IndexStatus{
+			Collection: declared.Collection,
+			Name:       found.Name,
+			State:      IndexUnmanaged,
+			Actual:     found.describe(),
+		})
+	}
+
+	return statuses
+}
+
+// drift describes how the actual index differs from the spec, or returns "" when it matches
+func (s IndexSpec) drift(actual IndexDescription) string {
+	var diffs []string
+	if actual.Name != s.Name {
+		diffs = append(diffs, fmt.Sprintf("exists as %q", actual.Name))
+	}
+	if !sameIndexKeys(actual.Keys, s.Keys) {
+		diffs = append(diffs, "keys differ")
+	}
+	if actual.Unique != s.Unique {
+		diffs = append(diffs, "uniqueness differs")
+	}
+
+	switch {
+	case s.ExpireAfter == nil && actual.ExpireAfter != nil:
+		diffs = append(diffs, "unexpected TTL")
+	case s.ExpireAfter != nil && actual.ExpireAfter == nil:
+		diffs = append(diffs, "TTL missing")
+	case s.ExpireAfter != nil && int64(s.ExpireAfter.Seconds()) != *actual.ExpireAfter:
+		diffs = append(diffs, fmt.Sprintf("TTL is %ds instead of %ds", *actual.ExpireAfter, int64(s.ExpireAfter.Seconds())))
+	}
+
+	return strings.Join(diffs, ", ")
+}
+
+func (s IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(s.Name)
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.ExpireAfter != nil {
+		opts.SetExpireAfterSeconds(int32(s.ExpireAfter.Seconds()))
+	}
+
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}
+}
+
+func (s IndexSpec) describe() string {
+	var ttl *int64
+	if s.ExpireAfter != nil {
+		seconds := int64(s.ExpireAfter.Seconds())
+		ttl = &seconds
+	}
+
+	return describeIndex(s.Keys, s.Unique, ttl)
+}
+
+func (d IndexDescription) describe() string {
+	return describeIndex(d.Keys, d.Unique, d.ExpireAfter)
+}
+
+// describeIndex renders an index like the shell does, e.g. {timestamp: 1, _id: 1} unique
+func describeIndex(keys bson.D, unique bool, ttl *int64) string {
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = fmt.Sprintf("%s: %v", key.Key, key.Value)
+	}
+
+	description := "{" + strings.Join(fields, ", ") + "}"
+	if unique {
+		description += " unique"
+	}
+	if ttl != nil {
+		description += fmt.Sprintf(" ttl=%ds", *ttl)
+	}
+
+	return description
+}
+
+// sameIndexKeys compares key patterns in order. Mongo may list directions as
+// int32, int64 or double, so numbers are compared by value.
+func sameIndexKeys(a, b bson.D) bool {
+	return slices.EqualFunc(a, b, func(x, y bson.E) bool {
+		if x.Key != y.Key {
+			return false
+		}
+
+		xn, xok := indexDirection(x.Value)
+		yn, yok := indexDirection(y.Value)
+		if xok && yok {
+			return xn == yn
+		}
+
+		return x.Value == y.Value
+	})
+}
+
+func indexDirection(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// listIndexes returns the indexes of the collection, none when it does not exist yet
+func listIndexes(ctx context.Context, collection *mongo.Collection) ([]IndexDescription, error) {
+	cursor, err := collection.Indexes().List(ctx)
+	if isNamespaceNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []IndexDescription
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	return indexes, nil
+}
+
+// Server error codes of the collection management commands and validator
+const (
+	codeNamespaceNotFound         = 26
+	codeNamespaceExists           = 48
+	codeDocumentValidationFailure = 121
+)
+
+func isNamespaceNotFound(err error) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorCode(codeNamespaceNotFound)
+}
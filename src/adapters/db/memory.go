@@ -0,0 +1,414 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// MemoryStore keeps tasks and their history in process memory. It behaves like
+// the Mongo repositories and is meant for tests and local development, nothing
+// survives a restart. Tasks are copied in and out so callers never share them.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	tasks   map[bson.ObjectID]*Tasks
+	history []TaskHistoryEntry
+}
+
+var (
+	_ TaskStore    = (*MemoryStore)(nil)
+	_ HistoryStore = (*MemoryStore)(nil)
+)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tasks: make(map[bson.ObjectID]*Tasks)}
+}
+
+// CreateTodo stores a new task
+func (s *MemoryStore) CreateTodo(ctx context.Context, payload *CreateNewTask) (*Tasks, error) {
+	now := time.Now()
+
+	newTask := &Tasks{
+		ID:        bson.NewObjectID(),
+		Title:     payload.Title,
+		Timestamp: *payload.Timestamp,
+		Completed: payload.Completed,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tasks[newTask.ID] = copyTask(newTask)
+	s.recordHistory(ctx, newTask.ID, ActionCreated, nil, newTask)
+
+	return newTask, nil
+}
+
+// GetAllTasks returns a single page of the tasks matching the query
+func (s *MemoryStore) GetAllTasks(ctx context.Context, query *TaskListQuery) (*TaskPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matching := s.matching(query.Filter)
+	total := int64(len(matching))
+
+	sort := query.Sort
+	if query.Cursor != nil {
+		if query.Cursor.Backward {
+			sort = sort.reversed()
+		}
+		matching = slices.DeleteFunc(matching, func(task *Tasks) bool {
+			return !query.Cursor.admits(query.Sort, task)
+		})
+	}
+	slices.SortFunc(matching, sort.compare)
+
+	if query.Cursor == nil {
+		matching = matching[min(query.Offset, int64(len(matching))):]
+	}
+	matching = matching[:min(query.Limit+1, int64(len(matching)))]
+
+	tasks := make([]Tasks, 0, len(matching))
+	for _, task := range matching {
+		tasks = append(tasks, *copyTask(task))
+	}
+
+	return newTaskPage(query, tasks, total), nil
+}
+
+// GetTaskById returns a live task
+func (s *MemoryStore) GetTaskById(ctx context.Context, id string) (*Tasks, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, err := s.live("GetTaskById", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyTask(task), nil
+}
+
+// ModifyTask updates the fields set in the payload. When expectedVersion is not nil
+// the update only applies if the task is still at that version.
+func (s *MemoryStore) ModifyTask(ctx context.Context, id string, payload *UpdateTask, expectedVersion *int64) (*Tasks, error) {
+	if payload.IsEmpty() {
+		return nil, validationError("ModifyTask", "payload can not be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, err := s.live("ModifyTask", id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != nil && *expectedVersion != task.Version {
+		return nil, versionMismatchError("ModifyTask", *expectedVersion, task.Version)
+	}
+
+	previousTask := copyTask(task)
+	payload.applyTo(task)
+	task.UpdatedAt = time.Now()
+	task.Version++
+
+	s.recordHistory(ctx, task.ID, ActionUpdated, previousTask, task)
+
+	return copyTask(task), nil
+}
+
+// ReplaceTask overwrites every editable field of a task with the payload.
+// When expectedVersion is not nil the task must still be at that version.
+func (s *MemoryStore) ReplaceTask(ctx context.Context, id string, payload *CreateNewTask, expectedVersion *int64) (*Tasks, error) {
+	return s.ModifyTask(ctx, id, payload.asUpdate(), expectedVersion)
+}
+
+// PatchTask persists the patch that build computes from the current task. The
+// store is locked meanwhile, so the task can not change in between.
+func (s *MemoryStore) PatchTask(ctx context.Context, id string, expectedVersion *int64, build func(*Tasks) (*TaskPatch, error)) (*Tasks, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, err := s.live("PatchTask", id)
+	if err != nil {
+		return nil, err
+	}
+	if expectedVersion != nil && *expectedVersion != task.Version {
+		return nil, versionMismatchError("PatchTask", *expectedVersion, task.Version)
+	}
+
+	patch, err := build(copyTask(task))
+	if err != nil {
+		return nil, err
+	}
+
+	updatedTask := copyTask(task)
+	patch.applyTo(updatedTask)
+	if len(DiffTasks(task, updatedTask)) == 0 {
+		return copyTask(task), nil
+	}
+
+	updatedTask.UpdatedAt = time.Now()
+	updatedTask.Version++
+
+	s.recordHistory(ctx, task.ID, ActionUpdated, task, updatedTask)
+	s.tasks[task.ID] = copyTask(updatedTask)
+
+	return updatedTask, nil
+}
+
+// DeleteTask moves a task to the trash.
+// When expectedVersion is not nil the task must still be at that version.
+func (s *MemoryStore) DeleteTask(ctx context.Context, id string, expectedVersion *int64) (bson.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, err := s.live("DeleteTask", id)
+	if err != nil {
+		return bson.NilObjectID, err
+	}
+	if expectedVersion != nil && *expectedVersion != task.Version {
+		return bson.NilObjectID, versionMismatchError("DeleteTask", *expectedVersion, task.Version)
+	}
+
+	now := time.Now()
+	task.DeletedAt = &now
+	task.Version++
+
+	s.recordHistory(ctx, task.ID, ActionDeleted, &Tasks{}, &Tasks{DeletedAt: &now})
+
+	return task.ID, nil
+}
+
+// RestoreTask takes a task out of the trash
+func (s *MemoryStore) RestoreTask(ctx context.Context, id string) (*Tasks, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError("RestoreTask", id, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, found := s.tasks[objID]
+	if !found || task.DeletedAt == nil {
+		return nil, notFoundError("RestoreTask")
+	}
+
+	trashedTask := copyTask(task)
+	task.DeletedAt = nil
+	task.Version++
+
+	s.recordHistory(ctx, objID, ActionRestored, trashedTask, task)
+
+	return copyTask(task), nil
+}
+
+// PurgeTask permanently removes a task, whether it is in the trash or not
+func (s *MemoryStore) PurgeTask(ctx context.Context, id string) (bson.ObjectID, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return bson.NilObjectID, invalidIDError("PurgeTask", id, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.tasks[objID]; !found {
+		return bson.NilObjectID, notFoundError("PurgeTask")
+	}
+	delete(s.tasks, objID)
+
+	s.recordHistory(ctx, objID, ActionPurged, nil, nil)
+
+	return objID, nil
+}
+
+// PurgeTrash permanently removes every task that was trashed before the cutoff,
+// recording each purge in the history
+func (s *MemoryStore) PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, task := range s.tasks {
+		if task.DeletedAt != nil && task.DeletedAt.Before(cutoff) {
+			delete(s.tasks, id)
+			s.recordHistory(ctx, id, ActionPurged, nil, nil)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// BulkWrite runs a batch of operations with the same rules as the Mongo
+// repository. The store stays locked for the whole batch, so every planned
+// write succeeds and atomic batches need no rollback.
+func (s *MemoryStore) BulkWrite(ctx context.Context, ops []BulkOperation, opts BulkOptions) ([]BulkItemResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := make(map[bson.ObjectID]*Tasks, len(ops))
+	for _, op := range ops {
+		if objID, err := bson.ObjectIDFromHex(op.ID); err == nil {
+			if task, found := s.tasks[objID]; found && task.DeletedAt == nil {
+				current[objID] = copyTask(task)
+			}
+		}
+	}
+
+	results, writes := planBulkBatch(ops, opts, current, time.Now())
+	for _, write := range writes {
+		s.tasks[write.after.ID] = copyTask(write.after)
+	}
+
+	return settleBulkBatch(ops, opts, results, writes, nil, func(kind BulkOpKind, write bulkWrite) {
+		s.recordHistory(ctx, write.after.ID, bulkHistoryAction(kind), write.before, write.after)
+	}), nil
+}
+
+// PreviewByFilter counts the live tasks matching the filter and returns a few of their ids
+func (s *MemoryStore) PreviewByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matching := s.matching(filter)
+	slices.SortFunc(matching, TaskSort{Field: "id"}.compare)
+
+	result := &FilterWriteResult{DryRun: true, Matched: int64(len(matching)), SampleIDs: make([]string, 0, filterSampleSize)}
+	for _, task := range matching[:min(filterSampleSize, len(matching))] {
+		result.SampleIDs = append(result.SampleIDs, task.ID.Hex())
+	}
+
+	return result, nil
+}
+
+// UpdateByFilter applies the payload to every live task matching the filter
+func (s *MemoryStore) UpdateByFilter(ctx context.Context, filter TaskFilter, payload *UpdateTask) (*FilterWriteResult, error) {
+	if payload.IsEmpty() {
+		return nil, validationError("UpdateByFilter", "payload can not be empty")
+	}
+
+	return s.writeByFilter(ctx, filter, BulkOperation{Kind: BulkUpdate, Update: payload}), nil
+}
+
+// DeleteByFilter moves every live task matching the filter to the trash
+func (s *MemoryStore) DeleteByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error) {
+	return s.writeByFilter(ctx, filter, BulkOperation{Kind: BulkDelete}), nil
+}
+
+// ListByTask retrieves one page of the history of a task, newest entries first
+func (s *MemoryStore) ListByTask(ctx context.Context, id string, query *HistoryQuery) (*HistoryPage, error) {
+	taskID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError("ListHistory", id, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]TaskHistoryEntry, 0)
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].TaskID == taskID {
+			entries = append(entries, s.history[i])
+		}
+	}
+
+	total := int64(len(entries))
+	entries = entries[min(query.Offset, total):]
+	entries = entries[:min(query.Limit, int64(len(entries)))]
+
+	return &HistoryPage{
+		Items:   entries,
+		Total:   total,
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+		HasMore: query.Offset+int64(len(entries)) < total,
+	}, nil
+}
+
+// writeByFilter applies template to every live task matching the filter. The
+// store is locked meanwhile, so every matching task is changed.
+func (s *MemoryStore) writeByFilter(ctx context.Context, filter TaskFilter, template BulkOperation) *FilterWriteResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matching := s.matching(filter)
+	slices.SortFunc(matching, TaskSort{Field: "id"}.compare)
+
+	current := make(map[bson.ObjectID]*Tasks, len(matching))
+	for _, task := range matching {
+		current[task.ID] = copyTask(task)
+	}
+
+	result := &FilterWriteResult{Matched: int64(len(matching))}
+	now := time.Now()
+	for _, task := range matching {
+		op := template
+		op.ID = task.ID.Hex()
+
+		write, itemErr := planBulkWrite(op, current, now)
+		if itemErr != nil {
+			result.Failed++
+			continue
+		}
+
+		s.tasks[task.ID] = copyTask(write.after)
+		s.recordHistory(ctx, task.ID, bulkHistoryAction(template.Kind), write.before, write.after)
+		result.Affected++
+	}
+
+	return result
+}
+
+// live returns the stored live task with the given id. Callers must hold the lock.
+func (s *MemoryStore) live(op, id string) (*Tasks, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError(op, id, err)
+	}
+
+	task, found := s.tasks[objID]
+	if !found || task.DeletedAt != nil {
+		return nil, notFoundError(op)
+	}
+
+	return task, nil
+}
+
+// matching returns the stored tasks selected by the filter. Callers must hold the lock.
+func (s *MemoryStore) matching(filter TaskFilter) []*Tasks {
+	matching := make([]*Tasks, 0)
+	for _, task := range s.tasks {
+		if filter.matches(task) {
+			matching = append(matching, task)
+		}
+	}
+
+	return matching
+}
+
+// recordHistory appends a history entry. Callers must hold the write lock.
+func (s *MemoryStore) recordHistory(ctx context.Context, taskID bson.ObjectID, action HistoryAction, before, after *Tasks) {
+	entry := newHistoryEntry(ctx, taskID, action, DiffTasks(before, after))
+	entry.ID = bson.NewObjectID()
+
+	s.history = append(s.history, *entry)
+}
+
+func copyTask(task *Tasks) *Tasks {
+	copied := *task
+	if task.DeletedAt != nil {
+		deletedAt := *task.DeletedAt
+		copied.DeletedAt = &deletedAt
+	}
+
+	return &copied
+}
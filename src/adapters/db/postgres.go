@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Postgres runs the SQL store on a PostgreSQL server. Text columns compared or
+// sorted on use the "C" collation, so they order byte-wise like Mongo does.
+var Postgres = &SQLDialect{
+	Name:           "PostgreSQL",
+	Open:           openPostgres,
+	numberedParams: true,
+	lockRows:       " FOR UPDATE",
+	// Any constant works as the lock key as long as every instance uses the same one
+	migrationLock:   "SELECT pg_advisory_lock(727274)",
+	migrationUnlock: "SELECT pg_advisory_unlock(727274)",
+	migrations: []string{
+		`CREATE TABLE tasks (
+			id         TEXT COLLATE "C" PRIMARY KEY,
+			title      TEXT COLLATE "C" NOT NULL,
+			completed  BOOLEAN NOT NULL,
+			timestamp  BIGINT NOT NULL,
+			created_at BIGINT NOT NULL,
+			updated_at BIGINT NOT NULL,
+			deleted_at BIGINT,
+			version    BIGINT NOT NULL
+		);
+		CREATE INDEX tasks_deleted_at ON tasks (deleted_at);
+		CREATE TABLE task_history (
+			id         TEXT COLLATE "C" PRIMARY KEY,
+			task_id    TEXT COLLATE "C" NOT NULL,
+			action     TEXT NOT NULL,
+			changes    TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			actor      TEXT NOT NULL,
+			timestamp  BIGINT NOT NULL
+		);
+		CREATE INDEX task_history_task_id ON task_history (task_id, timestamp);`,
+		`CREATE TABLE idempotency_keys (
+			idempotency_key TEXT PRIMARY KEY,
+			fingerprint     TEXT NOT NULL,
+			completed       BOOLEAN NOT NULL,
+			status          INTEGER NOT NULL,
+			headers         TEXT NOT NULL,
+			body            BYTEA,
+			created_at      BIGINT NOT NULL
+		);`,
+		`CREATE TABLE api_keys (
+			id           TEXT COLLATE "C" PRIMARY KEY,
+			name         TEXT NOT NULL,
+			prefix       TEXT NOT NULL,
+			hash         TEXT NOT NULL UNIQUE,
+			scopes       TEXT NOT NULL,
+			created_at   BIGINT NOT NULL,
+			expires_at   BIGINT,
+			last_used_at BIGINT,
+			revoked_at   BIGINT
+		);`,
+		`ALTER TABLE idempotency_keys ADD COLUMN reserved_until BIGINT NOT NULL DEFAULT 0;`,
+		`ALTER TABLE idempotency_keys ADD COLUMN token TEXT NOT NULL DEFAULT '';`,
+	},
+	classify: classifyPostgresError,
+}
+
+// openPostgres returns a connection pool for the server at dsn, a postgres:// URL
+// or a key=value connection string. The pool is sized by the caller.
+func openPostgres(dsn string) (*sql.DB, error) {
+	return sql.Open("pgx", dsn)
+}
+
+func classifyPostgresError(err error) ErrorKind {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505":
+			return KindConflict
+		// Connection exceptions, server shutdowns and too many connections
+		case pgErr.Code[:2] == "08", pgErr.Code[:2] == "57", pgErr.Code == "53300":
+			return KindUnavailable
+		default:
+			return ""
+		}
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.Timeout(err) {
+		return KindUnavailable
+	}
+
+	return ""
+}
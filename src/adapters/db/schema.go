@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ? Actions Mongo takes on a document that fails the validator
+const (
+	ValidationOff   = "off"
+	ValidationWarn  = "warn"
+	ValidationError = "error"
+)
+
+// TaskValidator returns the $jsonSchema validator mirroring the Tasks struct
+// and the rules of CreateNewTask
+func TaskValidator() bson.M {
+	return bson.M{"$jsonSchema": bson.M{
+		"bsonType":             "object",
+		"required":             bson.A{"title", "completed", "timestamp", "created_at", "updated_at", "version"},
+		"additionalProperties": false,
+		"properties": bson.M{
+			"_id":        bson.M{"bsonType": "objectId"},
+			"title":      bson.M{"bsonType": "string", "minLength": 3, "maxLength": 100},
+			"completed":  bson.M{"bsonType": "bool"},
+			"timestamp":  bson.M{"bsonType": "date"},
+			"created_at": bson.M{"bsonType": "date"},
+			"updated_at": bson.M{"bsonType": "date"},
+			"deleted_at": bson.M{"bsonType": bson.A{"date", "null"}},
+			"version":    bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1},
+		},
+	}}
+}
+
+// ApplyTaskValidator installs the task validator on the collection, creating it
+// when missing. The moderate level leaves documents that were already invalid
+// editable, so older tasks keep working. action is ValidationWarn or ValidationError.
+func ApplyTaskValidator(ctx context.Context, database *mongo.Database, collection, action string) error {
+	err := database.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: TaskValidator()},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: action},
+	}).Err()
+	if !isNamespaceNotFound(err) {
+		return classifyError("ApplyTaskValidator", err)
+	}
+
+	opts := options.CreateCollection().
+		SetValidator(TaskValidator()).
+		SetValidationLevel("moderate").
+		SetValidationAction(action)
+	err = database.CreateCollection(ctx, collection, opts)
+
+	// Another instance created the collection in the meantime
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(codeNamespaceExists) {
+		return ApplyTaskValidator(ctx, database, collection, action)
+	}
+
+	return classifyError("ApplyTaskValidator", err)
+}
@@ -0,0 +1,844 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// SQLDialect holds what differs between the SQL databases a SQLStore runs on
+type SQLDialect struct {
+	Name string
+	// Open returns a connection pool for the data source name of the database
+	Open func(dsn string) (*sql.DB, error)
+	// Schema changes applied in order, the position of a migration is its version
+	migrations []string
+	// numberedParams is set when placeholders are written $1, $2... instead of ?
+	numberedParams bool
+	// lockRows is appended to the queries reading rows that a transaction is about to change
+	lockRows string
+	// migrationLock and migrationUnlock keep concurrent instances from migrating at the same time
+	migrationLock   string
+	migrationUnlock string
+	// classify maps a driver error to a kind, or returns "" when it does not know it
+	classify func(err error) ErrorKind
+}
+
+// SQLStore keeps tasks and their history in a SQL database. Ids are ObjectID
+// hex strings and times are stored as Unix milliseconds, so tasks look the same
+// as with the Mongo repositories. Every change and its history entry are
+// written in the same transaction.
+type SQLStore struct {
+	DB      *sql.DB
+	dialect *SQLDialect
+}
+
+var (
+	_ TaskStore    = (*SQLStore)(nil)
+	_ HistoryStore = (*SQLStore)(nil)
+)
+
+const taskColumns = "id, title, completed, timestamp, created_at, updated_at, deleted_at, version"
+
+// ? Subset of *sql.DB and *sql.Tx used by the queries
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqlConn runs queries written with ? placeholders on the database of a dialect,
+// either directly or within a transaction when tx is set
+type sqlConn struct {
+	q       sqlQuerier
+	dialect *SQLDialect
+	tx      bool
+}
+
+func (c sqlConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.q.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c sqlConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.q.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c sqlConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.q.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
+// forUpdate returns the clause locking the selected rows until the end of the transaction, if any
+func (c sqlConn) forUpdate() string {
+	if !c.tx {
+		return ""
+	}
+
+	return c.dialect.lockRows
+}
+
+// rebind numbers the ? placeholders of query for dialects that need it
+func (d *SQLDialect) rebind(query string) string {
+	if !d.numberedParams {
+		return query
+	}
+
+	var b strings.Builder
+	quoted, n := false, 0
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func NewSQLStore(conn *sql.DB, dialect *SQLDialect) *SQLStore {
+	return &SQLStore{DB: conn, dialect: dialect}
+}
+
+// MigrateSQL brings the schema up to date by applying, each in its own
+// transaction, the migrations of the dialect that were not applied yet. The
+// applied versions are kept in schema_migrations. A schema newer than the
+// migrations known to this binary is an error.
+func MigrateSQL(ctx context.Context, db *sql.DB, dialect *SQLDialect) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return classifySQLError(dialect, "Migrate", err)
+	}
+	defer conn.Close()
+
+	if dialect.migrationLock != "" {
+		if _, err := conn.ExecContext(ctx, dialect.migrationLock); err != nil {
+			return classifySQLError(dialect, "Migrate", err)
+		}
+		defer conn.ExecContext(context.WithoutCancel(ctx), dialect.migrationUnlock)
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return classifySQLError(dialect, "Migrate", err)
+	}
+
+	var current int
+	if err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return classifySQLError(dialect, "Migrate", err)
+	}
+
+	// ? A newer release migrated this database, its schema may not be one this binary can use
+	if current > len(dialect.migrations) {
+		return fmt.Errorf("database schema version %d is newer than the %d migrations of this binary", current, len(dialect.migrations))
+	}
+
+	for i, migration := range dialect.migrations[current:] {
+		version := current + i + 1
+		if err := applyMigration(ctx, conn, dialect, version, migration); err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, dialect *SQLDialect, version int, migration string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return err
+	}
+
+	record := dialect.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)")
+	if _, err := tx.ExecContext(ctx, record, version, sqlTime(time.Now())); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CreateTodo inserts a new task
+func (s *SQLStore) CreateTodo(ctx context.Context, payload *CreateNewTask) (*Tasks, error) {
+	now := time.Now()
+
+	newTask := &Tasks{
+		ID:        bson.NewObjectID(),
+		Title:     payload.Title,
+		Timestamp: *payload.Timestamp,
+		Completed: payload.Completed,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+
+	err := s.withTx(ctx, "CreateTodo", func(tx sqlConn) error {
+		if err := insertSQLTask(ctx, tx, newTask); err != nil {
+			return err
+		}
+		return recordSQLHistory(ctx, tx, newTask.ID, ActionCreated, nil, newTask)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newTask, nil
+}
+
+// GetAllTasks retrieves a single page of tasks matching the query.
+// One extra task is fetched to find out whether another page follows.
+func (s *SQLStore) GetAllTasks(ctx context.Context, query *TaskListQuery) (*TaskPage, error) {
+	where, args := query.Filter.toSQL()
+
+	var total int64
+	if err := s.conn().QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, s.classify("GetAllTasks", err)
+	}
+
+	sort := query.Sort
+	page := " LIMIT ? OFFSET ?"
+	pageArgs := []any{query.Limit + 1, query.Offset}
+
+	if query.Cursor != nil {
+		if query.Cursor.Backward {
+			sort = sort.reversed()
+		}
+		keyset, keysetArgs := query.Cursor.toSQL(query.Sort)
+		where += " AND " + keyset
+		args = append(args, keysetArgs...)
+		page, pageArgs = " LIMIT ?", pageArgs[:1]
+	}
+
+	statement := "SELECT " + taskColumns + " FROM tasks WHERE " + where + " ORDER BY " + sort.toSQL() + page
+	found, err := querySQLTasks(ctx, s.conn(), statement, append(args, pageArgs...)...)
+	if err != nil {
+		return nil, s.classify("GetAllTasks", err)
+	}
+
+	tasks := make([]Tasks, 0, len(found))
+	for _, task := range found {
+		tasks = append(tasks, *task)
+	}
+
+	return newTaskPage(query, tasks, total), nil
+}
+
+// GetTaskById retrieves a single live task
+func (s *SQLStore) GetTaskById(ctx context.Context, id string) (*Tasks, error) {
+	task, err := findSQLTask(ctx, s.conn(), "GetTaskById", id, false)
+	if err != nil {
+		return nil, s.classify("GetTaskById", err)
+	}
+
+	return task, nil
+}
+
+// ModifyTask updates the fields set in the payload. When expectedVersion is not nil
+// the update only applies if the task is still at that version.
+func (s *SQLStore) ModifyTask(ctx context.Context, id string, payload *UpdateTask, expectedVersion *int64) (*Tasks, error) {
+	if payload.IsEmpty() {
+		return nil, validationError("ModifyTask", "payload can not be empty")
+	}
+
+	var updatedTask Tasks
+	err := s.withTx(ctx, "ModifyTask", func(tx sqlConn) error {
+		previousTask, err := findSQLTask(ctx, tx, "ModifyTask", id, false)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != nil && *expectedVersion != previousTask.Version {
+			return versionMismatchError("ModifyTask", *expectedVersion, previousTask.Version)
+		}
+
+		updatedTask = *previousTask
+		payload.applyTo(&updatedTask)
+		updatedTask.UpdatedAt = time.Now()
+		updatedTask.Version++
+
+		return saveSQLTask(ctx, tx, ActionUpdated, previousTask, &updatedTask)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updatedTask, nil
+}
+
+// ReplaceTask overwrites every editable field of a task with the payload.
+// When expectedVersion is not nil the task must still be at that version.
+func (s *SQLStore) ReplaceTask(ctx context.Context, id string, payload *CreateNewTask, expectedVersion *int64) (*Tasks, error) {
+	return s.ModifyTask(ctx, id, payload.asUpdate(), expectedVersion)
+}
+
+// PatchTask persists the patch that build computes from the current task. The
+// task is read and written in the same transaction, so it can not change in between.
+func (s *SQLStore) PatchTask(ctx context.Context, id string, expectedVersion *int64, build func(*Tasks) (*TaskPatch, error)) (*Tasks, error) {
+	var result *Tasks
+	err := s.withTx(ctx, "PatchTask", func(tx sqlConn) error {
+		current, err := findSQLTask(ctx, tx, "PatchTask", id, false)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != nil && *expectedVersion != current.Version {
+			return versionMismatchError("PatchTask", *expectedVersion, current.Version)
+		}
+
+		patch, err := build(current)
+		if err != nil {
+			return err
+		}
+
+		updatedTask := *current
+		patch.applyTo(&updatedTask)
+		if len(DiffTasks(current, &updatedTask)) == 0 {
+			result = current
+			return nil
+		}
+
+		updatedTask.UpdatedAt = time.Now()
+		updatedTask.Version++
+		result = &updatedTask
+
+		return saveSQLTask(ctx, tx, ActionUpdated, current, &updatedTask)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DeleteTask moves a task to the trash by setting its deleted_at marker.
+// When expectedVersion is not nil the task must still be at that version.
+func (s *SQLStore) DeleteTask(ctx context.Context, id string, expectedVersion *int64) (bson.ObjectID, error) {
+	var objID bson.ObjectID
+	err := s.withTx(ctx, "DeleteTask", func(tx sqlConn) error {
+		task, err := findSQLTask(ctx, tx, "DeleteTask", id, false)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != nil && *expectedVersion != task.Version {
+			return versionMismatchError("DeleteTask", *expectedVersion, task.Version)
+		}
+
+		now := time.Now()
+		trashedTask := *task
+		trashedTask.DeletedAt = &now
+		trashedTask.Version++
+		objID = task.ID
+
+		if err := updateSQLTask(ctx, tx, &trashedTask); err != nil {
+			return err
+		}
+		// Only the trash marker changed, so the history does not need the full document
+		return recordSQLHistory(ctx, tx, task.ID, ActionDeleted, &Tasks{}, &Tasks{DeletedAt: &now})
+	})
+	if err != nil {
+		return bson.NilObjectID, err
+	}
+
+	return objID, nil
+}
+
+// RestoreTask takes a task out of the trash
+func (s *SQLStore) RestoreTask(ctx context.Context, id string) (*Tasks, error) {
+	var restoredTask Tasks
+	err := s.withTx(ctx, "RestoreTask", func(tx sqlConn) error {
+		trashedTask, err := findSQLTask(ctx, tx, "RestoreTask", id, true)
+		if err != nil {
+			return err
+		}
+
+		restoredTask = *trashedTask
+		restoredTask.DeletedAt = nil
+		restoredTask.Version++
+
+		return saveSQLTask(ctx, tx, ActionRestored, trashedTask, &restoredTask)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &restoredTask, nil
+}
+
+// PurgeTask permanently removes a task, whether it is in the trash or not
+func (s *SQLStore) PurgeTask(ctx context.Context, id string) (bson.ObjectID, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return bson.NilObjectID, invalidIDError("PurgeTask", id, err)
+	}
+
+	err = s.withTx(ctx, "PurgeTask", func(tx sqlConn) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ?", objID.Hex())
+		if err != nil {
+			return err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return notFoundError("PurgeTask")
+		}
+
+		return recordSQLHistory(ctx, tx, objID, ActionPurged, nil, nil)
+	})
+	if err != nil {
+		return bson.NilObjectID, err
+	}
+
+	return objID, nil
+}
+
+// PurgeTrash permanently removes every task that was trashed before the cutoff.
+// Each purge is recorded in the history in the same transaction.
+func (s *SQLStore) PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error) {
+	var purged int64
+	err := s.withTx(ctx, "PurgeTrash", func(tx sqlConn) error {
+		rows, err := tx.QueryContext(ctx, "SELECT id FROM tasks WHERE deleted_at IS NOT NULL AND deleted_at < ?"+tx.forUpdate(), sqlTime(cutoff))
+		if err != nil {
+			return err
+		}
+
+		var ids []bson.ObjectID
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			objID, err := bson.ObjectIDFromHex(id)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, objID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			result, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ? AND deleted_at < ?", id.Hex(), sqlTime(cutoff))
+			if err != nil {
+				return err
+			}
+			deleted, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if deleted == 0 {
+				continue
+			}
+
+			if err := recordSQLHistory(ctx, tx, id, ActionPurged, nil, nil); err != nil {
+				return err
+			}
+			purged++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// BulkWrite runs a batch of operations in a single transaction, with the same
+// rules as the Mongo repository. The targets are read in the transaction, so
+// every planned write applies and atomic batches need no rollback.
+func (s *SQLStore) BulkWrite(ctx context.Context, ops []BulkOperation, opts BulkOptions) ([]BulkItemResult, error) {
+	var results []BulkItemResult
+	err := s.withTx(ctx, "BulkWrite", func(tx sqlConn) error {
+		ids := make([]any, 0, len(ops))
+		for _, op := range ops {
+			if objID, err := bson.ObjectIDFromHex(op.ID); err == nil {
+				ids = append(ids, objID.Hex())
+			}
+		}
+
+		current, err := findSQLTasksByID(ctx, tx, ids)
+		if err != nil {
+			return err
+		}
+
+		var writes []bulkWrite
+		results, writes = planBulkBatch(ops, opts, current, time.Now())
+		for _, write := range writes {
+			if err := applySQLBulkWrite(ctx, tx, ops[write.index].Kind, write); err != nil {
+				return err
+			}
+		}
+
+		results = settleBulkBatch(ops, opts, results, writes, nil, func(BulkOpKind, bulkWrite) {})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// PreviewByFilter counts the live tasks matching the filter and returns a few of their ids
+func (s *SQLStore) PreviewByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error) {
+	where, args := filter.toSQL()
+
+	result := &FilterWriteResult{DryRun: true, SampleIDs: make([]string, 0, filterSampleSize)}
+	if err := s.conn().QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks WHERE "+where, args...).Scan(&result.Matched); err != nil {
+		return nil, s.classify("PreviewByFilter", err)
+	}
+
+	rows, err := s.conn().QueryContext(ctx, "SELECT id FROM tasks WHERE "+where+" ORDER BY id LIMIT ?", append(args, filterSampleSize)...)
+	if err != nil {
+		return nil, s.classify("PreviewByFilter", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		result.SampleIDs = append(result.SampleIDs, id)
+	}
+
+	return result, s.classify("PreviewByFilter", rows.Err())
+}
+
+// UpdateByFilter applies the payload to every live task matching the filter
+func (s *SQLStore) UpdateByFilter(ctx context.Context, filter TaskFilter, payload *UpdateTask) (*FilterWriteResult, error) {
+	if payload.IsEmpty() {
+		return nil, validationError("UpdateByFilter", "payload can not be empty")
+	}
+
+	return s.writeByFilter(ctx, "UpdateByFilter", filter, BulkOperation{Kind: BulkUpdate, Update: payload})
+}
+
+// DeleteByFilter moves every live task matching the filter to the trash
+func (s *SQLStore) DeleteByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error) {
+	return s.writeByFilter(ctx, "DeleteByFilter", filter, BulkOperation{Kind: BulkDelete})
+}
+
+// ListByTask retrieves one page of the history of a task, newest entries first
+func (s *SQLStore) ListByTask(ctx context.Context, id string, query *HistoryQuery) (*HistoryPage, error) {
+	taskID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError("ListHistory", id, err)
+	}
+
+	var total int64
+	if err := s.conn().QueryRowContext(ctx, "SELECT COUNT(*) FROM task_history WHERE task_id = ?", taskID.Hex()).Scan(&total); err != nil {
+		return nil, s.classify("ListHistory", err)
+	}
+
+	rows, err := s.conn().QueryContext(ctx,
+		`SELECT id, action, changes, request_id, actor, timestamp FROM task_history
+		WHERE task_id = ? ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?`,
+		taskID.Hex(), query.Limit, query.Offset)
+	if err != nil {
+		return nil, s.classify("ListHistory", err)
+	}
+	defer rows.Close()
+
+	entries := make([]TaskHistoryEntry, 0)
+	for rows.Next() {
+		entry := TaskHistoryEntry{TaskID: taskID}
+		var entryID, changes string
+		var timestamp int64
+
+		if err := rows.Scan(&entryID, &entry.Action, &changes, &entry.RequestID, &entry.Actor, &timestamp); err != nil {
+			return nil, err
+		}
+		if entry.ID, err = bson.ObjectIDFromHex(entryID); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		entry.Timestamp = fromSQLTime(timestamp)
+
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, s.classify("ListHistory", err)
+	}
+
+	return &HistoryPage{
+		Items:   entries,
+		Total:   total,
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+		HasMore: query.Offset+int64(len(entries)) < total,
+	}, nil
+}
+
+// writeByFilter applies template to every live task matching the filter in a
+// single transaction, so every matching task is changed
+func (s *SQLStore) writeByFilter(ctx context.Context, op string, filter TaskFilter, template BulkOperation) (*FilterWriteResult, error) {
+	where, args := filter.toSQL()
+	result := &FilterWriteResult{}
+
+	err := s.withTx(ctx, op, func(tx sqlConn) error {
+		tasks, err := querySQLTasks(ctx, tx, "SELECT "+taskColumns+" FROM tasks WHERE "+where+" ORDER BY id"+tx.forUpdate(), args...)
+		if err != nil {
+			return err
+		}
+
+		current := make(map[bson.ObjectID]*Tasks, len(tasks))
+		for _, task := range tasks {
+			current[task.ID] = task
+		}
+
+		now := time.Now()
+		result.Matched = int64(len(tasks))
+		for _, task := range tasks {
+			item := template
+			item.ID = task.ID.Hex()
+
+			write, itemErr := planBulkWrite(item, current, now)
+			if itemErr != nil {
+				result.Failed++
+				continue
+			}
+			if err := applySQLBulkWrite(ctx, tx, template.Kind, *write); err != nil {
+				return err
+			}
+			result.Affected++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// withTx runs fn in a transaction that is committed when fn succeeds
+func (s *SQLStore) withTx(ctx context.Context, op string, fn func(tx sqlConn) error) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return s.classify(op, err)
+	}
+
+	if err := fn(sqlConn{q: tx, dialect: s.dialect, tx: true}); err != nil {
+		_ = tx.Rollback()
+		return s.classify(op, err)
+	}
+
+	return s.classify(op, tx.Commit())
+}
+
+func (s *SQLStore) conn() sqlConn {
+	return sqlConn{q: s.DB, dialect: s.dialect}
+}
+
+func (s *SQLStore) classify(op string, err error) error {
+	return classifySQLError(s.dialect, op, err)
+}
+
+// classifySQLError turns a driver error into a RepositoryError when it maps to
+// a known kind. Unrecognised errors are returned untouched and treated as internal.
+func classifySQLError(dialect *SQLDialect, op string, err error) error {
+	var repoErr *RepositoryError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &repoErr):
+		return err
+	case errors.Is(err, sql.ErrNoRows):
+		return &RepositoryError{Kind: KindNotFound, Op: op, Detail: "task not found", Err: err}
+	case errors.Is(err, sql.ErrConnDone), errors.Is(err, context.DeadlineExceeded):
+		return &RepositoryError{Kind: KindUnavailable, Op: op, Detail: "database is unavailable", Err: err}
+	}
+
+	switch dialect.classify(err) {
+	case KindConflict:
+		return &RepositoryError{Kind: KindConflict, Op: op, Detail: "task already exists", Err: err}
+	case KindUnavailable:
+		return &RepositoryError{Kind: KindUnavailable, Op: op, Detail: "database is unavailable", Err: err}
+	default:
+		return err
+	}
+}
+
+// findSQLTask reads a live task, or a trashed one when trashed is set
+func findSQLTask(ctx context.Context, c sqlConn, op, id string, trashed bool) (*Tasks, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError(op, id, err)
+	}
+
+	condition := "deleted_at IS NULL"
+	if trashed {
+		condition = "deleted_at IS NOT NULL"
+	}
+
+	row := c.QueryRowContext(ctx, "SELECT "+taskColumns+" FROM tasks WHERE id = ? AND "+condition+c.forUpdate(), objID.Hex())
+	task, err := scanSQLTask(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFoundError(op)
+	}
+
+	return task, err
+}
+
+// findSQLTasksByID reads the live tasks among ids
+func findSQLTasksByID(ctx context.Context, c sqlConn, ids []any) (map[bson.ObjectID]*Tasks, error) {
+	current := make(map[bson.ObjectID]*Tasks, len(ids))
+	if len(ids) == 0 {
+		return current, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	tasks, err := querySQLTasks(ctx, c, "SELECT "+taskColumns+" FROM tasks WHERE deleted_at IS NULL AND id IN ("+placeholders+")"+c.forUpdate(), ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, task := range tasks {
+		current[task.ID] = task
+	}
+
+	return current, nil
+}
+
+func querySQLTasks(ctx context.Context, c sqlConn, query string, args ...any) ([]*Tasks, error) {
+	rows, err := c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*Tasks, 0)
+	for rows.Next() {
+		task, err := scanSQLTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+func scanSQLTask(row interface{ Scan(dest ...any) error }) (*Tasks, error) {
+	var task Tasks
+	var id string
+	var timestamp, createdAt, updatedAt int64
+	var deletedAt sql.NullInt64
+
+	if err := row.Scan(&id, &task.Title, &task.Completed, &timestamp, &createdAt, &updatedAt, &deletedAt, &task.Version); err != nil {
+		return nil, err
+	}
+
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	task.ID = objID
+	task.Timestamp = fromSQLTime(timestamp)
+	task.CreatedAt = fromSQLTime(createdAt)
+	task.UpdatedAt = fromSQLTime(updatedAt)
+	if deletedAt.Valid {
+		deleted := fromSQLTime(deletedAt.Int64)
+		task.DeletedAt = &deleted
+	}
+
+	return &task, nil
+}
+
+func insertSQLTask(ctx context.Context, c sqlConn, task *Tasks) error {
+	_, err := c.ExecContext(ctx,
+		"INSERT INTO tasks ("+taskColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		task.ID.Hex(), task.Title, task.Completed, sqlTime(task.Timestamp),
+		sqlTime(task.CreatedAt), sqlTime(task.UpdatedAt), sqlNullTime(task.DeletedAt), task.Version)
+
+	return err
+}
+
+func updateSQLTask(ctx context.Context, c sqlConn, task *Tasks) error {
+	_, err := c.ExecContext(ctx,
+		"UPDATE tasks SET title = ?, completed = ?, timestamp = ?, updated_at = ?, deleted_at = ?, version = ? WHERE id = ?",
+		task.Title, task.Completed, sqlTime(task.Timestamp), sqlTime(task.UpdatedAt),
+		sqlNullTime(task.DeletedAt), task.Version, task.ID.Hex())
+
+	return err
+}
+
+// saveSQLTask writes the new state of a task along with its history entry
+func saveSQLTask(ctx context.Context, c sqlConn, action HistoryAction, before, after *Tasks) error {
+	if err := updateSQLTask(ctx, c, after); err != nil {
+		return err
+	}
+
+	return recordSQLHistory(ctx, c, after.ID, action, before, after)
+}
+
+func applySQLBulkWrite(ctx context.Context, c sqlConn, kind BulkOpKind, write bulkWrite) error {
+	if kind == BulkCreate {
+		if err := insertSQLTask(ctx, c, write.after); err != nil {
+			return err
+		}
+		return recordSQLHistory(ctx, c, write.after.ID, ActionCreated, nil, write.after)
+	}
+
+	return saveSQLTask(ctx, c, bulkHistoryAction(kind), write.before, write.after)
+}
+
+func recordSQLHistory(ctx context.Context, c sqlConn, taskID bson.ObjectID, action HistoryAction, before, after *Tasks) error {
+	entry := newHistoryEntry(ctx, taskID, action, DiffTasks(before, after))
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ExecContext(ctx,
+		"INSERT INTO task_history (id, task_id, action, changes, request_id, actor, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		bson.NewObjectID().Hex(), taskID.Hex(), string(action), string(changes), entry.RequestID, entry.Actor, sqlTime(entry.Timestamp))
+
+	return err
+}
+
+// sqlTime stores times with millisecond precision, like Mongo does
+func sqlTime(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func sqlNullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return sqlTime(*t)
+}
+
+func fromSQLTime(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLite runs the SQL store on an embedded SQLite database, so the service needs no database server
+var SQLite = &SQLDialect{
+	Name: "SQLite",
+	Open: openSQLite,
+	migrations: []string{
+		`CREATE TABLE tasks (
+			id         TEXT PRIMARY KEY,
+			title      TEXT NOT NULL,
+			completed  INTEGER NOT NULL,
+			timestamp  INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			deleted_at INTEGER,
+			version    INTEGER NOT NULL
+		);
+		CREATE INDEX tasks_deleted_at ON tasks (deleted_at);
+		CREATE TABLE task_history (
+			id         TEXT PRIMARY KEY,
+			task_id    TEXT NOT NULL,
+			action     TEXT NOT NULL,
+			changes    TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			actor      TEXT NOT NULL,
+			timestamp  INTEGER NOT NULL
+		);
+		CREATE INDEX task_history_task_id ON task_history (task_id, timestamp);`,
+		`CREATE TABLE idempotency_keys (
+			idempotency_key TEXT PRIMARY KEY,
+			fingerprint     TEXT NOT NULL,
+			completed       INTEGER NOT NULL,
+			status          INTEGER NOT NULL,
+			headers         TEXT NOT NULL,
+			body            BLOB,
+			created_at      INTEGER NOT NULL
+		);`,
+		`CREATE TABLE api_keys (
+			id           TEXT PRIMARY KEY,
+			name         TEXT NOT NULL,
+			prefix       TEXT NOT NULL,
+			hash         TEXT NOT NULL UNIQUE,
+			scopes       TEXT NOT NULL,
+			created_at   INTEGER NOT NULL,
+			expires_at   INTEGER,
+			last_used_at INTEGER,
+			revoked_at   INTEGER
+		);`,
+		`ALTER TABLE idempotency_keys ADD COLUMN reserved_until INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE idempotency_keys ADD COLUMN token TEXT NOT NULL DEFAULT '';`,
+	},
+	classify: classifySQLiteError,
+}
+
+// openSQLite opens the SQLite database at path, creating it when missing.
+// SQLite allows a single writer, so the pool is limited to one connection and
+// transactions never have to wait on each other's locks.
+func openSQLite(path string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(1)
+
+	return conn, nil
+}
+
+func classifySQLiteError(err error) ErrorKind {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return ""
+	}
+
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_CONSTRAINT:
+		return KindConflict
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return KindUnavailable
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TaskStore persists tasks. The service layer only depends on this interface,
+// so the storage can be swapped or faked in tests.
+type TaskStore interface {
+	CreateTodo(ctx context.Context, payload *CreateNewTask) (*Tasks, error)
+	GetAllTasks(ctx context.Context, query *TaskListQuery) (*TaskPage, error)
+	GetTaskById(ctx context.Context, id string) (*Tasks, error)
+	ModifyTask(ctx context.Context, id string, payload *UpdateTask, expectedVersion *int64) (*Tasks, error)
+	ReplaceTask(ctx context.Context, id string, payload *CreateNewTask, expectedVersion *int64) (*Tasks, error)
+	PatchTask(ctx context.Context, id string, expectedVersion *int64, build func(*Tasks) (*TaskPatch, error)) (*Tasks, error)
+	DeleteTask(ctx context.Context, id string, expectedVersion *int64) (bson.ObjectID, error)
+	RestoreTask(ctx context.Context, id string) (*Tasks, error)
+	PurgeTask(ctx context.Context, id string) (bson.ObjectID, error)
+	PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error)
+	BulkWrite(ctx context.Context, ops []BulkOperation, opts BulkOptions) ([]BulkItemResult, error)
+	PreviewByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error)
+	UpdateByFilter(ctx context.Context, filter TaskFilter, payload *UpdateTask) (*FilterWriteResult, error)
+	DeleteByFilter(ctx context.Context, filter TaskFilter) (*FilterWriteResult, error)
+}
+
+// HistoryStore reads the change history of tasks
+type HistoryStore interface {
+	ListByTask(ctx context.Context, id string, query *HistoryQuery) (*HistoryPage, error)
+}
+
+// IdempotencyStore keeps the outcome of requests sent with an Idempotency-Key
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key, fingerprint string) (*IdempotencyRecord, string, error)
+	Complete(ctx context.Context, key, token string, status int, headers map[string]string, body []byte) error
+	Release(ctx context.Context, key, token string) error
+}
+
+// APIKeyStore keeps the API keys allowed to call the service
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	FindAPIKeyByHash(ctx context.Context, hash string) (*APIKey, error)
+	ReplaceAPIKeySecret(ctx context.Context, id, prefix, hash string) (*APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string, at time.Time) (*APIKey, error)
+	TouchAPIKey(ctx context.Context, id bson.ObjectID, at time.Time) error
+}
+
+var (
+	_ TaskStore        = (*TaskRepository)(nil)
+	_ HistoryStore     = (*HistoryRepository)(nil)
+	_ IdempotencyStore = (*IdempotencyRepository)(nil)
+	_ IdempotencyStore = (*MemoryIdempotencyStore)(nil)
+	_ IdempotencyStore = (*SQLIdempotencyStore)(nil)
+	_ APIKeyStore      = (*APIKeyRepository)(nil)
+	_ APIKeyStore      = (*MemoryAPIKeyStore)(nil)
+	_ APIKeyStore      = (*SQLAPIKeyStore)(nil)
+)
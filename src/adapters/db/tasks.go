@@ -6,16 +6,16 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/gsn_manager_service/src/adapters"
-
+	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
-var TaskRepo *TaskRepository
+// Number of times a patch is applied again when the task changes concurrently
+const maxPatchAttempts = 3
 
-func NewTaskRepository(client *mongo.Client, dbName, collectionName string) *TaskRepository {
+func NewTaskRepository(client *mongo.Client, dbName, collectionName string, logger zerolog.Logger) *TaskRepository {
 	database := client.Database(dbName)
 	collection := database.Collection(collectionName)
 
@@ -23,10 +23,9 @@ func NewTaskRepository(client *mongo.Client, dbName, collectionName string) *Tas
 		Client:     client,
 		Database:   database,
 		Collection: collection,
+		Logger:     logger,
 	}
 
-	TaskRepo = repository
-
 	return repository
 }
 
@@ -40,23 +39,49 @@ func (r *TaskRepository) CreateTodo(ctx context.Context, payload *CreateNewTask)
 		Completed: payload.Completed,
 		CreatedAt: now,
 		UpdatedAt: now,
+		Version:   1,
 	}
 
 	result, err := r.Collection.InsertOne(ctx, newTask)
 	if err != nil {
-		adapters.Logger.Error().Msg(fmt.Sprintf("Error creating new task => %v", err))
-		return nil, err
+		r.Logger.Error().Ctx(ctx).Msg(fmt.Sprintf("Error creating new task => %v", err))
+		return nil, classifyError("CreateTodo", err)
 	}
 
 	newTask.ID = result.InsertedID.(bson.ObjectID)
+	if err := r.recordHistory(ctx, newTask.ID, ActionCreated, nil, newTask); err != nil {
+		return nil, err
+	}
+
 	return newTask, nil
 }
 
-// GetTodos retrieves all todos from the collection
-func (r *TaskRepository) GetAllTasks(ctx context.Context) ([]Tasks, error) {
-	cursor, err := r.Collection.Find(ctx, bson.M{})
+// GetAllTasks retrieves a single page of tasks matching the query.
+// One extra task is fetched to find out whether another page follows.
+func (r *TaskRepository) GetAllTasks(ctx context.Context, query *TaskListQuery) (*TaskPage, error) {
+	filter := query.Filter.toBson()
+
+	total, err := r.Collection.CountDocuments(ctx, filter)
 	if err != nil {
-		return nil, err
+		return nil, classifyError("GetAllTasks", err)
+	}
+
+	sort := query.Sort
+	opts := options.Find().SetLimit(query.Limit + 1)
+
+	if query.Cursor != nil {
+		if query.Cursor.Backward {
+			sort = sort.reversed()
+		}
+		filter = bson.M{"$and": bson.A{filter, query.Cursor.toBson(query.Sort)}}
+	} else {
+		opts.SetSkip(query.Offset)
+	}
+	opts.SetSort(sort.toBson())
+
+	cursor, err := r.Collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, classifyError("GetAllTasks", err)
 	}
 	defer cursor.Close(ctx)
 
@@ -69,82 +94,273 @@ func (r *TaskRepository) GetAllTasks(ctx context.Context) ([]Tasks, error) {
 
 		tasks = append(tasks, task)
 	}
+	if err := cursor.Err(); err != nil {
+		return nil, classifyError("GetAllTasks", err)
+	}
 
-	return tasks, nil
+	return newTaskPage(query, tasks, total), nil
 }
 
 // GetTodoByID retrieves a single todo by its ObjectID
 func (r *TaskRepository) GetTaskById(ctx context.Context, id string) (*Tasks, error) {
 	objID, err := bson.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, invalidIDError("GetTaskById", id, err)
 	}
 
 	var task Tasks
-	err = r.Collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&task)
+	err = r.Collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&task)
 	if err != nil {
-		return nil, err
+		return nil, classifyError("GetTaskById", err)
 	}
 
 	return &task, nil
 }
 
-// UpdateTodo updates the title or completed status of a todo by its ID
-func (r *TaskRepository) ModifyTask(ctx context.Context, id string, payload *UpdateTask) (*Tasks, error) {
+// ModifyTask updates the fields set in the payload. When expectedVersion is not nil
+// the update only applies if the task is still at that version.
+func (r *TaskRepository) ModifyTask(ctx context.Context, id string, payload *UpdateTask, expectedVersion *int64) (*Tasks, error) {
 	if payload.IsEmpty() {
-		return nil, errors.New("payload can not be empty")
+		return nil, validationError("ModifyTask", "payload can not be empty")
 	}
 
 	objID, err := bson.ObjectIDFromHex(id)
 	if err != nil {
+		return nil, invalidIDError("ModifyTask", id, err)
+	}
+
+	now := time.Now()
+	updateDoc := bson.M{"$set": payload.toSet(now), "$inc": bson.M{"version": 1}}
+
+	filter := bson.M{"_id": objID, "deleted_at": nil}
+	withVersion(filter, expectedVersion)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	// The previous document is needed for the history, the updated one is derived from it
+	var previousTask Tasks
+	err = r.Collection.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(&previousTask)
+	if err != nil {
+		return nil, r.conditionalError(ctx, "ModifyTask", objID, expectedVersion, err)
+	}
+
+	updatedTask := previousTask
+	payload.applyTo(&updatedTask)
+	updatedTask.UpdatedAt = now
+	updatedTask.Version++
+
+	if err := r.recordHistory(ctx, objID, ActionUpdated, &previousTask, &updatedTask); err != nil {
 		return nil, err
 	}
 
-	set := bson.M{
-		"updated_at": time.Now(),
+	return &updatedTask, nil
+}
+
+// ReplaceTask overwrites every editable field of a task with the payload.
+// When expectedVersion is not nil the task must still be at that version.
+func (r *TaskRepository) ReplaceTask(ctx context.Context, id string, payload *CreateNewTask, expectedVersion *int64) (*Tasks, error) {
+	return r.ModifyTask(ctx, id, payload.asUpdate(), expectedVersion)
+}
+
+// PatchTask persists the patch that build computes from the current task, as
+// long as the task did not change in between. Without an expected version a
+// concurrent change starts the patch over against the new task, at most
+// maxPatchAttempts times. With one, any mismatch is a version mismatch.
+func (r *TaskRepository) PatchTask(ctx context.Context, id string, expectedVersion *int64, build func(*Tasks) (*TaskPatch, error)) (*Tasks, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError("PatchTask", id, err)
 	}
 
-	if payload.Title != nil {
-		set["title"] = *payload.Title
+	for range maxPatchAttempts {
+		var current Tasks
+		err := r.Collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&current)
+		if err != nil {
+			return nil, classifyError("PatchTask", err)
+		}
+		if expectedVersion != nil && *expectedVersion != current.Version {
+			return nil, versionMismatchError("PatchTask", *expectedVersion, current.Version)
+		}
+
+		patch, err := build(&current)
+		if err != nil {
+			return nil, err
+		}
+
+		updatedTask := current
+		patch.applyTo(&updatedTask)
+		if len(DiffTasks(&current, &updatedTask)) == 0 {
+			return &current, nil
+		}
+
+		now := time.Now()
+		updatedTask.UpdatedAt = now
+		updatedTask.Version++
+
+		filter := bson.M{"_id": objID, "deleted_at": nil}
+		withVersion(filter, &current.Version)
+
+		result, err := r.Collection.UpdateOne(ctx, filter, patch.toUpdate(now))
+		if err != nil {
+			return nil, classifyError("PatchTask", err)
+		}
+
+		if result.MatchedCount > 0 {
+			if err := r.recordHistory(ctx, objID, ActionUpdated, &current, &updatedTask); err != nil {
+				return nil, err
+			}
+			return &updatedTask, nil
+		}
+		if expectedVersion != nil {
+			return nil, r.conditionalError(ctx, "PatchTask", objID, expectedVersion, mongo.ErrNoDocuments)
+		}
 	}
-	if payload.Completed != nil {
-		set["completed"] = *payload.Completed
+
+	return nil, &RepositoryError{Kind: KindConflict, Op: "PatchTask", Detail: "task kept changing while the patch was applied"}
+}
+
+// DeleteTask moves a task to the trash by setting its deleted_at marker.
+// When expectedVersion is not nil the task must still be at that version.
+func (r *TaskRepository) DeleteTask(ctx context.Context, id string, expectedVersion *int64) (bson.ObjectID, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return bson.NilObjectID, invalidIDError("DeleteTask", id, err)
 	}
-	if payload.Timestamp != nil {
-		set["timestamp"] = *payload.Timestamp
+
+	now := time.Now()
+	filter := bson.M{"_id": objID, "deleted_at": nil}
+	withVersion(filter, expectedVersion)
+	update := bson.M{"$set": bson.M{"deleted_at": now}, "$inc": bson.M{"version": 1}}
+
+	result, err := r.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return bson.NilObjectID, classifyError("DeleteTask", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return bson.NilObjectID, r.conditionalError(ctx, "DeleteTask", objID, expectedVersion, mongo.ErrNoDocuments)
 	}
 
-	updateDoc := bson.M{"$set": set}
+	// Only the trash marker changed, so the history does not need the full document
+	if err := r.recordHistory(ctx, objID, ActionDeleted, &Tasks{}, &Tasks{DeletedAt: &now}); err != nil {
+		return bson.NilObjectID, err
+	}
+
+	return objID, nil
+}
+
+// RestoreTask takes a task out of the trash
+func (r *TaskRepository) RestoreTask(ctx context.Context, id string) (*Tasks, error) {
+	objID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, invalidIDError("RestoreTask", id, err)
+	}
 
-	filter := bson.M{"_id": objID}
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"_id": objID, "deleted_at": bson.M{"$ne": nil}}
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
 
-	var updatedTask Tasks
-	err = r.Collection.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(&updatedTask)
+	var trashedTask Tasks
+	err = r.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&trashedTask)
 	if err != nil {
+		return nil, classifyError("RestoreTask", err)
+	}
+
+	restoredTask := trashedTask
+	restoredTask.DeletedAt = nil
+	restoredTask.Version++
+
+	if err := r.recordHistory(ctx, objID, ActionRestored, &trashedTask, &restoredTask); err != nil {
 		return nil, err
 	}
 
-	return &updatedTask, nil
+	return &restoredTask, nil
 }
 
-// DeleteTodo removes a todo by its ID
-func (r *TaskRepository) DeleteTask(ctx context.Context, id string) (bson.ObjectID, error) {
+// PurgeTask permanently removes a task, whether it is in the trash or not
+func (r *TaskRepository) PurgeTask(ctx context.Context, id string) (bson.ObjectID, error) {
 	objID, err := bson.ObjectIDFromHex(id)
 	if err != nil {
-		return bson.NilObjectID, err
+		return bson.NilObjectID, invalidIDError("PurgeTask", id, err)
 	}
 
-	filter := bson.M{"_id": objID}
-
-	result, err := r.Collection.DeleteOne(ctx, filter)
+	result, err := r.Collection.DeleteOne(ctx, bson.M{"_id": objID})
 	if err != nil {
-		return bson.NilObjectID, err
+		return bson.NilObjectID, classifyError("PurgeTask", err)
 	}
 
 	if result.DeletedCount == 0 {
-		return bson.NilObjectID, mongo.ErrNoDocuments
+		return bson.NilObjectID, classifyError("PurgeTask", mongo.ErrNoDocuments)
+	}
+
+	if err := r.recordHistory(ctx, objID, ActionPurged, nil, nil); err != nil {
+		return bson.NilObjectID, err
 	}
 
 	return objID, nil
 }
+
+// PurgeTrash permanently removes every task that was trashed before the cutoff.
+// Tasks are removed one by one, like PurgeTask, so each purge gets its history
+// entry and a task restored in between is left alone.
+func (r *TaskRepository) PurgeTrash(ctx context.Context, cutoff time.Time) (int64, error) {
+	filter := bson.M{"deleted_at": bson.M{"$lt": cutoff}}
+	cursor, err := r.Collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, classifyError("PurgeTrash", err)
+	}
+
+	var trashed []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &trashed); err != nil {
+		return 0, classifyError("PurgeTrash", err)
+	}
+
+	var purged int64
+	for _, task := range trashed {
+		result, err := r.Collection.DeleteOne(ctx, bson.M{"_id": task.ID, "deleted_at": bson.M{"$lt": cutoff}})
+		if err != nil {
+			return purged, classifyError("PurgeTrash", err)
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+
+		purged++
+		if err := r.recordHistory(ctx, task.ID, ActionPurged, nil, nil); err != nil {
+			return purged, err
+		}
+	}
+
+	return purged, nil
+}
+
+// withVersion restricts filter to the expected version. Tasks written before
+// versioning have no version field and are treated as version 0.
+func withVersion(filter bson.M, expectedVersion *int64) {
+	if expectedVersion == nil {
+		return
+	}
+
+	if *expectedVersion == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["version"] = *expectedVersion
+	}
+}
+
+// conditionalError tells a missing task apart from a version mismatch after a
+// conditional write matched nothing
+func (r *TaskRepository) conditionalError(ctx context.Context, op string, objID bson.ObjectID, expectedVersion *int64, err error) error {
+	if expectedVersion == nil || !errors.Is(err, mongo.ErrNoDocuments) {
+		return classifyError(op, err)
+	}
+
+	var current Tasks
+	findErr := r.Collection.FindOne(ctx, bson.M{"_id": objID, "deleted_at": nil}).Decode(&current)
+	if findErr != nil {
+		return classifyError(op, findErr)
+	}
+
+	return versionMismatchError(op, *expectedVersion, current.Version)
+}
@@ -0,0 +1,536 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	DefaultTaskListLimit = 20
+	MaxTaskListLimit     = 100
+	maxTitleFilterLength = 100
+)
+
+// ? JSON name of every sortable Tasks field mapped to its bson name
+var taskSortFields = map[string]string{
+	"id":         "_id",
+	"title":      "title",
+	"completed":  "completed",
+	"timestamp":  "timestamp",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// ? Query parameters narrowing down tasks, shared by listings and writes by filter
+var taskFilterParams = map[string]bool{
+	"completed":      true,
+	"title":          true,
+	"timestamp_from": true,
+	"timestamp_to":   true,
+	"created_from":   true,
+	"created_to":     true,
+	"updated_from":   true,
+	"updated_to":     true,
+}
+
+// ? Query parameters accepted by the task listing endpoint on top of the filter
+var taskListParams = map[string]bool{
+	"sort":   true,
+	"limit":  true,
+	"offset": true,
+	"cursor": true,
+}
+
+// ? Query parameters accepted by the update and delete by filter endpoints on top of the filter
+var taskWriteParams = map[string]bool{
+	"dry_run": true,
+	"confirm": true,
+}
+
+// TaskFilter narrows down the tasks returned by a listing.
+// Ranges are inclusive on the lower bound and exclusive on the upper bound.
+// Trashed selects soft deleted tasks instead of live ones.
+type TaskFilter struct {
+	Trashed       bool
+	Completed     *bool
+	Title         string
+	TimestampFrom *time.Time
+	TimestampTo   *time.Time
+	CreatedFrom   *time.Time
+	CreatedTo     *time.Time
+	UpdatedFrom   *time.Time
+	UpdatedTo     *time.Time
+}
+
+// TaskSort orders a listing by a Tasks field, using its JSON name
+type TaskSort struct {
+	Field string
+	Desc  bool
+}
+
+// TaskListQuery selects a page either by offset or, when Cursor is set, by keyset.
+// CursorToken holds the raw cursor until it is verified by a CursorCodec.
+type TaskListQuery struct {
+	Filter      TaskFilter
+	Sort        TaskSort
+	Limit       int64
+	Offset      int64
+	CursorToken string
+	Cursor      *PageCursor
+}
+
+// TaskWriteQuery selects the tasks changed by an update or delete by filter.
+// Confirmed is required to write when the filter is empty, since that targets every task.
+type TaskWriteQuery struct {
+	Filter    TaskFilter
+	DryRun    bool
+	Confirmed bool
+}
+
+type HistoryQuery struct {
+	Limit  int64
+	Offset int64
+}
+
+// ? One page of tasks plus the metadata needed to request the next one
+type TaskPage struct {
+	Items      []Tasks `json:"items"`
+	Total      int64   `json:"total"`
+	Limit      int64   `json:"limit"`
+	Offset     int64   `json:"offset"`
+	HasMore    bool    `json:"has_more"`
+	HasPrev    bool    `json:"has_prev"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	PrevCursor string  `json:"prev_cursor,omitempty"`
+}
+
+// QueryError reports a query parameter that could not be accepted
+type QueryError struct {
+	Param  string
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query parameter %q: %s", e.Param, e.Reason)
+}
+
+func DefaultTaskListQuery() *TaskListQuery {
+	return &TaskListQuery{
+		Sort:  TaskSort{Field: "id"},
+		Limit: DefaultTaskListLimit,
+	}
+}
+
+// ParseTaskListQuery builds a TaskListQuery from the URL query string of a listing request
+func ParseTaskListQuery(values url.Values) (*TaskListQuery, error) {
+	query := DefaultTaskListQuery()
+
+	if err := checkParams(values, taskFilterParams, taskListParams); err != nil {
+		return nil, err
+	}
+	if err := parseTaskFilter(values, &query.Filter); err != nil {
+		return nil, err
+	}
+
+	if raw := values.Get("sort"); raw != "" {
+		field, direction, _ := strings.Cut(raw, ":")
+		if _, ok := taskSortFields[field]; !ok {
+			return nil, &QueryError{Param: "sort", Reason: fmt.Sprintf("unknown field %q", field)}
+		}
+		switch strings.ToLower(direction) {
+		case "", "asc":
+			query.Sort = TaskSort{Field: field}
+		case "desc":
+			query.Sort = TaskSort{Field: field, Desc: true}
+		default:
+			return nil, &QueryError{Param: "sort", Reason: "direction must be asc or desc"}
+		}
+	}
+
+	if err := parsePage(values, &query.Limit, &query.Offset); err != nil {
+		return nil, err
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		if query.Offset > 0 {
+			return nil, &QueryError{Param: "cursor", Reason: "can not be combined with offset"}
+		}
+		query.CursorToken = raw
+	}
+
+	return query, nil
+}
+
+// ParseTaskWriteQuery builds a TaskWriteQuery from the URL query string of an
+// update or delete by filter. An empty filter is refused unless confirm=all is
+// given, except for dry runs which never write.
+func ParseTaskWriteQuery(values url.Values) (*TaskWriteQuery, error) {
+	query := &TaskWriteQuery{}
+
+	if err := checkParams(values, taskFilterParams, taskWriteParams); err != nil {
+		return nil, err
+	}
+	if err := parseTaskFilter(values, &query.Filter); err != nil {
+		return nil, err
+	}
+
+	if raw := values.Get("dry_run"); raw != "" {
+		dryRun, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, &QueryError{Param: "dry_run", Reason: "must be true or false"}
+		}
+		query.DryRun = dryRun
+	}
+
+	if values.Has("confirm") {
+		if values.Get("confirm") != "all" {
+			return nil, &QueryError{Param: "confirm", Reason: `must be "all"`}
+		}
+		query.Confirmed = true
+	}
+
+	if query.Filter.IsEmpty() && !query.Confirmed && !query.DryRun {
+		return nil, &QueryError{Param: "confirm", Reason: `must be "all" to change every task when no filter is given`}
+	}
+
+	return query, nil
+}
+
+// ParseHistoryQuery builds a HistoryQuery from the URL query string of a history request
+func ParseHistoryQuery(values url.Values) (*HistoryQuery, error) {
+	query := &HistoryQuery{Limit: DefaultTaskListLimit}
+
+	if err := checkParams(values, map[string]bool{"limit": true, "offset": true}); err != nil {
+		return nil, err
+	}
+
+	if err := parsePage(values, &query.Limit, &query.Offset); err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
+
+// checkParams rejects parameters outside of the allowed sets and repeated ones
+func checkParams(values url.Values, allowed ...map[string]bool) error {
+	for param, vals := range values {
+		if !slices.ContainsFunc(allowed, func(set map[string]bool) bool { return set[param] }) {
+			return &QueryError{Param: param, Reason: "unknown parameter"}
+		}
+		if len(vals) > 1 {
+			return &QueryError{Param: param, Reason: "must be provided only once"}
+		}
+	}
+
+	return nil
+}
+
+func parseTaskFilter(values url.Values, filter *TaskFilter) error {
+	if raw := values.Get("completed"); raw != "" {
+		completed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return &QueryError{Param: "completed", Reason: "must be true or false"}
+		}
+		filter.Completed = &completed
+	}
+
+	if raw := values.Get("title"); raw != "" {
+		if len(raw) > maxTitleFilterLength {
+			return &QueryError{Param: "title", Reason: fmt.Sprintf("must be at most %d characters long", maxTitleFilterLength)}
+		}
+		filter.Title = raw
+	}
+
+	ranges := []struct {
+		from, to   string
+		fromT, toT **time.Time
+	}{
+		{"timestamp_from", "timestamp_to", &filter.TimestampFrom, &filter.TimestampTo},
+		{"created_from", "created_to", &filter.CreatedFrom, &filter.CreatedTo},
+		{"updated_from", "updated_to", &filter.UpdatedFrom, &filter.UpdatedTo},
+	}
+	for _, rg := range ranges {
+		from, err := parseTimeParam(values, rg.from)
+		if err != nil {
+			return err
+		}
+		to, err := parseTimeParam(values, rg.to)
+		if err != nil {
+			return err
+		}
+		if from != nil && to != nil && !from.Before(*to) {
+			return &QueryError{Param: rg.from, Reason: fmt.Sprintf("must be before %s", rg.to)}
+		}
+		*rg.fromT, *rg.toT = from, to
+	}
+
+	return nil
+}
+
+func parsePage(values url.Values, limit, offset *int64) error {
+	if raw := values.Get("limit"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 1 || parsed > MaxTaskListLimit {
+			return &QueryError{Param: "limit", Reason: fmt.Sprintf("must be an integer between 1 and %d", MaxTaskListLimit)}
+		}
+		*limit = parsed
+	}
+
+	if raw := values.Get("offset"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed < 0 {
+			return &QueryError{Param: "offset", Reason: "must be a non-negative integer"}
+		}
+		*offset = parsed
+	}
+
+	return nil
+}
+
+func parseTimeParam(values url.Values, param string) (*time.Time, error) {
+	raw := values.Get(param)
+	if raw == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, &QueryError{Param: param, Reason: "must be an RFC 3339 timestamp"}
+	}
+
+	return &t, nil
+}
+
+// IsEmpty reports whether the filter matches every live or trashed task
+func (f *TaskFilter) IsEmpty() bool {
+	return f.Completed == nil && f.Title == "" &&
+		f.TimestampFrom == nil && f.TimestampTo == nil &&
+		f.CreatedFrom == nil && f.CreatedTo == nil &&
+		f.UpdatedFrom == nil && f.UpdatedTo == nil
+}
+
+// toBson translates the filter into a MongoDB query document
+func (f *TaskFilter) toBson() bson.M {
+	filter := bson.M{"deleted_at": nil}
+	if f.Trashed {
+		filter["deleted_at"] = bson.M{"$ne": nil}
+	}
+
+	if f.Completed != nil {
+		filter["completed"] = *f.Completed
+	}
+	if f.Title != "" {
+		filter["title"] = bson.M{"$regex": regexp.QuoteMeta(f.Title), "$options": "i"}
+	}
+
+	addRange(filter, "timestamp", f.TimestampFrom, f.TimestampTo)
+	addRange(filter, "created_at", f.CreatedFrom, f.CreatedTo)
+	addRange(filter, "updated_at", f.UpdatedFrom, f.UpdatedTo)
+
+	return filter
+}
+
+func addRange(filter bson.M, field string, from, to *time.Time) {
+	if from == nil && to == nil {
+		return
+	}
+
+	bounds := bson.M{}
+	if from != nil {
+		bounds["$gte"] = *from
+	}
+	if to != nil {
+		bounds["$lt"] = *to
+	}
+	filter[field] = bounds
+}
+
+// toSQL translates the filter into a WHERE condition of the tasks table and its arguments
+func (f *TaskFilter) toSQL() (string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	if f.Trashed {
+		conditions[0] = "deleted_at IS NOT NULL"
+	}
+	var args []any
+
+	if f.Completed != nil {
+		conditions = append(conditions, "completed = ?")
+		args = append(args, *f.Completed)
+	}
+	if f.Title != "" {
+		conditions = append(conditions, `lower(title) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(f.Title))+"%")
+	}
+
+	ranges := []struct {
+		column   string
+		from, to *time.Time
+	}{
+		{"timestamp", f.TimestampFrom, f.TimestampTo},
+		{"created_at", f.CreatedFrom, f.CreatedTo},
+		{"updated_at", f.UpdatedFrom, f.UpdatedTo},
+	}
+	for _, rg := range ranges {
+		if rg.from != nil {
+			conditions = append(conditions, rg.column+" >= ?")
+			args = append(args, sqlTime(*rg.from))
+		}
+		if rg.to != nil {
+			conditions = append(conditions, rg.column+" < ?")
+			args = append(args, sqlTime(*rg.to))
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// ? Escapes the LIKE wildcards of a title filter so it matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// matches reports whether task is selected by the filter, with the same
+// semantics as the query document returned by toBson
+func (f *TaskFilter) matches(task *Tasks) bool {
+	if (task.DeletedAt != nil) != f.Trashed {
+		return false
+	}
+	if f.Completed != nil && task.Completed != *f.Completed {
+		return false
+	}
+	if f.Title != "" && !strings.Contains(strings.ToLower(task.Title), strings.ToLower(f.Title)) {
+		return false
+	}
+
+	return inRange(task.Timestamp, f.TimestampFrom, f.TimestampTo) &&
+		inRange(task.CreatedAt, f.CreatedFrom, f.CreatedTo) &&
+		inRange(task.UpdatedAt, f.UpdatedFrom, f.UpdatedTo)
+}
+
+func inRange(t time.Time, from, to *time.Time) bool {
+	return (from == nil || !t.Before(*from)) && (to == nil || t.Before(*to))
+}
+
+// reversed returns the sort with the opposite direction, used to walk backwards from a cursor
+func (s TaskSort) reversed() TaskSort {
+	return TaskSort{Field: s.Field, Desc: !s.Desc}
+}
+
+// toBson returns the sort document, using _id as a tie breaker so pages are stable
+func (s TaskSort) toBson() bson.D {
+	direction := 1
+	if s.Desc {
+		direction = -1
+	}
+
+	field := taskSortFields[s.Field]
+	if field == "" {
+		field = "_id"
+	}
+
+	sort := bson.D{{Key: field, Value: direction}}
+	if field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: direction})
+	}
+
+	return sort
+}
+
+// toSQL returns the ORDER BY clause, using id as a tie breaker so pages are stable
+func (s TaskSort) toSQL() string {
+	direction := "ASC"
+	if s.Desc {
+		direction = "DESC"
+	}
+
+	column := sqlSortColumn(s.Field)
+	if column == "id" {
+		return "id " + direction
+	}
+
+	return column + " " + direction + ", id " + direction
+}
+
+// sqlSortColumn returns the tasks table column of a sortable field
+func sqlSortColumn(field string) string {
+	column := taskSortFields[field]
+	if column == "" || column == "_id" {
+		return "id"
+	}
+
+	return column
+}
+
+// compare orders two tasks the way the sort document returned by toBson does
+func (s TaskSort) compare(a, b *Tasks) int {
+	order := compareSortValues(a.sortValue(s.Field), b.sortValue(s.Field))
+	if order == 0 {
+		order = bytes.Compare(a.ID[:], b.ID[:])
+	}
+	if s.Desc {
+		return -order
+	}
+
+	return order
+}
+
+// compareSortValues compares two values of the same sortable field, as returned by sortValue
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		b, _ := b.(string)
+		return strings.Compare(a, b)
+	case bool:
+		b, _ := b.(bool)
+		switch {
+		case a == b:
+			return 0
+		case a:
+			return 1
+		default:
+			return -1
+		}
+	case time.Time:
+		b, _ := b.(time.Time)
+		return a.Compare(b)
+	default:
+		return 0
+	}
+}
+
+// newTaskPage trims the extra task fetched by a listing and works out which
+// neighbouring pages exist, restoring the requested order for backward pages
+func newTaskPage(query *TaskListQuery, tasks []Tasks, total int64) *TaskPage {
+	hasExtra := int64(len(tasks)) > query.Limit
+	if hasExtra {
+		tasks = tasks[:query.Limit]
+	}
+
+	page := &TaskPage{
+		Items:  tasks,
+		Total:  total,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}
+
+	switch {
+	case query.Cursor == nil:
+		page.HasMore = hasExtra
+		page.HasPrev = query.Offset > 0
+	case query.Cursor.Backward:
+		slices.Reverse(page.Items)
+		page.HasMore = true
+		page.HasPrev = hasExtra
+	default:
+		page.HasMore = hasExtra
+		page.HasPrev = true
+	}
+
+	return page
+}
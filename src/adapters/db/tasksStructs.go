@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -13,9 +14,13 @@ import (
 type CollectionInterface interface {
 	InsertOne(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error)
 	Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
+	CountDocuments(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error)
 	FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
 	FindOneAndUpdate(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult
+	UpdateOne(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error)
 	DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter any, opts ...options.Lister[options.DeleteManyOptions]) (*mongo.DeleteResult, error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error)
 }
 
 // ? DB Model for Task
@@ -26,12 +31,16 @@ type Tasks struct {
 	Timestamp time.Time     `bson:"timestamp" json:"timestamp"`
 	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+	DeletedAt *time.Time    `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	Version   int64         `bson:"version" json:"version"`
 }
 
 type TaskRepository struct {
 	Client     *mongo.Client
 	Database   *mongo.Database
 	Collection CollectionInterface
+	History    *HistoryRepository
+	Logger     zerolog.Logger
 }
 
 // ? Struct for new task
@@ -41,6 +50,11 @@ type CreateNewTask struct {
 	Completed bool       `json:"completed"`
 }
 
+// asUpdate returns the update replacing every editable field of a task with the payload
+func (p *CreateNewTask) asUpdate() *UpdateTask {
+	return &UpdateTask{Title: &p.Title, Timestamp: p.Timestamp, Completed: &p.Completed}
+}
+
 // ? Struct to update task
 type UpdateTask struct {
 	Title     *string    `json:"title,omitempty" validate:"omitempty,min=3,max=100"`
@@ -51,3 +65,51 @@ type UpdateTask struct {
 func (u *UpdateTask) IsEmpty() bool {
 	return u.Title == nil && u.Timestamp == nil && u.Completed == nil
 }
+
+// applyTo copies the fields set in the payload onto task
+func (u *UpdateTask) applyTo(task *Tasks) {
+	if u.Title != nil {
+		task.Title = *u.Title
+	}
+	if u.Completed != nil {
+		task.Completed = *u.Completed
+	}
+	if u.Timestamp != nil {
+		task.Timestamp = *u.Timestamp
+	}
+}
+
+// toSet returns the $set document for the fields set in the payload
+func (u *UpdateTask) toSet(now time.Time) bson.M {
+	set := bson.M{
+		"updated_at": now,
+	}
+
+	if u.Title != nil {
+		set["title"] = *u.Title
+	}
+	if u.Completed != nil {
+		set["completed"] = *u.Completed
+	}
+	if u.Timestamp != nil {
+		set["timestamp"] = *u.Timestamp
+	}
+
+	return set
+}
+
+// TaskPatch is the outcome of applying a patch document to a task: the fields
+// to set. Every editable field is required, so a patch never removes one.
+type TaskPatch struct {
+	Set UpdateTask
+}
+
+// applyTo copies the fields set by the patch onto task
+func (p *TaskPatch) applyTo(task *Tasks) {
+	p.Set.applyTo(task)
+}
+
+// toUpdate returns the update document of the patch
+func (p *TaskPatch) toUpdate(now time.Time) bson.M {
+	return bson.M{"$set": p.Set.toSet(now), "$inc": bson.M{"version": 1}}
+}
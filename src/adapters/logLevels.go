@@ -0,0 +1,120 @@
+package adapters
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// LogLevels holds the level of every logging component, along with the
+// default level of the others. Levels can be changed while the service runs.
+type LogLevels struct {
+	mu         sync.RWMutex
+	fallback   zerolog.Level
+	components map[string]zerolog.Level
+}
+
+// ? Levels as reported by the admin endpoint
+type LogLevelsSnapshot struct {
+	Default    string            `json:"default"`
+	Components map[string]string `json:"components"`
+}
+
+func NewLogLevels(fallback zerolog.Level) *LogLevels {
+	return &LogLevels{fallback: fallback, components: map[string]zerolog.Level{}}
+}
+
+// Level returns the level of component, or the default level when it has none of its own
+func (l *LogLevels) Level(component string) zerolog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if level, ok := l.components[component]; ok {
+		return level
+	}
+
+	return l.fallback
+}
+
+// Set changes the level of component, an empty component changes the default level
+func (l *LogLevels) Set(component string, level zerolog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if component == "" {
+		l.fallback = level
+		return
+	}
+	l.components[component] = level
+}
+
+// Reset makes component follow the default level again
+func (l *LogLevels) Reset(component string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.components, component)
+}
+
+func (l *LogLevels) Snapshot() LogLevelsSnapshot {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	snapshot := LogLevelsSnapshot{Default: l.fallback.String(), Components: make(map[string]string, len(l.components))}
+	for component, level := range l.components {
+		snapshot.Components[component] = level.String()
+	}
+
+	return snapshot
+}
+
+// ParseLogLevel reads a level name such as debug or WARN
+func ParseLogLevel(name string) (zerolog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "trace":
+		return zerolog.TraceLevel, nil
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "info":
+		return zerolog.InfoLevel, nil
+	case "warn":
+		return zerolog.WarnLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	default:
+		return zerolog.NoLevel, fmt.Errorf("unknown log level %q, expected trace, debug, info, warn or error", name)
+	}
+}
+
+// ParseComponentLevels reads levels given as component=level pairs, e.g. storage=debug,server=warn
+func ParseComponentLevels(pairs []string) (map[string]zerolog.Level, error) {
+	levels := make(map[string]zerolog.Level, len(pairs))
+	for _, pair := range pairs {
+		component, name, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(component) == "" {
+			return nil, fmt.Errorf("invalid component log level %q, expected component=level", pair)
+		}
+
+		level, err := ParseLogLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+
+	return levels, nil
+}
+
+// levelHook drops the events below the current level of its component
+type levelHook struct {
+	levels    *LogLevels
+	component string
+}
+
+func (h levelHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level != zerolog.NoLevel && level < h.levels.Level(h.component) {
+		e.Discard()
+	}
+}
@@ -1,61 +1,143 @@
 package adapters
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gsn_manager_service/src/config"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-var (
-	loggerOnce sync.Once
-	Logger     zerolog.Logger
+// Log outputs selectable with LOG_OUTPUT
+const (
+	LogOutputStderr = "stderr"
+	LogOutputFile   = "file"
+	LogOutputBoth   = "both"
 )
 
-func InitLogger() {
-	loggerOnce.Do(func() {
-		// Configure time format
-		zerolog.TimeFieldFormat = time.RFC3339
-
-		// Set log level based on environment
-		logLevel := strings.ToLower(config.Cfg.LOG_LEVEL)
-		switch logLevel {
-		case "debug":
-			zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		case "info":
-			zerolog.SetGlobalLevel(zerolog.InfoLevel)
-		case "warn":
-			zerolog.SetGlobalLevel(zerolog.WarnLevel)
-		case "error":
-			zerolog.SetGlobalLevel(zerolog.ErrorLevel)
-		default:
-			zerolog.SetGlobalLevel(zerolog.InfoLevel)
+// Logging owns the loggers of the service. Every component logs through a
+// logger of its own, whose level can be changed at runtime through Levels.
+type Logging struct {
+	Levels *LogLevels
+	root   zerolog.Logger
+	file   io.Closer
+}
+
+// NewLogger builds the application logging from the configured levels, outputs
+// and redaction rules. Pretty console output is used on stderr outside of the
+// deployed environments, files always get JSON.
+func NewLogger(cfg *config.Config) (*Logging, error) {
+	// Configure time format
+	zerolog.TimeFieldFormat = time.RFC3339
+
+	// An unknown level falls back to info, as it always did
+	level, err := ParseLogLevel(cfg.LOG_LEVEL)
+	if err != nil {
+		level = zerolog.InfoLevel
+	}
+	components, err := ParseComponentLevels(cfg.LOG_LEVELS)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := NewLogLevels(level)
+	for component, componentLevel := range components {
+		levels.Set(component, componentLevel)
+	}
+
+	redactor, err := NewRedactor(cfg.LOG_REDACT_FIELDS, cfg.LOG_REDACT_PATTERNS)
+	if err != nil {
+		return nil, err
+	}
+
+	env := strings.ToLower(cfg.ENVIRONMENT)
+	deployed := env == "dev" || env == "stg" || env == "prd"
+
+	var stderr io.Writer = os.Stderr
+	if !deployed {
+		// Pretty console output for development
+		stderr = zerolog.ConsoleWriter{
+			Out:        os.Stderr,
+			TimeFormat: time.RFC3339,
+			NoColor:    false,
+		}
+	}
+
+	logging := &Logging{Levels: levels}
+	var out io.Writer
+	switch cfg.LOG_OUTPUT {
+	case LogOutputStderr, "":
+		out = stderr
+	case LogOutputFile, LogOutputBoth:
+		file := &lumberjack.Logger{
+			Filename:   cfg.LOG_FILE_PATH,
+			MaxSize:    cfg.LOG_FILE_MAX_SIZE_MB,
+			MaxAge:     cfg.LOG_FILE_MAX_AGE_DAYS,
+			MaxBackups: cfg.LOG_FILE_MAX_BACKUPS,
 		}
+		logging.file = file
 
-		// Configure output format based on environment
-		env := strings.ToLower(config.Cfg.ENVIRONMENT)
-		if env != "dev" && env != "stg" && env != "prd" {
-			// Pretty console output for development
-			Logger = log.Output(zerolog.ConsoleWriter{
-				Out:        os.Stderr,
-				TimeFormat: time.RFC3339,
-				NoColor:    false,
-			})
-		} else {
-			// Structured JSON output for production
-			Logger = zerolog.New(os.Stderr).With().
-				Timestamp().
-				Str("service", "gsn-manager-service").
-				Logger()
+		out = file
+		if cfg.LOG_OUTPUT == LogOutputBoth {
+			out = zerolog.MultiLevelWriter(stderr, file)
 		}
+	default:
+		return nil, fmt.Errorf("unknown LOG_OUTPUT %q", cfg.LOG_OUTPUT)
+	}
+
+	// Levels are enforced per component by levelHook, so the root logs everything
+	root := zerolog.New(redactor.Writer(out)).With().Timestamp()
+	if deployed {
+		// Structured JSON output for production
+		root = root.Str("service", "gsn-manager-service")
+	}
+	logging.root = root.Logger().Level(zerolog.TraceLevel)
+
+	logger := logging.Logger()
+	logger.Info().
+		Str("level", level.String()).
+		Str("environment", env).
+		Str("output", cfg.LOG_OUTPUT).
+		Msg("Logger initialized")
+
+	return logging, nil
+}
+
+// Logger returns the logger of everything that is not a named component
+func (l *Logging) Logger() zerolog.Logger {
+	return l.root.Hook(levelHook{levels: l.Levels}, TraceHook{})
+}
+
+// Component returns the logger of a part of the service, e.g. storage. Its
+// lines carry the component name and follow the level set for it.
+func (l *Logging) Component(name string) zerolog.Logger {
+	return l.root.With().Str("component", name).Logger().Hook(levelHook{levels: l.Levels, component: name}, TraceHook{})
+}
+
+// Close releases the log file, if any
+func (l *Logging) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+// TraceHook adds the trace and span IDs to events logged with the context of a
+// traced operation, e.g. logger.Error().Ctx(r.Context()), so logs can be
+// matched with their trace
+type TraceHook struct{}
+
+func (TraceHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	span := trace.SpanContextFromContext(e.GetCtx())
+	if !span.IsValid() {
+		return
+	}
 
-		Logger.Info().
-			Str("level", zerolog.GlobalLevel().String()).
-			Str("environment", env).
-			Msg("Logger initialized")
-	})
+	e.Str("trace_id", span.TraceID().String()).Str("span_id", span.SpanID().String())
 }
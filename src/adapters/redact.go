@@ -0,0 +1,140 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// ? Patterns that can be masked wherever they show up in a log line, selected by name
+var redactionPatterns = map[string]*regexp.Regexp{
+	"email":  regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	"bearer": regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9\-._~+/]+=*`),
+	"jwt":    regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`),
+}
+
+// Redactor masks sensitive data in JSON log lines before they are written.
+// Fields are matched by name whatever their depth, patterns inside any string.
+type Redactor struct {
+	fields   map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor builds a redactor masking the given field names, compared
+// without case, and the named patterns: email, bearer or jwt
+func NewRedactor(fields, patterns []string) (*Redactor, error) {
+	r := &Redactor{fields: make(map[string]bool, len(fields))}
+	for _, field := range fields {
+		r.fields[strings.ToLower(field)] = true
+	}
+
+	for _, name := range patterns {
+		pattern, ok := redactionPatterns[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction pattern %q", name)
+		}
+		r.patterns = append(r.patterns, pattern)
+	}
+
+	return r, nil
+}
+
+// Writer redacts every line before passing it to next
+func (r *Redactor) Writer(next io.Writer) io.Writer {
+	return redactingWriter{redactor: r, next: next}
+}
+
+type redactingWriter struct {
+	redactor *Redactor
+	next     io.Writer
+}
+
+// Write reports the length of the original line, as zerolog expects, even
+// when a shorter or longer line was written
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := w.next.Write(w.redactor.Redact(p)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Redact returns line with the sensitive data masked. Lines holding none are
+// returned as they are; the others are re-encoded, which sorts their fields.
+func (r *Redactor) Redact(line []byte) []byte {
+	if !r.needsRedaction(line) {
+		return line
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		// Not a JSON line, masking the patterns is all that can be done
+		return r.redactString(line)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.redactValue(fields)); err != nil {
+		return r.redactString(line)
+	}
+
+	return buf.Bytes()
+}
+
+// needsRedaction cheaply tells whether the line may hold something to mask
+func (r *Redactor) needsRedaction(line []byte) bool {
+	for _, pattern := range r.patterns {
+		if pattern.Match(line) {
+			return true
+		}
+	}
+
+	lower := bytes.ToLower(line)
+	for field := range r.fields {
+		if bytes.Contains(lower, []byte(`"`+field+`"`)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Redactor) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, nested := range v {
+			if r.fields[strings.ToLower(key)] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = r.redactValue(nested)
+		}
+		return v
+	case []any:
+		for i, nested := range v {
+			v[i] = r.redactValue(nested)
+		}
+		return v
+	case string:
+		return string(r.redactString([]byte(v)))
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) redactString(value []byte) []byte {
+	for _, pattern := range r.patterns {
+		value = pattern.ReplaceAll(value, []byte(redacted))
+	}
+
+	return value
+}
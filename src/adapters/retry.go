@@ -0,0 +1,62 @@
+package adapters
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// RetryPolicy retries an operation with exponential backoff and jitter.
+// Attempts counts the tries, so 0 and 1 never retry, and a negative value
+// retries until the context is cancelled.
+type RetryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns the wait before retry number attempt, counted from 0. It doubles
+// with every attempt up to MaxBackoff, and a random half of it is taken off so
+// replicas started together do not retry in lockstep.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for range attempt {
+		if backoff >= p.MaxBackoff/2 {
+			backoff = p.MaxBackoff
+			break
+		}
+		backoff *= 2
+	}
+	backoff = min(backoff, p.MaxBackoff)
+	if backoff <= 1 {
+		return backoff
+	}
+
+	half := backoff / 2
+	return half + rand.N(backoff-half)
+}
+
+// Do runs fn until it succeeds, the attempts are used up or ctx is cancelled,
+// and returns the last error
+func (p RetryPolicy) Do(ctx context.Context, logger zerolog.Logger, op string, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		if p.Attempts >= 0 && attempt+1 >= p.Attempts {
+			return err
+		}
+
+		wait := p.Backoff(attempt)
+		logger.Warn().Err(err).Int("attempt", attempt+1).Dur("retry_in", wait).Msg("🔁 " + op + " failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+// ? Commands reading or writing documents by filter, with the fields holding their filter
+var queryCommands = map[string][]string{
+	"find":          {"filter", "sort"},
+	"aggregate":     {"pipeline"},
+	"count":         {"query"},
+	"distinct":      {"query"},
+	"findAndModify": {"query", "sort"},
+	"update":        {"updates"},
+	"delete":        {"deletes"},
+}
+
+// maxQueryShapes bounds the shapes kept, the fastest is forgotten to make room
+const maxQueryShapes = 500
+
+// QueryShape sums up the executions of commands sharing a shape, which is
+// the command, its collection and its filter with every value replaced by ?
+type QueryShape struct {
+	Command    string    `json:"command"`
+	Collection string    `json:"collection"`
+	Shape      string    `json:"shape"`
+	Count      int64     `json:"count"`
+	SlowCount  int64     `json:"slow_count"`
+	MaxMs      float64   `json:"max_ms"`
+	AvgMs      float64   `json:"avg_ms"`
+	LastSeen   time.Time `json:"last_seen"`
+	total      time.Duration
+}
+
+// ? Command waiting for its outcome
+type pendingQuery struct {
+	command    string
+	collection string
+	shape      string
+	requestID  string
+}
+
+type queryKey struct {
+	connection string
+	request    int64
+}
+
+// SlowQueries watches the query commands sent to Mongo. Commands slower than
+// the threshold are logged along with their shape and the request they served,
+// and the slowest shapes are kept in memory for the admin endpoint.
+type SlowQueries struct {
+	threshold time.Duration
+	top       int
+	logger    zerolog.Logger
+
+	mu      sync.Mutex
+	pending map[queryKey]pendingQuery
+	shapes  map[string]*QueryShape
+}
+
+// NewSlowQueries logs the commands taking longer than threshold, a threshold
+// of 0 only keeps the statistics. Top reports at most top shapes.
+func NewSlowQueries(threshold time.Duration, top int, logger zerolog.Logger) *SlowQueries {
+	return &SlowQueries{
+		threshold: threshold,
+		top:       top,
+		logger:    logger,
+		pending:   map[queryKey]pendingQuery{},
+		shapes:    map[string]*QueryShape{},
+	}
+}
+
+// Monitor returns the command monitor to register on the Mongo client
+func (s *SlowQueries) Monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: s.started,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			s.finished(ctx, e.CommandFinishedEvent, nil)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			s.finished(ctx, e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+func (s *SlowQueries) started(ctx context.Context, e *event.CommandStartedEvent) {
+	fields, ok := queryCommands[e.CommandName]
+	if !ok {
+		return
+	}
+
+	query := pendingQuery{
+		command:    e.CommandName,
+		collection: stringField(e.Command, e.CommandName),
+		shape:      QueryShapeOf(e.Command, fields),
+		requestID:  db.AuditFromContext(ctx).RequestID,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[queryKey{e.ConnectionID, e.RequestID}] = query
+}
+
+func (s *SlowQueries) finished(ctx context.Context, e event.CommandFinishedEvent, failure error) {
+	s.mu.Lock()
+	key := queryKey{e.ConnectionID, e.RequestID}
+	query, ok := s.pending[key]
+	delete(s.pending, key)
+	if ok {
+		s.record(query, e.Duration)
+	}
+	s.mu.Unlock()
+
+	if !ok || s.threshold <= 0 || e.Duration < s.threshold {
+		return
+	}
+
+	s.logger.Warn().Ctx(ctx).
+		Str("command", query.command).
+		Str("collection", query.collection).
+		Str("shape", query.shape).
+		Float64("duration_ms", milliseconds(e.Duration)).
+		Str("request_id", query.requestID).
+		Err(failure).
+		Msg("🐢 Slow MongoDB command")
+}
+
+// record adds an execution to the statistics of its shape, the lock is held by the caller
+func (s *SlowQueries) record(query pendingQuery, duration time.Duration) {
+	id := query.command + " " + query.collection + " " + query.shape
+	stats, ok := s.shapes[id]
+	if !ok {
+		if len(s.shapes) >= maxQueryShapes {
+			s.evictFastest()
+		}
+		stats = &QueryShape{Command: query.command, Collection: query.collection, Shape: query.shape}
+		s.shapes[id] = stats
+	}
+
+	stats.Count++
+	if s.threshold > 0 && duration >= s.threshold {
+		stats.SlowCount++
+	}
+	stats.total += duration
+	stats.MaxMs = max(stats.MaxMs, milliseconds(duration))
+	stats.AvgMs = milliseconds(stats.total) / float64(stats.Count)
+	stats.LastSeen = time.Now().UTC()
+}
+
+func (s *SlowQueries) evictFastest() {
+	var fastest string
+	for id, stats := range s.shapes {
+		if fastest == "" || stats.MaxMs < s.shapes[fastest].MaxMs {
+			fastest = id
+		}
+	}
+	delete(s.shapes, fastest)
+}
+
+// Top returns the shapes with the slowest executions first
+func (s *SlowQueries) Top() []QueryShape {
+	s.mu.Lock()
+	shapes := make([]QueryShape, 0, len(s.shapes))
+	for _, stats := range s.shapes {
+		shapes = append(shapes, *stats)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(shapes, func(i, j int) bool { return shapes[i].MaxMs > shapes[j].MaxMs })
+	if s.top > 0 && len(shapes) > s.top {
+		shapes = shapes[:s.top]
+	}
+
+	return shapes
+}
+
+// QueryShapeOf renders the given fields of a command with their values
+// redacted, e.g. filter={completed: ?, deleted_at: ?} sort={timestamp: 1}.
+// Sort directions are kept since they are part of what makes a query slow.
+func QueryShapeOf(command bson.Raw, fields []string) string {
+	var parts []string
+	for _, field := range fields {
+		value, err := command.LookupErr(field)
+		if err != nil {
+			continue
+		}
+
+		rendered := redactedShape(value)
+		if field == "sort" {
+			rendered = sortShape(value)
+		}
+		parts = append(parts, field+"="+rendered)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// redactedShape keeps the keys of documents, sorted so that filters built from
+// maps share a shape, and replaces every value by ?. Arrays of documents, like
+// the operands of $and or a pipeline, keep the shape of each document.
+func redactedShape(value bson.RawValue) string {
+	switch value.Type {
+	case bson.TypeEmbeddedDocument:
+		elements, err := value.Document().Elements()
+		if err != nil {
+			return "?"
+		}
+
+		parts := make([]string, len(elements))
+		for i, element := range elements {
+			parts[i] = element.Key() + ": " + redactedShape(element.Value())
+		}
+		slices.Sort(parts)
+		return "{" + strings.Join(parts, ", ") + "}"
+	case bson.TypeArray:
+		values, err := value.Array().Values()
+		if err != nil || len(values) == 0 {
+			return "?"
+		}
+
+		parts := make([]string, 0, len(values))
+		for _, item := range values {
+			if item.Type != bson.TypeEmbeddedDocument {
+				return "?"
+			}
+			if shape := redactedShape(item); !slices.Contains(parts, shape) {
+				parts = append(parts, shape)
+			}
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	default:
+		return "?"
+	}
+}
+
+// sortShape renders a sort document in order, with its directions
+func sortShape(value bson.RawValue) string {
+	elements, err := value.Document().Elements()
+	if err != nil {
+		return "?"
+	}
+
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		direction := "?"
+		if n, ok := element.Value().AsInt64OK(); ok {
+			direction = fmt.Sprint(n)
+		}
+		parts[i] = element.Key() + ": " + direction
+	}
+
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func stringField(command bson.Raw, name string) string {
+	value, err := command.LookupErr(name)
+	if err != nil {
+		return ""
+	}
+
+	str, _ := value.StringValueOK()
+	return str
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/config"
+	"github.com/gsn_manager_service/src/connections"
+	"github.com/gsn_manager_service/src/migrations"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/rs/zerolog"
+)
+
+const (
+	migrateUsage = "usage: migrate [-dry-run] [-to version] up|down|status"
+	apiKeyUsage  = "usage: apikey create -name name -scopes read,write,admin [-expires 720h]"
+)
+
+// runCommand runs the maintenance command given on the command line instead of the server
+func runCommand(conns *connections.Connections, cfg *config.Config, logger zerolog.Logger, showIndexes bool) error {
+	if showIndexes {
+		return printIndexes(conns, cfg)
+	}
+
+	if flag.Arg(0) == "apikey" {
+		return runAPIKey(conns, cfg, logger, flag.Args()[1:])
+	}
+
+	return runMigrate(conns, cfg, logger, flag.Args()[1:])
+}
+
+// printIndexes writes the index report as a table to stdout
+func printIndexes(conns *connections.Connections, cfg *config.Config) error {
+	report, err := connections.InspectIndexes(conns, cfg)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COLLECTION\tNAME\tSTATE\tDESIRED\tACTUAL\tDETAIL")
+	for _, index := range report.Indexes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", index.Collection, index.Name, index.State, index.Desired, index.Actual, index.Detail)
+	}
+
+	return w.Flush()
+}
+
+// runMigrate applies or rolls back the Mongo data migrations. Without -to, up
+// applies every pending migration and down rolls back the latest applied one.
+func runMigrate(conns *connections.Connections, cfg *config.Config, logger zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without changing anything")
+	to := flags.Int("to", -1, "version to migrate up to, or to roll back to")
+
+	// Flags are accepted on either side of the action
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	action := flags.Arg(0)
+	if flags.NArg() > 0 {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q, %s", flags.Arg(0), migrateUsage)
+	}
+
+	runner, err := connections.MigrationRunner(conns, cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var results []migrations.Result
+	switch action {
+	case "status":
+		return printMigrationStatus(ctx, runner)
+	case "up":
+		results, err = runner.Up(ctx, max(*to, 0), *dryRun)
+	case "down":
+		target := *to
+		if target < 0 {
+			if target, err = previousVersion(ctx, runner); err != nil {
+				return err
+			}
+		}
+		results, err = runner.Down(ctx, target, *dryRun)
+	default:
+		return fmt.Errorf("unknown action %q, %s", action, migrateUsage)
+	}
+
+	if err == nil || len(results) > 0 {
+		printMigrationResults(results)
+	}
+	return err
+}
+
+// previousVersion returns the version applied before the latest one, so rolling back to it undoes a single migration
+func previousVersion(ctx context.Context, runner *migrations.Runner) (int, error) {
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	previous, latest := 0, 0
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			previous, latest = latest, status.Version
+		}
+	}
+	if latest == 0 {
+		return 0, fmt.Errorf("no migration has been applied")
+	}
+
+	return previous, nil
+}
+
+func printMigrationStatus(ctx context.Context, runner *migrations.Runner) error {
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+
+	return w.Flush()
+}
+
+func printMigrationResults(results []migrations.Result) {
+	if len(results) == 0 {
+		fmt.Println("Nothing to migrate")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tDIRECTION\tDOCUMENTS")
+	for _, result := range results {
+		affected := strconv.FormatInt(result.Affected, 10)
+		if result.DryRun {
+			affected += " (dry run)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", result.Version, result.Name, result.Direction, affected)
+	}
+	_ = w.Flush()
+}
+
+// runAPIKey creates an API key straight in the store, which is how the first
+// admin key is made before the admin endpoints can be reached
+func runAPIKey(conns *connections.Connections, cfg *config.Config, logger zerolog.Logger, args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return fmt.Errorf("%s", apiKeyUsage)
+	}
+
+	flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	name := flags.String("name", "", "name telling who or what uses the key")
+	scopes := flags.String("scopes", "", "comma separated scopes among read, write and admin")
+	expires := flags.Duration("expires", 0, "lifetime of the key, 0 never expires")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q, %s", flags.Arg(0), apiKeyUsage)
+	}
+	if cfg.STORAGE_BACKEND == config.BackendMemory {
+		return fmt.Errorf("keys of the %s backend do not outlive the process, the server prints one at startup", config.BackendMemory)
+	}
+
+	payload := db.CreateAPIKey{Name: *name}
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			payload.Scopes = append(payload.Scopes, db.APIKeyScope(scope))
+		}
+	}
+	if *expires > 0 {
+		expiresAt := time.Now().UTC().Add(*expires)
+		payload.ExpiresAt = &expiresAt
+	}
+	if err := utils.ValidateStruct(&payload); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	factories, err := connections.CreateAllFactories(ctx, conns, cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	key, secret, err := services.NewAPIKeyService(factories.APIKeys).Create(ctx, &payload)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\t%s\n", key.ID.Hex())
+	fmt.Fprintf(w, "NAME\t%s\n", key.Name)
+	fmt.Fprintf(w, "SCOPES\t%s\n", *scopes)
+	fmt.Fprintf(w, "KEY\t%s\n", secret)
+	_ = w.Flush()
+	fmt.Println("The key is shown only once, store it now")
+
+	return nil
+}
+
+// bootstrapMemoryAPIKey creates an admin key for the memory backend, whose
+// keys are lost on restart and so cannot be made ahead with the apikey command.
+// The secret goes to stdout rather than the logs, which may be shipped elsewhere.
+func bootstrapMemoryAPIKey(ctx context.Context, cfg *config.Config, keys services.APIKeyService, logger zerolog.Logger) {
+	if cfg.STORAGE_BACKEND != config.BackendMemory {
+		return
+	}
+
+	payload := db.CreateAPIKey{Name: "bootstrap", Scopes: []db.APIKeyScope{db.ScopeAdmin}}
+	_, secret, err := keys.Create(ctx, &payload)
+	if err != nil {
+		logger.Error().Err(err).Msg("☠️ Could not create the bootstrap API key")
+		return
+	}
+
+	fmt.Printf("🔑 Admin API key of this process: %s\n", secret)
+}
@@ -1,25 +1,346 @@
 package connections
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
 	"github.com/gsn_manager_service/src/adapters"
 	"github.com/gsn_manager_service/src/adapters/db"
 	"github.com/gsn_manager_service/src/config"
+	"github.com/gsn_manager_service/src/health"
+	"github.com/gsn_manager_service/src/metrics"
+	"github.com/gsn_manager_service/src/migrations"
+	"github.com/gsn_manager_service/src/tracing"
+	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
 )
 
+// Connections holds the database handles of the configured storage backend.
+// Db is only set for Mongo and SQL for the SQL backends.
 type Connections struct {
-	Db *mongo.Client
+	Db  *mongo.Client
+	SQL *sql.DB
+	// SlowQueries holds the slowest Mongo query shapes, it is only set for Mongo
+	SlowQueries *adapters.SlowQueries
+	// ready stays unset while a degraded startup waits for the database,
+	// readyCh is closed when it gets set
+	ready   atomic.Bool
+	readyCh chan struct{}
+}
+
+// Factories holds the stores built on top of the connections
+type Factories struct {
+	Tasks       db.TaskStore
+	History     db.HistoryStore
+	Idempotency db.IdempotencyStore
+	APIKeys     db.APIKeyStore
+	Cursors     *db.CursorCodec
+}
+
+// StartConnections connects to the database of the configured storage backend.
+// With DEGRADED_STARTUP, Mongo is not waited for: the connections are returned
+// right away and CreateAllFactories keeps trying in the background. The Mongo
+// pool is reported to m and its commands traced by t when they are not nil.
+func StartConnections(cfg *config.Config, logger zerolog.Logger, m *metrics.Metrics, t *tracing.Tracing) (*Connections, error) {
+	conns := &Connections{readyCh: make(chan struct{})}
+
+	switch cfg.STORAGE_BACKEND {
+	case config.BackendMongo:
+		opts := mongoOptions(cfg)
+		if m != nil {
+			opts.PoolEvents = m.ObservePoolEvent
+		}
+		if t != nil {
+			opts.Commands = t.CommandMonitor()
+		}
+		conns.SlowQueries = adapters.NewSlowQueries(cfg.MONGO_SLOW_QUERY, cfg.MONGO_SLOW_QUERY_TOP, logger)
+		opts.SlowQueries = conns.SlowQueries
+
+		if cfg.DEGRADED_STARTUP {
+			client, err := adapters.NewMongoClient(opts, logger)
+			if err != nil {
+				return nil, err
+			}
+			conns.Db = client
+			return conns, nil
+		}
+
+		client, err := adapters.ConnectToMongoDb(opts, logger)
+		if err != nil {
+			return nil, err
+		}
+		conns.Db = client
+	case config.BackendSQLite:
+		conn, err := adapters.ConnectToSQL(db.SQLite, cfg.SQLITE_PATH, logger)
+		if err != nil {
+			return nil, err
+		}
+		conns.SQL = conn
+	case config.BackendPostgres:
+		conn, err := adapters.ConnectToSQL(db.Postgres, cfg.POSTGRES_URI, logger)
+		if err != nil {
+			return nil, err
+		}
+		conn.SetMaxOpenConns(cfg.POSTGRES_MAX_CONNS)
+		conn.SetMaxIdleConns(cfg.POSTGRES_MAX_IDLE)
+		conn.SetConnMaxLifetime(cfg.POSTGRES_CONN_LIFETIME)
+		conns.SQL = conn
+	case config.BackendMemory:
+		// ? Nothing to connect to, the store is created with the factories
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", cfg.STORAGE_BACKEND)
+	}
+
+	conns.markReady()
+	return conns, nil
+}
+
+// Ready reports whether the database has been reached and prepared, so requests can be served
+func (c *Connections) Ready() bool {
+	return c.ready.Load()
+}
+
+// WaitReady blocks until the database is ready, it reports false when ctx is cancelled first
+func (c *Connections) WaitReady(ctx context.Context) bool {
+	select {
+	case <-c.readyCh:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *Connections) markReady() {
+	if c.ready.CompareAndSwap(false, true) {
+		close(c.readyCh)
+	}
+}
+
+// HealthChecks returns the readiness checks of the opened connections
+func (c *Connections) HealthChecks() []health.Check {
+	checks := []health.Check{{Name: "startup", Run: func(context.Context) error {
+		if !c.Ready() {
+			return errors.New("waiting for the database")
+		}
+		return nil
+	}}}
+
+	if c.Db != nil {
+		checks = append(checks, health.Check{Name: "mongo", Run: func(ctx context.Context) error {
+			return c.Db.Ping(ctx, readpref.Primary())
+		}})
+	}
+	if c.SQL != nil {
+		checks = append(checks, health.Check{Name: "sql", Run: c.SQL.PingContext})
+	}
+
+	return checks
 }
 
-func StartConnections() (*Connections, error) {
-	client, err := adapters.ConnectToMongoDb(config.Cfg.MONGO_URI)
+func mongoOptions(cfg *config.Config) adapters.MongoOptions {
+	return adapters.MongoOptions{
+		URI:                    cfg.MONGO_URI,
+		MaxPoolSize:            cfg.MONGO_MAX_POOL_SIZE,
+		MinPoolSize:            cfg.MONGO_MIN_POOL_SIZE,
+		MaxConnIdleTime:        cfg.MONGO_MAX_CONN_IDLE,
+		ConnectTimeout:         cfg.MONGO_CONNECT_TIMEOUT,
+		ServerSelectionTimeout: cfg.MONGO_SELECT_TIMEOUT,
+		Retry: adapters.RetryPolicy{
+			Attempts:       cfg.MONGO_CONNECT_RETRIES,
+			InitialBackoff: cfg.MONGO_RETRY_BACKOFF,
+			MaxBackoff:     cfg.MONGO_RETRY_MAX_WAIT,
+		},
+	}
+}
+
+// Close releases the connections that were opened
+func (c *Connections) Close(logger zerolog.Logger) {
+	if c.Db != nil {
+		adapters.DisconnectMongo(c.Db, logger)
+	}
+	if c.SQL != nil {
+		adapters.DisconnectSQL(c.SQL, logger)
+	}
+}
+
+// CreateAllFactories builds the stores of the configured storage backend.
+// ctx bounds the background work of a degraded startup.
+func CreateAllFactories(ctx context.Context, conns *Connections, cfg *config.Config, logger zerolog.Logger) (*Factories, error) {
+	if cfg.CURSOR_SECRET == "" {
+		logger.Warn().Msg("CURSOR_SECRET is not set, pagination cursors will not survive a restart")
+	}
+	cursors := db.NewCursorCodec([]byte(cfg.CURSOR_SECRET))
+
+	switch cfg.STORAGE_BACKEND {
+	case config.BackendMongo:
+		return createMongoFactories(ctx, conns, cfg, logger, cursors)
+	case config.BackendMemory:
+		logger.Warn().Msg("⚠️ Using the in-memory storage backend, data will be lost on restart")
+
+		store := db.NewMemoryStore()
+		return &Factories{
+			Tasks:       store,
+			History:     store,
+			Idempotency: db.NewMemoryIdempotencyStore(cfg.IDEMPOTENCY_TTL, cfg.IDEMPOTENCY_LEASE),
+			APIKeys:     db.NewMemoryAPIKeyStore(),
+			Cursors:     cursors,
+		}, nil
+	case config.BackendSQLite:
+		return createSQLFactories(conns.SQL, db.SQLite, cfg, cursors)
+	case config.BackendPostgres:
+		return createSQLFactories(conns.SQL, db.Postgres, cfg, cursors)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", cfg.STORAGE_BACKEND)
+	}
+}
+
+func createMongoFactories(ctx context.Context, conns *Connections, cfg *config.Config, logger zerolog.Logger, cursors *db.CursorCodec) (*Factories, error) {
+	client := conns.Db
+	tasks := db.NewTaskRepository(client, cfg.DB_NAME, cfg.TASK_COLLECTION_NAME, logger)
+	history := db.NewHistoryRepository(client, cfg.DB_NAME, cfg.HISTORY_COLLECTION)
+	tasks.History = history
+
+	factories := &Factories{
+		Tasks:       tasks,
+		History:     history,
+		Idempotency: db.NewIdempotencyRepository(client, cfg.DB_NAME, cfg.IDEMPOTENCY_COLLECTION, cfg.IDEMPOTENCY_LEASE),
+		APIKeys:     db.NewAPIKeyRepository(client, cfg.DB_NAME, cfg.API_KEY_COLLECTION),
+		Cursors:     cursors,
+	}
+
+	if conns.Ready() {
+		if err := prepareMongo(ctx, client.Database(cfg.DB_NAME), cfg, logger); err != nil {
+			return nil, err
+		}
+		return factories, nil
+	}
+
+	logger.Warn().Msg("⚠️ Starting degraded, requests are answered with 503 until MongoDB is reachable")
+	go awaitMongo(ctx, conns, cfg, logger)
+
+	return factories, nil
+}
+
+// awaitMongo pings Mongo until it answers, then prepares the database and
+// leaves the degraded state. A failed preparation is retried with the same
+// backoff, until ctx is cancelled.
+func awaitMongo(ctx context.Context, conns *Connections, cfg *config.Config, logger zerolog.Logger) {
+	opts := mongoOptions(cfg)
+	opts.Retry.Attempts = -1
+	if err := adapters.PingMongo(ctx, conns.Db, opts, logger); err != nil {
+		return
+	}
+
+	err := opts.Retry.Do(ctx, logger, "MongoDB preparation", func(ctx context.Context) error {
+		return prepareMongo(ctx, conns.Db.Database(cfg.DB_NAME), cfg, logger)
+	})
 	if err != nil {
-		return nil, err
+		logger.Error().Err(err).Msg("☠️ Could not prepare MongoDB, staying degraded")
+		return
 	}
 
-	return &Connections{Db: client}, nil
+	conns.markReady()
+	logger.Info().Msg("📻 Connected to MongoDB, leaving the degraded state")
 }
 
-func CreateAllFactories(client *mongo.Client) {
-	db.NewTaskRepository(client, config.Cfg.DB_NAME, config.Cfg.TASK_COLLECTION_NAME)
+// prepareMongo brings the data and the indexes up to date before requests are served
+func prepareMongo(ctx context.Context, database *mongo.Database, cfg *config.Config, logger zerolog.Logger) error {
+	if cfg.MIGRATE_ON_STARTUP {
+		// Generous, since another replica may hold the lock while it migrates
+		migrateCtx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+		defer cancel()
+		if _, err := newMigrationRunner(database, cfg, logger).Up(migrateCtx, 0, false); err != nil {
+			return fmt.Errorf("migrating the Mongo data: %w", err)
+		}
+	}
+
+	schemaCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	ensureMongoSchema(schemaCtx, database, cfg, logger)
+
+	return nil
+}
+
+// MigrationRunner returns the runner of the Mongo data migrations
+func MigrationRunner(conns *Connections, cfg *config.Config, logger zerolog.Logger) (*migrations.Runner, error) {
+	if cfg.STORAGE_BACKEND != config.BackendMongo {
+		return nil, fmt.Errorf("data migrations only apply to the %s backend", config.BackendMongo)
+	}
+
+	return newMigrationRunner(conns.Db.Database(cfg.DB_NAME), cfg, logger), nil
+}
+
+func newMigrationRunner(database *mongo.Database, cfg *config.Config, logger zerolog.Logger) *migrations.Runner {
+	return migrations.NewRunner(database, migrations.TaskMigrations(cfg.TASK_COLLECTION_NAME), logger)
+}
+
+// mongoIndexes declares the indexes of every collection the service uses
+func mongoIndexes(cfg *config.Config) db.IndexRegistry {
+	return db.IndexRegistry{
+		db.TaskIndexes(cfg.TASK_COLLECTION_NAME),
+		db.HistoryIndexes(cfg.HISTORY_COLLECTION),
+		db.IdempotencyIndexes(cfg.IDEMPOTENCY_COLLECTION, cfg.IDEMPOTENCY_TTL),
+		db.APIKeyIndexes(cfg.API_KEY_COLLECTION),
+	}
+}
+
+// ensureMongoSchema creates the missing indexes and installs the tasks validator.
+// Failures are only logged, the service still works without them, just slower.
+func ensureMongoSchema(ctx context.Context, database *mongo.Database, cfg *config.Config, logger zerolog.Logger) {
+	report, err := mongoIndexes(cfg).Ensure(ctx, database)
+	if err != nil {
+		logger.Warn().Err(err).Msg("⚠️ Could not ensure the Mongo indexes")
+	} else {
+		for _, index := range report.Indexes {
+			switch index.State {
+			case db.IndexCreated:
+				logger.Info().Str("collection", index.Collection).Str("index", index.Name).Msg("Created Mongo index")
+			case db.IndexDrifted:
+				logger.Warn().Str("collection", index.Collection).Str("index", index.Name).Str("desired", index.Desired).
+					Str("actual", index.Actual).Msg("⚠️ Mongo index differs from its declaration: " + index.Detail)
+			}
+		}
+	}
+
+	if cfg.MONGO_VALIDATION == db.ValidationOff {
+		return
+	}
+	if err := db.ApplyTaskValidator(ctx, database, cfg.TASK_COLLECTION_NAME, cfg.MONGO_VALIDATION); err != nil {
+		logger.Warn().Err(err).Msg("⚠️ Could not apply the tasks schema validator")
+	}
+}
+
+// InspectIndexes lists the desired and actual indexes of the Mongo backend without changing them
+func InspectIndexes(conns *Connections, cfg *config.Config) (*db.IndexReport, error) {
+	if cfg.STORAGE_BACKEND != config.BackendMongo {
+		return nil, fmt.Errorf("indexes are only managed for the %s backend, the SQL backends create theirs in migrations", config.BackendMongo)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return mongoIndexes(cfg).Inspect(ctx, conns.Db.Database(cfg.DB_NAME))
+}
+
+// createSQLFactories brings the schema up to date and builds the stores on top of it
+func createSQLFactories(conn *sql.DB, dialect *db.SQLDialect, cfg *config.Config, cursors *db.CursorCodec) (*Factories, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := db.MigrateSQL(ctx, conn, dialect); err != nil {
+		return nil, fmt.Errorf("migrating the %s schema: %w", dialect.Name, err)
+	}
+
+	store := db.NewSQLStore(conn, dialect)
+	return &Factories{
+		Tasks:       store,
+		History:     store,
+		Idempotency: db.NewSQLIdempotencyStore(conn, dialect, cfg.IDEMPOTENCY_TTL, cfg.IDEMPOTENCY_LEASE),
+		APIKeys:     db.NewSQLAPIKeyStore(conn, dialect),
+		Cursors:     cursors,
+	}, nil
 }
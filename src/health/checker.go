@@ -0,0 +1,118 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+
+	defaultTimeout = 2 * time.Second
+)
+
+// errDraining fails the readiness while the server shuts down
+var errDraining = errors.New("shutting down")
+
+// ? Named probe of a dependency, Run returns nil when it is usable
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// ? Outcome of a single check. Detail is only filled in verbose reports.
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+}
+
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+func (r *Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs the readiness checks of the service. Once Drain is called it
+// reports not ready whatever the checks say, so load balancers stop sending
+// traffic before the server shuts down.
+type Checker struct {
+	Timeout  time.Duration
+	checks   []Check
+	draining atomic.Bool
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &Checker{Timeout: timeout, checks: checks}
+}
+
+// Drain makes every following report not ready
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Run runs every check concurrently, each bounded by the timeout. Error
+// messages may reveal internals, so they are only kept when verbose is set.
+func (c *Checker) Run(ctx context.Context, verbose bool) *Report {
+	checks := append([]Check{{Name: "shutdown", Run: c.checkDraining}}, c.checks...)
+	report := &Report{Status: StatusOK, Checks: make([]CheckResult, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check, verbose)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusError
+		}
+	}
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check, verbose bool) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	result := CheckResult{
+		Name:      check.Name,
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusError
+		if verbose {
+			result.Detail = err.Error()
+		}
+	}
+
+	return result
+}
+
+func (c *Checker) checkDraining(context.Context) error {
+	if c.draining.Load() {
+		return errDraining
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/rs/zerolog"
+)
+
+// PurgeTrash permanently removes tasks that have been in the trash for longer
+// than retention, checking every interval until ctx is cancelled. Each purge
+// is recorded in the task history under the system actor.
+func PurgeTrash(ctx context.Context, store db.TaskStore, logger zerolog.Logger, retention, interval time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		logger.Info().Msg("🗑️ Trash purge disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purgeOnce(ctx, store, logger, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeOnce(ctx context.Context, store db.TaskStore, logger zerolog.Logger, retention time.Duration) {
+	purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	cutoff := time.Now().Add(-retention)
+	purged, err := store.PurgeTrash(purgeCtx, cutoff)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to purge trashed tasks")
+		return
+	}
+
+	if purged > 0 {
+		logger.Info().Int64("purged", purged).Time("cutoff", cutoff).Msg("🗑️ Purged trashed tasks")
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -11,46 +14,147 @@ import (
 	"github.com/gsn_manager_service/src/adapters"
 	"github.com/gsn_manager_service/src/config"
 	"github.com/gsn_manager_service/src/connections"
+	"github.com/gsn_manager_service/src/health"
+	"github.com/gsn_manager_service/src/jobs"
+	"github.com/gsn_manager_service/src/metrics"
 	"github.com/gsn_manager_service/src/server"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/tracing"
 )
 
 func main() {
+	showIndexes := flag.Bool("indexes", false, "print the desired and actual Mongo indexes, then exit")
+	flag.Parse()
+
 	// Load the application configuration.
-	config := config.LoadConfig()
-	adapters.InitLogger()
+	config, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "☠️ Invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+	logging, err := adapters.NewLogger(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "☠️ Could not set up logging: %v\n", err)
+		os.Exit(1)
+	}
+	defer logging.Close()
+	logger, storageLogger := logging.Logger(), logging.Component("storage")
+
+	var m *metrics.Metrics
+	if config.METRICS_ENABLED {
+		m = metrics.New()
+	}
 
-	result, err := connections.StartConnections()
+	t, err := tracing.New(context.Background(), tracing.Options{
+		Exporter:    config.TRACING_EXPORTER,
+		ServiceName: "gsn-manager-service",
+		Endpoint:    config.TRACING_ENDPOINT,
+		Insecure:    config.TRACING_INSECURE,
+		SampleRatio: config.TRACING_SAMPLE_RATIO,
+	})
 	if err != nil {
+		logger.Error().Err(err).Msg("☠️ Could not set up tracing")
 		os.Exit(1)
 	}
-	defer adapters.DisconnectMongo(result.Db)
+	if t != nil {
+		t.Install()
+		logger.Info().Msgf("🔭 Exporting traces with the %s exporter", config.TRACING_EXPORTER)
+	}
 
-	connections.CreateAllFactories(result.Db)
+	result, err := connections.StartConnections(config, storageLogger, m, t)
+	if err != nil {
+		os.Exit(1)
+	}
+	defer result.Close(storageLogger)
 
-	// TODO: for now this root context is not being used, so is not doing anything
-	// I could remove it, but it would be used later
-	_, cancel := context.WithCancel(context.Background()) // Create root ctx
+	if *showIndexes || flag.Arg(0) == "migrate" || flag.Arg(0) == "apikey" {
+		if err := runCommand(result, config, logger, *showIndexes); err != nil {
+			logger.Error().Err(err).Msg("☠️ Command failed")
+			result.Close(storageLogger)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background()) // Create root ctx
 	defer cancel()
 
-	srv := server.StartServer(config)
+	factories, err := connections.CreateAllFactories(ctx, result, config, storageLogger)
+	if err != nil {
+		logger.Error().Err(err).Msg("☠️ Could not set up the storage backend")
+		os.Exit(1)
+	}
+
+	tasks, history := factories.Tasks, factories.History
+	if m != nil {
+		tasks, history = m.InstrumentTaskStore(tasks), m.InstrumentHistoryStore(history)
+	}
+	if t != nil {
+		tasks, history = t.InstrumentTaskStore(tasks, config.STORAGE_BACKEND), t.InstrumentHistoryStore(history, config.STORAGE_BACKEND)
+	}
+
+	var apiKeys services.APIKeyService
+	if config.AUTH_ENABLED {
+		apiKeys = services.NewAPIKeyService(factories.APIKeys)
+		bootstrapMemoryAPIKey(ctx, config, apiKeys, logger)
+	} else {
+		logger.Warn().Msg("⚠️ AUTH_ENABLED is off, the task routes are open and the admin endpoints changing settings are not mounted")
+	}
+
+	// ? A degraded startup has not prepared the database yet, so the purge waits for it
+	go func() {
+		if result.WaitReady(ctx) {
+			jobs.PurgeTrash(ctx, tasks, logging.Component("jobs"), config.TRASH_RETENTION, config.TRASH_PURGE_INTERVAL)
+		}
+	}()
+
+	checker := health.NewChecker(config.HEALTH_CHECK_TIMEOUT, result.HealthChecks()...)
+	srv := server.StartServer(config, server.Dependencies{
+		Tasks:       services.NewTaskService(tasks, history, factories.Cursors),
+		Idempotency: factories.Idempotency,
+		Ready:       result.Ready,
+		Health:      checker,
+		Metrics:     m,
+		Tracing:     t,
+		LogLevels:   logging.Levels,
+		SlowQueries: result.SlowQueries,
+		APIKeys:     apiKeys,
+		Logger:      logging.Component("server"),
+	})
 	serverErr := make(chan error, 1)
 	go func() {
-		adapters.Logger.Info().Msg(fmt.Sprintf("🚀 Starting server on %d port", config.PORT))
+		logger.Info().Msg(fmt.Sprintf("🚀 Starting server on %d port", config.PORT))
 		if err := srv.ListenAndServe(); err != nil {
 			serverErr <- err
 		}
 	}()
 
+	var metricsSrv *http.Server
+	if m != nil && config.METRICS_PORT != 0 {
+		metricsSrv = server.StartMetricsServer(config, m)
+		go func() {
+			logger.Info().Msg(fmt.Sprintf("📈 Serving metrics on %d port", config.METRICS_PORT))
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+
 	// Signal listener goroutine
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	select {
 	case sig := <-quit:
-		adapters.Logger.Info().Msgf("👻 Received shutdown signal: %s", sig)
+		logger.Info().Msgf("👻 Received shutdown signal: %s", sig)
 		cancel()
+
+		// Fail readiness first, so load balancers stop routing here before connections are closed
+		checker.Drain()
+		logger.Info().Msgf("🚰 Draining traffic for %s", config.SHUTDOWN_DRAIN_DELAY)
+		time.Sleep(config.SHUTDOWN_DRAIN_DELAY)
 	case err := <-serverErr:
-		adapters.Logger.Error().Err(err).Msg("💥 Server crashed")
+		logger.Error().Err(err).Msg("💥 Server crashed")
 		cancel()
 	}
 
@@ -59,10 +163,18 @@ func main() {
 	defer shutdownCancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		adapters.Logger.Error().Err(err).Msg("⚠️ Server forced to shutdown")
+		logger.Error().Err(err).Msg("⚠️ Server forced to shutdown")
 	} else {
-		adapters.Logger.Info().Msg("✅ Server stopped gracefully")
+		logger.Info().Msg("✅ Server stopped gracefully")
+	}
+	if metricsSrv != nil {
+		_ = metricsSrv.Shutdown(shutdownCtx)
+	}
+	if t != nil {
+		if err := t.Shutdown(shutdownCtx); err != nil {
+			logger.Warn().Err(err).Msg("⚠️ Could not flush the remaining spans")
+		}
 	}
 
-	adapters.Logger.Info().Msg("👋 Cleanup complete, exiting.")
+	logger.Info().Msg("👋 Cleanup complete, exiting.")
 }
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+const namespace = "gsn"
+
+// Metrics holds the collectors of the service, registered on a registry of
+// their own so tests can create as many as they need
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	httpInFlight prometheus.Gauge
+
+	storeDuration *prometheus.HistogramVec
+	storeErrors   *prometheus.CounterVec
+
+	poolConnections *prometheus.GaugeVec
+	poolInUse       *prometheus.GaugeVec
+	poolCheckoutErr *prometheus.CounterVec
+	poolCleared     *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "http", Name: "requests_total",
+			Help: "HTTP requests handled, by route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests, by route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "http", Name: "requests_in_flight",
+			Help: "HTTP requests being handled.",
+		}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "store", Name: "operation_duration_seconds",
+			Help:    "Time taken by task store operations, whatever their outcome.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "store", Name: "operation_errors_total",
+			Help: "Failed task store operations, by repository error kind.",
+		}, []string{"operation", "kind"}),
+		poolConnections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "mongo_pool", Name: "connections",
+			Help: "Open connections of the MongoDB pool, by server.",
+		}, []string{"address"}),
+		poolInUse: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "mongo_pool", Name: "connections_in_use",
+			Help: "Connections of the MongoDB pool checked out by an operation, by server.",
+		}, []string{"address"}),
+		poolCheckoutErr: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mongo_pool", Name: "checkout_failures_total",
+			Help: "Operations that could not get a connection from the MongoDB pool, by reason.",
+		}, []string{"reason"}),
+		poolCleared: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "mongo_pool", Name: "cleared_total",
+			Help: "Times the MongoDB pool of a server was cleared after an error.",
+		}, []string{"address"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests, m.httpDuration, m.httpInFlight,
+		m.storeDuration, m.storeErrors,
+		m.poolConnections, m.poolInUse, m.poolCheckoutErr, m.poolCleared,
+	)
+
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// ObservePoolEvent keeps the MongoDB pool gauges up to date, it is meant for the client pool monitor
+func (m *Metrics) ObservePoolEvent(e *event.PoolEvent) {
+	switch e.Type {
+	case event.ConnectionCreated:
+		m.poolConnections.WithLabelValues(e.Address).Inc()
+	case event.ConnectionClosed:
+		m.poolConnections.WithLabelValues(e.Address).Dec()
+	case event.ConnectionCheckedOut:
+		m.poolInUse.WithLabelValues(e.Address).Inc()
+	case event.ConnectionCheckedIn:
+		m.poolInUse.WithLabelValues(e.Address).Dec()
+	case event.ConnectionCheckOutFailed:
+		m.poolCheckoutErr.WithLabelValues(e.Reason).Inc()
+	case event.ConnectionPoolCleared:
+		m.poolCleared.WithLabelValues(e.Address).Inc()
+	}
+}
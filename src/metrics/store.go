@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TaskStore times every operation of the wrapped store and counts its failures
+type TaskStore struct {
+	next    db.TaskStore
+	metrics *Metrics
+}
+
+// HistoryStore times every operation of the wrapped store and counts its failures
+type HistoryStore struct {
+	next    db.HistoryStore
+	metrics *Metrics
+}
+
+var (
+	_ db.TaskStore    = (*TaskStore)(nil)
+	_ db.HistoryStore = (*HistoryStore)(nil)
+)
+
+func (m *Metrics) InstrumentTaskStore(store db.TaskStore) *TaskStore {
+	return &TaskStore{next: store, metrics: m}
+}
+
+func (m *Metrics) InstrumentHistoryStore(store db.HistoryStore) *HistoryStore {
+	return &HistoryStore{next: store, metrics: m}
+}
+
+// observeStore records an operation started at start. Errors are counted by
+// their repository error kind, anything else is an internal error.
+func (m *Metrics) observeStore(operation string, start time.Time, err error) {
+	m.storeDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return
+	}
+
+	kind := "internal"
+	var repoErr *db.RepositoryError
+	if errors.As(err, &repoErr) {
+		kind = string(repoErr.Kind)
+	}
+	m.storeErrors.WithLabelValues(operation, kind).Inc()
+}
+
+func (s *TaskStore) CreateTodo(ctx context.Context, payload *db.CreateNewTask) (task *db.Tasks, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("CreateTodo", start, err) }(time.Now())
+	return s.next.CreateTodo(ctx, payload)
+}
+
+func (s *TaskStore) GetAllTasks(ctx context.Context, query *db.TaskListQuery) (page *db.TaskPage, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("GetAllTasks", start, err) }(time.Now())
+	return s.next.GetAllTasks(ctx, query)
+}
+
+func (s *TaskStore) GetTaskById(ctx context.Context, id string) (task *db.Tasks, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("GetTaskById", start, err) }(time.Now())
+	return s.next.GetTaskById(ctx, id)
+}
+
+func (s *TaskStore) ModifyTask(ctx context.Context, id string, payload *db.UpdateTask, expectedVersion *int64) (task *db.Tasks, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("ModifyTask", start, err) }(time.Now())
+	return s.next.ModifyTask(ctx, id, payload, expectedVersion)
+}
+
+func (s *TaskStore) ReplaceTask(ctx context.Context, id string, payload *db.CreateNewTask, expectedVersion *int64) (task *db.Tasks, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("ReplaceTask", start, err) }(time.Now())
+	return s.next.ReplaceTask(ctx, id, payload, expectedVersion)
+}
+
+func (s *TaskStore) PatchTask(ctx context.Context, id string, expectedVersion *int64, build func(*db.Tasks) (*db.TaskPatch, error)) (task *db.Tasks, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("PatchTask", start, err) }(time.Now())
+	return s.next.PatchTask(ctx, id, expectedVersion, build)
+}
+
+func (s *TaskStore) DeleteTask(ctx context.Context, id string, expectedVersion *int64) (deleted bson.ObjectID, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("DeleteTask", start, err) }(time.Now())
+	return s.next.DeleteTask(ctx, id, expectedVersion)
+}
+
+func (s *TaskStore) RestoreTask(ctx context.Context, id string) (task *db.Tasks, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("RestoreTask", start, err) }(time.Now())
+	return s.next.RestoreTask(ctx, id)
+}
+
+func (s *TaskStore) PurgeTask(ctx context.Context, id string) (purged bson.ObjectID, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("PurgeTask", start, err) }(time.Now())
+	return s.next.PurgeTask(ctx, id)
+}
+
+func (s *TaskStore) PurgeTrash(ctx context.Context, cutoff time.Time) (purged int64, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("PurgeTrash", start, err) }(time.Now())
+	return s.next.PurgeTrash(ctx, cutoff)
+}
+
+func (s *TaskStore) BulkWrite(ctx context.Context, ops []db.BulkOperation, opts db.BulkOptions) (results []db.BulkItemResult, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("BulkWrite", start, err) }(time.Now())
+	return s.next.BulkWrite(ctx, ops, opts)
+}
+
+func (s *TaskStore) PreviewByFilter(ctx context.Context, filter db.TaskFilter) (result *db.FilterWriteResult, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("PreviewByFilter", start, err) }(time.Now())
+	return s.next.PreviewByFilter(ctx, filter)
+}
+
+func (s *TaskStore) UpdateByFilter(ctx context.Context, filter db.TaskFilter, payload *db.UpdateTask) (result *db.FilterWriteResult, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("UpdateByFilter", start, err) }(time.Now())
+	return s.next.UpdateByFilter(ctx, filter, payload)
+}
+
+func (s *TaskStore) DeleteByFilter(ctx context.Context, filter db.TaskFilter) (result *db.FilterWriteResult, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("DeleteByFilter", start, err) }(time.Now())
+	return s.next.DeleteByFilter(ctx, filter)
+}
+
+func (s *HistoryStore) ListByTask(ctx context.Context, id string, query *db.HistoryQuery) (page *db.HistoryPage, err error) {
+	defer func(start time.Time) { s.metrics.observeStore("ListByTask", start, err) }(time.Now())
+	return s.next.ListByTask(ctx, id, query)
+}
@@ -0,0 +1,377 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	// Collection keeps a record of every applied migration and the lock document
+	Collection = "_migrations"
+
+	lockID              = "lock"
+	defaultLockTTL      = 10 * time.Minute
+	lockPollingInterval = time.Second
+)
+
+// ErrLockLost stops a run when another runner took the lock, or it could not be extended
+var ErrLockLost = errors.New("migration lock lost")
+
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// Step changes the stored documents and returns how many it changed, or would
+// change when dryRun is set. Steps must be safe to run again, since a replica
+// stopping between a step and its record runs it a second time.
+type Step func(ctx context.Context, database *mongo.Database, dryRun bool) (int64, error)
+
+// ? Ordered, named change to the stored documents. Down is nil when it can not be rolled back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      Step
+	Down    Step
+}
+
+// ? Outcome of running a single migration
+type Result struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Direction Direction `json:"direction"`
+	Affected  int64     `json:"affected"`
+	DryRun    bool      `json:"dry_run"`
+}
+
+// ? Whether a migration was applied, and when
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// ? DB Model for an applied migration
+type record struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+	Affected  int64     `bson:"affected"`
+}
+
+// Runner applies and rolls back migrations. Only one runner at a time, across
+// every replica, changes anything: the others wait for the lock document.
+type Runner struct {
+	Database   *mongo.Database
+	Migrations []Migration
+	Owner      string
+	LockTTL    time.Duration
+	Logger     zerolog.Logger
+}
+
+func NewRunner(database *mongo.Database, migrations []Migration, logger zerolog.Logger) *Runner {
+	hostname, _ := os.Hostname()
+
+	return &Runner{
+		Database:   database,
+		Migrations: migrations,
+		Owner:      fmt.Sprintf("%s/%d", hostname, os.Getpid()),
+		LockTTL:    defaultLockTTL,
+		Logger:     logger,
+	}
+}
+
+// Status lists every known migration in order, with the time it was applied
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(r.Migrations))
+	for i, migration := range r.Migrations {
+		statuses[i] = Status{Version: migration.Version, Name: migration.Name}
+		if rec, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &rec.AppliedAt
+		}
+	}
+
+	return statuses, nil
+}
+
+// Up applies, in order, the migrations not applied yet up to and including
+// version target, or all of them when target is 0.
+func (r *Runner) Up(ctx context.Context, target int, dryRun bool) ([]Result, error) {
+	return r.run(ctx, DirectionUp, target, dryRun)
+}
+
+// Down rolls back, newest first, the applied migrations above version target
+func (r *Runner) Down(ctx context.Context, target int, dryRun bool) ([]Result, error) {
+	return r.run(ctx, DirectionDown, target, dryRun)
+}
+
+func (r *Runner) run(ctx context.Context, direction Direction, target int, dryRun bool) ([]Result, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	// A dry run changes nothing, so it does not need to keep other replicas out
+	if !dryRun {
+		release, err := r.lock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := r.plan(direction, target, applied)
+	results := make([]Result, 0, len(plan))
+	for _, migration := range plan {
+		step := migration.Up
+		if direction == DirectionDown {
+			step = migration.Down
+		}
+		if step == nil {
+			return results, fmt.Errorf("migration %d %s can not be rolled back", migration.Version, migration.Name)
+		}
+
+		affected, err := r.runStep(ctx, step, dryRun)
+		if err != nil {
+			return results, fmt.Errorf("running migration %d %s %s: %w", migration.Version, migration.Name, direction, err)
+		}
+		results = append(results, Result{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Direction: direction,
+			Affected:  affected,
+			DryRun:    dryRun,
+		})
+		if dryRun {
+			continue
+		}
+
+		if err := r.save(ctx, direction, migration, affected); err != nil {
+			return results, err
+		}
+		r.Logger.Info().Int("version", migration.Version).Str("migration", migration.Name).
+			Str("direction", string(direction)).Int64("affected", affected).Msg("🚚 Applied migration")
+
+		if err := r.extendLock(ctx); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// runStep runs step while extending the lock every third of its TTL, so a long
+// step does not let it expire. When the lock is lost the step is cancelled and
+// its outcome dropped, since another runner may be running it too.
+func (r *Runner) runStep(ctx context.Context, step Step, dryRun bool) (int64, error) {
+	if dryRun {
+		return step(ctx, r.Database, dryRun)
+	}
+
+	stepCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var lost error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(r.LockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stepCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if err := r.extendLock(stepCtx); err != nil && stepCtx.Err() == nil {
+				lost = err
+				cancel(err)
+				return
+			}
+		}
+	}()
+
+	affected, err := step(stepCtx, r.Database, dryRun)
+	cancel(nil)
+	<-done
+	if lost != nil {
+		return 0, lost
+	}
+
+	return affected, err
+}
+
+// plan returns the migrations to run, in the order to run them
+func (r *Runner) plan(direction Direction, target int, applied map[int]record) []Migration {
+	var plan []Migration
+	for _, migration := range r.Migrations {
+		_, done := applied[migration.Version]
+
+		switch direction {
+		case DirectionUp:
+			if !done && (target == 0 || migration.Version <= target) {
+				plan = append(plan, migration)
+			}
+		case DirectionDown:
+			if done && migration.Version > target {
+				plan = append(plan, migration)
+			}
+		}
+	}
+
+	if direction == DirectionDown {
+		slices.Reverse(plan)
+	}
+
+	return plan
+}
+
+// validate checks the migrations are sorted by version without duplicates,
+// since the version is what records refer to
+func (r *Runner) validate() error {
+	for i, migration := range r.Migrations {
+		if migration.Version <= 0 || migration.Name == "" || migration.Up == nil {
+			return fmt.Errorf("migration %d %q needs a positive version, a name and an up step", migration.Version, migration.Name)
+		}
+		if i > 0 && migration.Version <= r.Migrations[i-1].Version {
+			return fmt.Errorf("migration %d %s is out of order", migration.Version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+func (r *Runner) collection() *mongo.Collection {
+	return r.Database.Collection(Collection)
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]record, error) {
+	cursor, err := r.collection().Find(ctx, bson.M{"_id": bson.M{"$ne": lockID}})
+	if err != nil {
+		return nil, fmt.Errorf("reading the applied migrations: %w", err)
+	}
+
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("reading the applied migrations: %w", err)
+	}
+
+	applied := make(map[int]record, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+
+	return applied, nil
+}
+
+func (r *Runner) save(ctx context.Context, direction Direction, migration Migration, affected int64) error {
+	var err error
+	if direction == DirectionUp {
+		_, err = r.collection().InsertOne(ctx, record{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now(),
+			Affected:  affected,
+		})
+	} else {
+		_, err = r.collection().DeleteOne(ctx, bson.M{"_id": migration.Version})
+	}
+
+	if err != nil {
+		return fmt.Errorf("recording migration %d %s %s: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	return nil
+}
+
+// lock waits until this runner holds the lock document, and returns the function releasing it
+func (r *Runner) lock(ctx context.Context) (func(), error) {
+	for waiting := false; ; waiting = true {
+		acquired, err := r.tryLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			return r.unlock, nil
+		}
+
+		if !waiting {
+			r.Logger.Info().Msg("⏳ Another replica is running the migrations, waiting for it")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(lockPollingInterval):
+		}
+	}
+}
+
+// tryLock takes the lock when it is free or expired, or extends it when this
+// runner already holds it. A lock held by another runner makes the upsert
+// collide with the existing document.
+func (r *Runner) tryLock(ctx context.Context) (bool, error) {
+	now := time.Now()
+	filter := bson.M{
+		"_id": lockID,
+		"$or": bson.A{bson.M{"owner": r.Owner}, bson.M{"expires_at": bson.M{"$lt": now}}},
+	}
+	update := bson.M{"$set": bson.M{"owner": r.Owner, "locked_at": now, "expires_at": now.Add(r.LockTTL)}}
+
+	_, err := r.collection().UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("taking the migration lock: %w", err)
+	}
+
+	return true, nil
+}
+
+// extendLock keeps the lock held by this runner, failing with ErrLockLost when another one holds it
+func (r *Runner) extendLock(ctx context.Context) error {
+	acquired, err := r.tryLock(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLockLost, err)
+	}
+	if !acquired {
+		return ErrLockLost
+	}
+
+	return nil
+}
+
+func (r *Runner) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := r.collection().DeleteOne(ctx, bson.M{"_id": lockID, "owner": r.Owner}); err != nil {
+		r.Logger.Warn().Err(err).Msg("⚠️ Could not release the migration lock, it expires on its own")
+	}
+}
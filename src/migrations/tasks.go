@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// TaskMigrations lists, in order, the migrations of the tasks collection.
+// New migrations are appended with the next version, applied ones never change.
+func TaskMigrations(collection string) []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "backfill_task_version",
+			// Tasks created before optimistic locking start at the first version
+			Up: updateMany(collection,
+				bson.M{"version": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"version": int64(1)}}),
+		},
+		{
+			Version: 2,
+			Name:    "backfill_task_audit_times",
+			// The creation time of older tasks is recovered from their ObjectID
+			Up: updateMany(collection,
+				bson.M{"$or": bson.A{bson.M{"created_at": bson.M{"$exists": false}}, bson.M{"updated_at": bson.M{"$exists": false}}}},
+				bson.A{bson.M{"$set": bson.M{
+					"created_at": bson.M{"$ifNull": bson.A{"$created_at", bson.M{"$toDate": "$_id"}}},
+					"updated_at": bson.M{"$ifNull": bson.A{"$updated_at", "$created_at", bson.M{"$toDate": "$_id"}}},
+				}}}),
+		},
+		{
+			Version: 3,
+			Name:    "unset_null_deleted_at",
+			// Live tasks are stored without deleted_at rather than with a null one
+			Up: updateMany(collection,
+				bson.M{"deleted_at": bson.M{"$type": "null"}},
+				bson.M{"$unset": bson.M{"deleted_at": ""}}),
+			Down: noop,
+		},
+	}
+}
+
+// updateMany returns a step applying update to the documents matching filter.
+// A dry run counts them instead.
+func updateMany(collection string, filter, update any) Step {
+	return func(ctx context.Context, database *mongo.Database, dryRun bool) (int64, error) {
+		if dryRun {
+			return database.Collection(collection).CountDocuments(ctx, filter)
+		}
+
+		result, err := database.Collection(collection).UpdateMany(ctx, filter, update)
+		if err != nil {
+			return 0, err
+		}
+
+		return result.ModifiedCount, nil
+	}
+}
+
+// noop rolls back a migration whose changes are valid under the previous version as well
+func noop(context.Context, *mongo.Database, bool) (int64, error) {
+	return 0, nil
+}
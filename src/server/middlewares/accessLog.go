@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"context"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+// AccessLogOptions selects the requests written to the access log
+type AccessLogOptions struct {
+	// SampleRate is the share of successful requests logged, from 0 to 1.
+	// Client and server errors are always logged.
+	SampleRate float64
+	// Exclude lists paths never logged, such as the probes
+	Exclude []string
+}
+
+// AccessLog writes one structured line per request through logger, once the
+// response is sent. It also attaches a logger carrying the request ID to the
+// request context, which handlers get back with LoggerFrom.
+func AccessLog(logger zerolog.Logger, opts AccessLogOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := middleware.GetReqID(r.Context())
+			ctxLogger := logger.With().Ctx(r.Context()).Str("request_id", requestID).Logger()
+			r = r.WithContext(ctxLogger.WithContext(r.Context()))
+
+			if slices.Contains(opts.Exclude, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// ? Read back from the context, handlers and auth may have added fields to it
+			requestLogger := zerolog.Ctx(r.Context())
+			var event *zerolog.Event
+			switch {
+			case status >= http.StatusInternalServerError:
+				event = requestLogger.Error()
+			case status >= http.StatusBadRequest:
+				event = requestLogger.Warn()
+			case opts.SampleRate < 1 && rand.Float64() >= opts.SampleRate:
+				return
+			default:
+				event = requestLogger.Info()
+			}
+
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+
+			event.
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Str("route", route).
+				Int("status", status).
+				Int("bytes", ww.BytesWritten()).
+				Float64("duration_ms", float64(time.Since(start).Microseconds())/1000).
+				Str("remote_ip", remoteIP(r.RemoteAddr)).
+				Str("user_agent", r.UserAgent()).
+				Msg("Request handled")
+		})
+	}
+}
+
+// remoteIP drops the port of the peer address, RealIP leaves none when it found a forwarded address
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// LoggerFrom returns the request scoped logger set by AccessLog, or fallback
+// bound to ctx when the request did not go through it
+func LoggerFrom(ctx context.Context, fallback zerolog.Logger) *zerolog.Logger {
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+
+	logger := fallback.With().Ctx(ctx).Logger()
+	return &logger
+}
@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gsn_manager_service/src/adapters/db"
+)
+
+const (
+	actorHeader    = "X-Actor"
+	anonymousActor = "anonymous"
+	maxActorLength = 100
+)
+
+// Audit attaches the caller and the request ID to the request context, so
+// changes made by the repositories can be attributed in the task history.
+// The caller given in X-Actor is replaced by the API key when auth is enabled.
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := strings.TrimSpace(r.Header.Get(actorHeader))
+		if actor == "" {
+			actor = anonymousActor
+		}
+		if len(actor) > maxActorLength {
+			actor = actor[:maxActorLength]
+		}
+
+		ctx := db.WithAudit(r.Context(), db.Audit{
+			Actor:     actor,
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
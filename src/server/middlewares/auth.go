@@ -0,0 +1,124 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/rs/zerolog"
+)
+
+type apiKeyContextKey struct{}
+
+// WithAPIKey attaches the key that authenticated a request to ctx
+func WithAPIKey(ctx context.Context, key *db.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the key that authenticated the request, nil when auth is disabled
+func APIKeyFromContext(ctx context.Context) *db.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*db.APIKey)
+	return key
+}
+
+// APIKeyAuth checks the API key sent in the Authorization header as a bearer
+// token, or in X-API-Key. A nil APIKeyAuth lets every request through.
+type APIKeyAuth struct {
+	keys services.APIKeyService
+}
+
+func NewAPIKeyAuth(keys services.APIKeyService) *APIKeyAuth {
+	return &APIKeyAuth{keys: keys}
+}
+
+// Require answers 401 to requests without a valid key and 403 to keys lacking scope
+func (a *APIKeyAuth) Require(scope db.APIKeyScope) func(http.Handler) http.Handler {
+	return a.require(func(*http.Request) db.APIKeyScope { return scope })
+}
+
+// RequireByMethod asks for the read scope on safe methods and the write scope on the others
+func (a *APIKeyAuth) RequireByMethod() func(http.Handler) http.Handler {
+	return a.require(func(r *http.Request) db.APIKeyScope {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return db.ScopeRead
+		default:
+			return db.ScopeWrite
+		}
+	})
+}
+
+func (a *APIKeyAuth) require(scopeOf func(*http.Request) db.APIKeyScope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret := apiKeySecret(r)
+			if secret == "" {
+				unauthorized(w, r, "An API key is required, send it as a bearer token or in X-API-Key")
+				return
+			}
+
+			key, err := a.keys.Authenticate(r.Context(), secret)
+			switch {
+			case errors.Is(err, services.ErrInvalidAPIKey):
+				unauthorized(w, r, "The API key is not valid")
+				return
+			case errors.Is(err, services.ErrAPIKeyExpired):
+				unauthorized(w, r, "The API key has expired")
+				return
+			case errors.Is(err, services.ErrAPIKeyRevoked):
+				unauthorized(w, r, "The API key has been revoked")
+				return
+			case err != nil:
+				zerolog.Ctx(r.Context()).Error().Err(err).Msg("Could not check the API key")
+				utils.WriteProblem(w, r, utils.NewProblem(http.StatusServiceUnavailable, "service-unavailable", "API keys cannot be checked right now"))
+				return
+			}
+
+			// ? The request logger is shared with the access log, so its line names the caller too
+			zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("api_key_id", key.ID.Hex()).Str("api_key_name", key.Name)
+			})
+			// ? Once a key is known, X-Actor is ignored so history cannot be written in another name
+			audit := db.AuditFromContext(r.Context())
+			audit.Actor = apiKeyActor(key)
+			r = r.WithContext(db.WithAudit(WithAPIKey(r.Context(), key), audit))
+
+			if scope := scopeOf(r); !key.HasScope(scope) {
+				utils.WriteProblem(w, r, utils.NewProblem(http.StatusForbidden, "forbidden", "The API key lacks the "+string(scope)+" scope"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKeyActor names a key in the task history, by its ID which never changes and its name which people read
+func apiKeyActor(key *db.APIKey) string {
+	return "api-key:" + key.ID.Hex() + " (" + key.Name + ")"
+}
+
+func apiKeySecret(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gsn_manager_service"`)
+	utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnauthorized, "unauthorized", detail))
+}
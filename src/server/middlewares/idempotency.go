@@ -0,0 +1,158 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/rs/zerolog"
+)
+
+const (
+	idempotencyHeader    = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// ? Response headers that are stored and replayed along with the body
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// IdempotencyStore keeps the outcome of requests sent with an Idempotency-Key
+type IdempotencyStore = db.IdempotencyStore
+
+// Idempotency makes a route safe to retry. The first request carrying an
+// Idempotency-Key runs normally and its response is stored; retries with the
+// same key and body replay it, a different body is rejected with 422 and a
+// retry arriving while the first request still runs gets 409. Server errors
+// are not stored so the request can be retried, and a reservation left by a
+// request that never finished is taken over once its lease has passed.
+func Idempotency(store IdempotencyStore, logger zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(idempotencyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLen {
+				detail := "Idempotency-Key must be at most 255 characters long"
+				utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, "invalid-header", detail))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, utils.MaxPayloadBytes))
+			if err != nil {
+				utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, "invalid-payload", "request body could not be read"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scopedKey := idempotencyScope(r, key)
+			existing, token, err := store.Reserve(r.Context(), scopedKey, bodyFingerprint(body))
+			if err != nil {
+				LoggerFrom(r.Context(), logger).Error().Err(err).Msg("Failed to reserve idempotency key")
+				utils.WriteProblem(w, r, utils.NewProblem(http.StatusServiceUnavailable, "service-unavailable", "The request can not be processed right now"))
+				return
+			}
+
+			if existing != nil {
+				replay(w, r, existing, bodyFingerprint(body))
+				return
+			}
+
+			var captured bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&captured)
+
+			// The outcome has to be stored even if the client goes away
+			storeCtx := context.WithoutCancel(r.Context())
+			completed := false
+			defer func() {
+				if !completed {
+					if err := store.Release(storeCtx, scopedKey, token); err != nil {
+						LoggerFrom(r.Context(), logger).Error().Err(err).Msg("Failed to release idempotency key")
+					}
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+
+			if ww.Status() >= http.StatusInternalServerError {
+				return
+			}
+
+			headers := make(map[string]string)
+			for _, name := range replayedHeaders {
+				if value := ww.Header().Get(name); value != "" {
+					headers[name] = value
+				}
+			}
+
+			err = store.Complete(storeCtx, scopedKey, token, ww.Status(), headers, captured.Bytes())
+			if errors.Is(err, db.ErrConflict) {
+				// ? A retry took the key over after the lease passed, the record is its own now
+				LoggerFrom(r.Context(), logger).Warn().Err(err).Msg("Idempotency key was taken over, the response is not stored")
+				completed = true
+				return
+			}
+			if err != nil {
+				LoggerFrom(r.Context(), logger).Error().Err(err).Msg("Failed to store idempotent response")
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+func replay(w http.ResponseWriter, r *http.Request, record *db.IdempotencyRecord, fingerprint string) {
+	switch {
+	case record.Fingerprint != fingerprint:
+		detail := "Idempotency-Key was already used with a different request body"
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnprocessableEntity, "idempotency-key-reused", detail))
+	case !record.Completed:
+		w.Header().Set("Retry-After", "1")
+		detail := "A request with this Idempotency-Key is still being processed"
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusConflict, "idempotency-key-in-use", detail))
+	default:
+		for name, value := range record.Headers {
+			w.Header().Set(name, value)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(record.Status)
+		_, _ = w.Write(record.Body)
+	}
+}
+
+// idempotencyScope ties a key to the caller and route, so equal keys sent by
+// different clients or to different endpoints never collide. The caller is the
+// authenticated API key, X-Actor is only trusted when auth is disabled.
+func idempotencyScope(r *http.Request, key string) string {
+	caller := "actor:" + db.AuditFromContext(r.Context()).Actor
+	if apiKey := APIKeyFromContext(r.Context()); apiKey != nil {
+		caller = "api-key:" + apiKey.ID.Hex()
+	}
+	sum := sha256.Sum256([]byte(caller + "\x00" + r.Method + "\x00" + r.URL.Path + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// bodyFingerprint hashes the request body. JSON bodies are re-encoded first so
+// formatting and key order do not make two equal payloads look different.
+func bodyFingerprint(body []byte) string {
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if canonical, err := json.Marshal(decoded); err == nil {
+			body = canonical
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
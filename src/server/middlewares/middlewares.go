@@ -5,14 +5,16 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
 )
 
-func SetupMiddleware(r *chi.Mux) {
+func SetupMiddleware(r *chi.Mux, logger zerolog.Logger, accessLog AccessLogOptions) {
 	// Basic middleware for production
 	r.Use(middleware.StripSlashes)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(Audit)
+	r.Use(AccessLog(logger, accessLog))
 	r.Use(middleware.Recoverer)
 
 	r.Use(middleware.Compress(5))
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gsn_manager_service/src/utils"
+)
+
+// Readiness answers 503 while ready reports false, as during a degraded startup
+// waiting for the database. A nil ready is always ready.
+func Readiness(ready func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ready != nil && !ready() {
+				w.Header().Set("Retry-After", "5")
+				utils.WriteProblem(w, r, utils.NewProblem(http.StatusServiceUnavailable, "service-unavailable", "The database is not reachable yet"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
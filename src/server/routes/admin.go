@@ -0,0 +1,191 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/server/middlewares"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/rs/zerolog"
+)
+
+// AdminHandler serves the operator endpoints under /admin
+type AdminHandler struct {
+	LogLevels   *adapters.LogLevels
+	SlowQueries *adapters.SlowQueries
+	APIKeys     services.APIKeyService
+	Logger      zerolog.Logger
+}
+
+// ? Change of the level of a component, or of the default level when Component is empty
+type logLevelChange struct {
+	Component string `json:"component"`
+	Level     string `json:"level" validate:"required"`
+}
+
+type slowQueriesResponse struct {
+	Queries []adapters.QueryShape `json:"queries"`
+}
+
+type apiKeysResponse struct {
+	Keys []db.APIKey `json:"keys"`
+}
+
+// ? Key just created or rotated, the only time its secret is shown
+type apiKeySecretResponse struct {
+	*db.APIKey
+	Key string `json:"key"`
+}
+
+// SetupAdminRoutes mounts the endpoints of the features that are enabled,
+// behind the admin scope. Without auth only the read-only endpoints are
+// mounted, nothing can be changed by whoever reaches the port.
+func SetupAdminRoutes(r chi.Router, admin *AdminHandler, auth *middlewares.APIKeyAuth) {
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(auth.Require(db.ScopeAdmin))
+		if admin.LogLevels != nil {
+			r.Get("/log-levels", admin.GetLogLevels)
+		}
+		if admin.SlowQueries != nil {
+			r.Get("/slow-queries", admin.GetSlowQueries)
+		}
+		if auth == nil {
+			return
+		}
+
+		if admin.LogLevels != nil {
+			r.Put("/log-levels", admin.SetLogLevel)
+			r.Delete("/log-levels/{component}", admin.ResetLogLevel)
+		}
+		if admin.APIKeys != nil {
+			r.Post("/api-keys", admin.CreateAPIKey)
+			r.Get("/api-keys", admin.ListAPIKeys)
+			r.Post("/api-keys/{id}/rotate", admin.RotateAPIKey)
+			r.Delete("/api-keys/{id}", admin.RevokeAPIKey)
+		}
+	})
+}
+
+func (h *AdminHandler) GetLogLevels(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, h.LogLevels.Snapshot())
+}
+
+// SetLogLevel changes a level right away, until the next change or restart
+func (h *AdminHandler) SetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var payload logLevelChange
+	if err := utils.DecodeAndValidate(w, r, &payload); err != nil {
+		h.writeAdminError(w, r, err)
+		return
+	}
+
+	level, err := adapters.ParseLogLevel(payload.Level)
+	if err != nil {
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnprocessableEntity, "validation-error", err.Error()))
+		return
+	}
+
+	h.LogLevels.Set(payload.Component, level)
+	utils.WriteJSON(w, http.StatusOK, h.LogLevels.Snapshot())
+}
+
+// ResetLogLevel makes a component follow the default level again
+func (h *AdminHandler) ResetLogLevel(w http.ResponseWriter, r *http.Request) {
+	h.LogLevels.Reset(chi.URLParam(r, "component"))
+	utils.WriteJSON(w, http.StatusOK, h.LogLevels.Snapshot())
+}
+
+// GetSlowQueries lists the Mongo query shapes with the slowest executions since startup
+func (h *AdminHandler) GetSlowQueries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusOK, slowQueriesResponse{Queries: h.SlowQueries.Top()})
+}
+
+// CreateAPIKey answers the new key along with its secret, which cannot be read again
+func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var payload db.CreateAPIKey
+	if err := utils.DecodeAndValidate(w, r, &payload); err != nil {
+		h.writeAdminError(w, r, err)
+		return
+	}
+
+	key, secret, err := h.APIKeys.Create(r.Context(), &payload)
+	if err != nil {
+		h.writeAdminError(w, r, err)
+		return
+	}
+
+	middlewares.LoggerFrom(r.Context(), h.Logger).Info().Str("created_key_id", key.ID.Hex()).Str("created_key_name", key.Name).Msg("🔑 API key created")
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusCreated, apiKeySecretResponse{APIKey: key, Key: secret})
+}
+
+// ListAPIKeys lists every key, revoked ones included, without their secrets
+func (h *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.APIKeys.List(r.Context())
+	if err != nil {
+		h.writeAdminError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, apiKeysResponse{Keys: keys})
+}
+
+// RotateAPIKey gives a key a new secret, the previous one stops working at once
+func (h *AdminHandler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, secret, err := h.APIKeys.Rotate(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, r, err)
+		return
+	}
+
+	middlewares.LoggerFrom(r.Context(), h.Logger).Info().Str("rotated_key_id", key.ID.Hex()).Msg("🔑 API key rotated")
+	w.Header().Set("Cache-Control", "no-store")
+	utils.WriteJSON(w, http.StatusOK, apiKeySecretResponse{APIKey: key, Key: secret})
+}
+
+// RevokeAPIKey disables a key for good, revoking it again is a no-op
+func (h *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.APIKeys.Revoke(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.writeAdminError(w, r, err)
+		return
+	}
+
+	middlewares.LoggerFrom(r.Context(), h.Logger).Info().Str("revoked_key_id", key.ID.Hex()).Msg("🔑 API key revoked")
+	utils.WriteJSON(w, http.StatusOK, key)
+}
+
+// writeAdminError answers the payload and repository errors of the admin endpoints
+func (h *AdminHandler) writeAdminError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		decodeErr     *utils.DecodeError
+		validationErr *utils.ValidationError
+		repoErr       *db.RepositoryError
+	)
+
+	switch {
+	case errors.As(err, &decodeErr):
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, "invalid-payload", decodeErr.Error()))
+		return
+	case errors.As(err, &validationErr):
+		problem := utils.NewProblem(http.StatusUnprocessableEntity, "validation-error", "The payload has invalid fields")
+		problem.Errors = validationErr.Errors
+		utils.WriteProblem(w, r, problem)
+		return
+	case errors.As(err, &repoErr):
+		if mapped, ok := repositoryErrorStatus[repoErr.Kind]; ok {
+			if mapped.status >= http.StatusInternalServerError {
+				middlewares.LoggerFrom(r.Context(), h.Logger).Error().Err(err).Msg("Request failed")
+			}
+			utils.WriteProblem(w, r, utils.NewProblem(mapped.status, mapped.slug, repoErr.Detail))
+			return
+		}
+	}
+
+	middlewares.LoggerFrom(r.Context(), h.Logger).Error().Err(err).Msg("Unexpected error while handling request")
+	utils.WriteProblem(w, r, utils.NewProblem(http.StatusInternalServerError, "internal-error", "An unexpected error occurred"))
+}
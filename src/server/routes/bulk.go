@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/utils"
+)
+
+// ? Body of a bulk request. Ordered defaults to true when omitted.
+type bulkRequest struct {
+	Ordered    *bool                  `json:"ordered"`
+	Atomic     bool                   `json:"atomic"`
+	Operations []bulkRequestOperation `json:"operations"`
+}
+
+type bulkRequestOperation struct {
+	Op      db.BulkOpKind   `json:"op"`
+	ID      string          `json:"id"`
+	Version *int64          `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type bulkResponse struct {
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Results   []db.BulkItemResult `json:"results"`
+}
+
+func (h *TaskHandler) BulkTasks(w http.ResponseWriter, r *http.Request) {
+	var payload bulkRequest
+	if err := utils.DecodeJSON(w, r, &payload); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	if len(payload.Operations) == 0 || len(payload.Operations) > db.MaxBulkOperations {
+		h.writeError(w, r, &utils.DecodeError{
+			Msg: fmt.Sprintf("operations must contain between 1 and %d items", db.MaxBulkOperations),
+		})
+		return
+	}
+
+	ops := make([]db.BulkOperation, len(payload.Operations))
+	for i, raw := range payload.Operations {
+		ops[i] = parseBulkOperation(raw)
+	}
+
+	opts := db.BulkOptions{Ordered: payload.Ordered == nil || *payload.Ordered, Atomic: payload.Atomic}
+	results, err := h.Service.Bulk(r.Context(), ops, opts)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	response := bulkResponse{Results: results}
+	for _, result := range results {
+		if result.Error == nil {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// parseBulkOperation decodes and validates the data of one operation. Problems
+// are attached to the operation so they are reported in its result.
+func parseBulkOperation(raw bulkRequestOperation) db.BulkOperation {
+	op := db.BulkOperation{Kind: raw.Op, ID: raw.ID, Version: raw.Version}
+
+	var data any
+	switch raw.Op {
+	case db.BulkCreate:
+		op.Create = &db.CreateNewTask{}
+		data = op.Create
+	case db.BulkUpdate:
+		op.Update = &db.UpdateTask{}
+		data = op.Update
+	case db.BulkDelete:
+		if len(raw.Data) > 0 {
+			op.Err = &db.BulkItemError{Code: "invalid_payload", Message: "delete operations do not take data"}
+		}
+		return op
+	default:
+		op.Err = &db.BulkItemError{Code: "invalid_payload", Message: "op must be one of create, update or delete"}
+		return op
+	}
+
+	if raw.Op == db.BulkCreate && (raw.ID != "" || raw.Version != nil) {
+		op.Err = &db.BulkItemError{Code: "invalid_payload", Message: "create operations do not take an id or version"}
+		return op
+	}
+	if len(raw.Data) == 0 {
+		op.Err = &db.BulkItemError{Code: "invalid_payload", Message: "data is required"}
+		return op
+	}
+
+	if err := utils.UnmarshalStrict(raw.Data, data); err != nil {
+		op.Err = &db.BulkItemError{Code: "invalid_payload", Message: err.Error()}
+		return op
+	}
+
+	if err := utils.ValidateStruct(data); err != nil {
+		op.Err = &db.BulkItemError{Code: string(db.KindValidation), Message: "payload failed validation"}
+
+		var validationErr *utils.ValidationError
+		if errors.As(err, &validationErr) {
+			op.Err.Fields = validationErr.Errors
+		}
+	}
+
+	return op
+}
+
+// UpdateTasksByFilter applies the fields of the payload to every task matching the query filter
+func (h *TaskHandler) UpdateTasksByFilter(w http.ResponseWriter, r *http.Request) {
+	query, err := db.ParseTaskWriteQuery(r.URL.Query())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	var payload db.UpdateTask
+	if err := utils.DecodeAndValidate(w, r, &payload); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	result, err := h.Service.UpdateByFilter(r.Context(), query, &payload)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, result)
+}
+
+// DeleteTasksByFilter moves every task matching the query filter to the trash
+func (h *TaskHandler) DeleteTasksByFilter(w http.ResponseWriter, r *http.Request) {
+	query, err := db.ParseTaskWriteQuery(r.URL.Query())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	result, err := h.Service.DeleteByFilter(r.Context(), query)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/server/middlewares"
+	"github.com/gsn_manager_service/src/utils"
+)
+
+// ? HTTP status and problem type for every repository error kind
+var repositoryErrorStatus = map[db.ErrorKind]struct {
+	status int
+	slug   string
+}{
+	db.KindNotFound:    {http.StatusNotFound, "not-found"},
+	db.KindInvalidID:   {http.StatusBadRequest, "invalid-id"},
+	db.KindConflict:    {http.StatusConflict, "conflict"},
+	db.KindValidation:  {http.StatusUnprocessableEntity, "validation-error"},
+	db.KindUnavailable: {http.StatusServiceUnavailable, "service-unavailable"},
+}
+
+// writeError maps an error coming from payload handling or the repository to a problem
+// response. Only client-safe details are sent, the full error is logged.
+func (h *TaskHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		queryErr      *db.QueryError
+		repoErr       *db.RepositoryError
+		decodeErr     *utils.DecodeError
+		validationErr *utils.ValidationError
+		preErr        *utils.PreconditionError
+		patchErr      *utils.PatchError
+	)
+
+	switch {
+	case errors.Is(err, utils.ErrPreconditionFailed), errors.Is(err, db.ErrVersionMismatch):
+		detail := "The task does not match the version given in If-Match"
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusPreconditionFailed, "precondition-failed", detail))
+		return
+	case errors.Is(err, utils.ErrUnsupportedPatch):
+		w.Header().Set("Accept-Patch", utils.AcceptPatch)
+		detail := "Patches must be sent as " + utils.MergePatchContentType + " or " + utils.JSONPatchContentType
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnsupportedMediaType, "unsupported-media-type", detail))
+		return
+	case errors.Is(err, utils.ErrPatchTestFailed):
+		detail := "A test operation of the patch does not hold on the current task"
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusConflict, "patch-test-failed", detail))
+		return
+	case errors.As(err, &patchErr):
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusUnprocessableEntity, "invalid-patch", patchErr.Error()))
+		return
+	case errors.As(err, &preErr):
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, "invalid-header", preErr.Error()))
+		return
+	case errors.As(err, &decodeErr):
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, "invalid-payload", decodeErr.Error()))
+		return
+	case errors.As(err, &validationErr):
+		problem := utils.NewProblem(http.StatusUnprocessableEntity, "validation-error", "The payload has invalid fields")
+		problem.Errors = validationErr.Errors
+		utils.WriteProblem(w, r, problem)
+		return
+	case errors.As(err, &queryErr):
+		utils.WriteProblem(w, r, utils.NewProblem(http.StatusBadRequest, "invalid-query", queryErr.Error()))
+		return
+	case errors.As(err, &repoErr):
+		mapped, ok := repositoryErrorStatus[repoErr.Kind]
+		if ok {
+			logger := middlewares.LoggerFrom(r.Context(), h.Logger)
+			event := logger.Debug()
+			if mapped.status >= http.StatusInternalServerError {
+				event = logger.Error()
+			}
+			event.Err(err).Msg("Request failed")
+
+			utils.WriteProblem(w, r, utils.NewProblem(mapped.status, mapped.slug, repoErr.Detail))
+			return
+		}
+	}
+
+	middlewares.LoggerFrom(r.Context(), h.Logger).Error().Err(err).Msg("Unexpected error while handling request")
+	utils.WriteProblem(w, r, utils.NewProblem(http.StatusInternalServerError, "internal-error", "An unexpected error occurred"))
+}
@@ -4,14 +4,53 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/health"
+	"github.com/gsn_manager_service/src/server/middlewares"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/rs/zerolog"
 )
 
-func Healthz(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte("OK"))
-	if err != nil {
-		adapters.Logger.Error().Msg(fmt.Sprintf("Error writing health check response: %v", err))
+// Healthz reports that the process is alive, without looking at its dependencies
+func Healthz(logger zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("OK"))
+		if err != nil {
+			logger.Error().Msg(fmt.Sprintf("Error writing health check response: %v", err))
+		}
+	}
+}
+
+// Readyz runs the readiness checks and answers 503 when any fails, including
+// while a degraded startup waits for the database or the server drains.
+// With ?verbose the reason of each failure is included, which needs the admin
+// scope since the reasons are raw errors of the dependencies.
+func Readyz(checker *health.Checker, auth *middlewares.APIKeyAuth) http.HandlerFunc {
+	brief, detailed := readyz(checker, false), auth.Require(db.ScopeAdmin)(readyz(checker, true))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, verbose := r.URL.Query()["verbose"]; verbose {
+			detailed.ServeHTTP(w, r)
+			return
+		}
+		brief.ServeHTTP(w, r)
+	}
+}
+
+func readyz(checker *health.Checker, verbose bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := &health.Report{Status: health.StatusOK, Checks: []health.CheckResult{}}
+		if checker != nil {
+			report = checker.Run(r.Context(), verbose)
+		}
+
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		utils.WriteJSON(w, status, report)
 	}
 }
@@ -1,16 +1,36 @@
 package routes
 
-import "github.com/go-chi/chi/v5"
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/health"
+	"github.com/gsn_manager_service/src/server/middlewares"
+)
 
-// Setup all the routes here
-func SetupRoutes(r *chi.Mux) {
-	r.Get("/healthz", Healthz)
+// Setup all the routes here. ready gates the task routes, nil means always ready.
+// Liveness and brief readiness stay public, the task routes need an API key
+// unless auth is nil.
+func SetupRoutes(r *chi.Mux, tasks *TaskHandler, idempotency middlewares.IdempotencyStore, ready func() bool, checker *health.Checker, auth *middlewares.APIKeyAuth) {
+	r.Get("/healthz", Healthz(tasks.Logger))
+	r.Get("/livez", Healthz(tasks.Logger))
+	r.Get("/readyz", Readyz(checker, auth))
+
+	withIdempotency := middlewares.Idempotency(idempotency, tasks.Logger)
 
 	r.Route("/tasks", func(r chi.Router) {
-		r.Post("/new", CreateNewTask)
-		r.Get("/all", RetrieveAllTasks)
-		r.Get("/{id}", GetSingleTask)
-		r.Put("/{id}", UpdateTask)
-		r.Delete("/{id}", RemoveTaskById)
+		r.Use(middlewares.Readiness(ready))
+		r.Use(auth.RequireByMethod())
+		r.Patch("/", tasks.UpdateTasksByFilter)
+		r.Delete("/", tasks.DeleteTasksByFilter)
+		r.With(withIdempotency).Post("/new", tasks.CreateNewTask)
+		r.With(withIdempotency).Post("/bulk", tasks.BulkTasks)
+		r.Get("/all", tasks.RetrieveAllTasks)
+		r.Get("/trash", tasks.RetrieveTrashedTasks)
+		r.Get("/{id}", tasks.GetSingleTask)
+		r.Put("/{id}", tasks.UpdateTask)
+		r.Patch("/{id}", tasks.PatchTask)
+		r.Delete("/{id}", tasks.RemoveTaskById)
+		r.Post("/{id}/restore", tasks.RestoreTask)
+		r.Get("/{id}/history", tasks.GetTaskHistory)
+		r.Delete("/{id}/permanent", tasks.PurgeTaskById)
 	})
 }
@@ -1,121 +1,229 @@
 package routes
 
 import (
-	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"unicode/utf8"
+	"slices"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/validator/v10"
-	"github.com/gsn_manager_service/src/adapters"
 	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/services"
 	"github.com/gsn_manager_service/src/utils"
+	"github.com/rs/zerolog"
 )
 
-func CreateNewTask(w http.ResponseWriter, r *http.Request) {
-	var payload db.CreateNewTask
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		adapters.Logger.Error().Msg(fmt.Sprintf("Invalid payload -> Error: %v", err))
-		utils.WriteError(w, http.StatusBadRequest, "Invalid payload")
-		return
-	}
+// TaskHandler serves the task endpoints on top of a TaskService
+type TaskHandler struct {
+	Service services.TaskService
+	Logger  zerolog.Logger
+}
+
+func NewTaskHandler(service services.TaskService, logger zerolog.Logger) *TaskHandler {
+	return &TaskHandler{Service: service, Logger: logger}
+}
 
-	// Validate required fields
-	if err := utils.Validate.Struct(payload); err != nil {
-		errs := err.(validator.ValidationErrors)
-		msg := ""
-		for _, e := range errs {
-			if utf8.RuneCountInString(msg) > 0 {
-				msg += " | "
-			}
-			msg += fmt.Sprintf("%s is %s", e.Field(), e.Tag())
-		}
-		utils.WriteError(w, http.StatusBadRequest, msg)
+func (h *TaskHandler) CreateNewTask(w http.ResponseWriter, r *http.Request) {
+	var payload db.CreateNewTask
+	if err := utils.DecodeAndValidate(w, r, &payload); err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
-	newTask, err := db.TaskRepo.CreateTodo(r.Context(), &payload)
+	newTask, err := h.Service.Create(r.Context(), &payload)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to create task")
+		h.writeError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", utils.ETag(newTask.Version))
 	utils.WriteJSON(w, http.StatusCreated, newTask)
 }
 
-func RetrieveAllTasks(w http.ResponseWriter, r *http.Request) {
-	allTasks, err := db.TaskRepo.GetAllTasks(r.Context())
+func (h *TaskHandler) RetrieveAllTasks(w http.ResponseWriter, r *http.Request) {
+	h.listTasks(w, r, false)
+}
+
+func (h *TaskHandler) RetrieveTrashedTasks(w http.ResponseWriter, r *http.Request) {
+	h.listTasks(w, r, true)
+}
+
+// listTasks serves one page of either live or trashed tasks
+func (h *TaskHandler) listTasks(w http.ResponseWriter, r *http.Request, trashed bool) {
+	query, err := db.ParseTaskListQuery(r.URL.Query())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	query.Filter.Trashed = trashed
 
+	page, err := h.Service.List(r.Context(), query)
 	if err != nil {
-		adapters.Logger.Error().Msg(fmt.Sprintf("Error calling the tasks => %v", err))
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to retrieve all tasks")
+		h.writeError(w, r, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, allTasks)
+	utils.WriteJSON(w, http.StatusOK, page)
 }
 
-func GetSingleTask(w http.ResponseWriter, r *http.Request) {
+func (h *TaskHandler) GetSingleTask(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	task, err := db.TaskRepo.GetTaskById(r.Context(), id)
+	task, err := h.Service.Get(r.Context(), id)
 	if err != nil {
-		msg := fmt.Sprintf("Failed to find a task with ID: %s | Error => %v", id, err.Error())
-		adapters.Logger.Error().Msg(msg)
-		utils.WriteError(w, http.StatusBadRequest, msg)
+		h.writeError(w, r, err)
+		return
+	}
+
+	etag := utils.ETag(task.Version)
+	w.Header().Set("ETag", etag)
+	if utils.IfNoneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, task)
 }
 
-func UpdateTask(w http.ResponseWriter, r *http.Request) {
+func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	var payload db.UpdateTask
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		adapters.Logger.Error().Msg(fmt.Sprintf("Invalid payload -> Error: %v", err.Error()))
-		utils.WriteError(w, http.StatusBadRequest, "Invalid payload")
+	expectedVersion, err := h.ifMatch(r, id)
+	if err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
-	if err := utils.Validate.Struct(payload); err != nil {
-		errs := err.(validator.ValidationErrors)
-		msg := ""
-		for _, e := range errs {
-			if utf8.RuneCountInString(msg) > 0 {
-				msg += " | "
-			}
-			msg += fmt.Sprintf("%s is %s", e.Field(), e.Tag())
-		}
-		message := fmt.Sprintf("Failed to update task with ID: %s. Error => ", id)
-		utils.WriteError(w, http.StatusBadRequest, message+msg)
+	var payload db.CreateNewTask
+	if err := utils.DecodeAndValidate(w, r, &payload); err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
-	updatedTask, err := db.TaskRepo.ModifyTask(r.Context(), id, &payload)
+	updatedTask, err := h.Service.Replace(r.Context(), id, &payload, expectedVersion)
 	if err != nil {
-		msg := fmt.Sprintf("Failed to update task with ID: %s | Error => %v", id, err.Error())
-		adapters.Logger.Error().Msg(msg)
-		utils.WriteError(w, http.StatusBadRequest, msg)
+		h.writeError(w, r, err)
 		return
 	}
 
+	w.Header().Set("ETag", utils.ETag(updatedTask.Version))
 	utils.WriteJSON(w, http.StatusOK, &updatedTask)
 }
 
-func RemoveTaskById(w http.ResponseWriter, r *http.Request) {
+// PatchTask applies a merge patch or JSON patch to a task
+func (h *TaskHandler) PatchTask(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	// ? The format is checked first, a body that can not be applied is not worth reading
+	if _, err := utils.PatchMediaType(r.Header.Get("Content-Type")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	expectedVersion, err := h.ifMatch(r, id)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, utils.MaxPayloadBytes))
+	if err != nil {
+		h.writeError(w, r, &utils.DecodeError{Msg: "request body could not be read"})
+		return
+	}
+
+	patchedTask, err := h.Service.Patch(r.Context(), id, expectedVersion, r.Header.Get("Content-Type"), body)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", utils.ETag(patchedTask.Version))
+	utils.WriteJSON(w, http.StatusOK, patchedTask)
+}
+
+func (h *TaskHandler) RemoveTaskById(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	expectedVersion, err := h.ifMatch(r, id)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	if err := h.Service.Delete(r.Context(), id, expectedVersion); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{
+		"message": fmt.Sprintf("Successfully moved task with ID: %s to the trash", id),
+	})
+}
+
+// ifMatch returns the version a write must find the task at, following the
+// If-Match header. When it lists several versions the current task is read, and
+// its version is expected if listed, so a change made in between still fails.
+func (h *TaskHandler) ifMatch(r *http.Request, id string) (*int64, error) {
+	versions, err := utils.ParseIfMatch(r.Header.Get("If-Match"))
+	if err != nil || len(versions) == 0 {
+		return nil, err
+	}
+	if len(versions) == 1 {
+		return &versions[0], nil
+	}
+
+	task, err := h.Service.Get(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(versions, task.Version) {
+		return nil, utils.ErrPreconditionFailed
+	}
+
+	return &task.Version, nil
+}
+
+func (h *TaskHandler) RestoreTask(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	taskId, err := db.TaskRepo.DeleteTask(r.Context(), id)
+	task, err := h.Service.Restore(r.Context(), id)
 	if err != nil {
-		msg := fmt.Sprintf("Failed to remove task with ID: %s | Error => %v", id, err.Error())
-		utils.WriteError(w, http.StatusBadRequest, msg)
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", utils.ETag(task.Version))
+	utils.WriteJSON(w, http.StatusOK, task)
+}
+
+func (h *TaskHandler) PurgeTaskById(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := h.Service.Purge(r.Context(), id); err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, map[string]string{
-		"message": fmt.Sprintf("Successfully removed task with ID: %s", taskId.Hex()),
+		"message": fmt.Sprintf("Permanently removed task with ID: %s", id),
 	})
 }
+
+func (h *TaskHandler) GetTaskHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	query, err := db.ParseHistoryQuery(r.URL.Query())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	page, err := h.Service.History(r.Context(), id, query)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, page)
+}
@@ -5,16 +5,63 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
 	"github.com/gsn_manager_service/src/config"
+	"github.com/gsn_manager_service/src/health"
+	"github.com/gsn_manager_service/src/metrics"
 	"github.com/gsn_manager_service/src/server/middlewares"
 	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/tracing"
+	"github.com/rs/zerolog"
 )
 
-func StartServer(cfg *config.Config) *http.Server {
+// Dependencies holds everything the HTTP layer needs, built once at startup
+type Dependencies struct {
+	Tasks       services.TaskService
+	Idempotency middlewares.IdempotencyStore
+	// Ready reports whether requests can be served, nil means always
+	Ready  func() bool
+	Health *health.Checker
+	// Metrics records the requests when set
+	Metrics *metrics.Metrics
+	// Tracing opens a span for every request when set
+	Tracing *tracing.Tracing
+	// LogLevels can be changed through the admin endpoints when set
+	LogLevels *adapters.LogLevels
+	// SlowQueries is reported by the admin endpoints when set
+	SlowQueries *adapters.SlowQueries
+	// APIKeys authenticates the task and admin routes when set, and is managed
+	// through the admin endpoints
+	APIKeys services.APIKeyService
+	Logger  zerolog.Logger
+}
+
+func StartServer(cfg *config.Config, deps Dependencies) *http.Server {
 	r := chi.NewRouter()
-	middlewares.SetupMiddleware(r)
+	if deps.Tracing != nil {
+		r.Use(deps.Tracing.Middleware)
+	}
+	middlewares.SetupMiddleware(r, deps.Logger, middlewares.AccessLogOptions{
+		SampleRate: cfg.ACCESS_LOG_SAMPLE_RATE,
+		Exclude:    cfg.ACCESS_LOG_EXCLUDE,
+	})
+	var auth *middlewares.APIKeyAuth
+	if deps.APIKeys != nil {
+		auth = middlewares.NewAPIKeyAuth(deps.APIKeys)
+	}
+
+	if deps.Metrics != nil {
+		r.Use(deps.Metrics.Middleware)
+		// ? On the public port the metrics need the admin scope, METRICS_PORT keeps them on a listener of their own
+		if cfg.METRICS_PORT == 0 {
+			r.With(auth.Require(db.ScopeAdmin)).Handle(cfg.METRICS_PATH, deps.Metrics.Handler())
+		}
+	}
 
-	routes.SetupRoutes(r)
+	routes.SetupRoutes(r, routes.NewTaskHandler(deps.Tasks, deps.Logger), deps.Idempotency, deps.Ready, deps.Health, auth)
+	routes.SetupAdminRoutes(r, &routes.AdminHandler{LogLevels: deps.LogLevels, SlowQueries: deps.SlowQueries, APIKeys: deps.APIKeys, Logger: deps.Logger}, auth)
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.PORT),
@@ -23,3 +70,15 @@ func StartServer(cfg *config.Config) *http.Server {
 
 	return server
 }
+
+// StartMetricsServer builds the admin server exposing the metrics on a port of
+// their own, which keeps them out of reach of the public traffic
+func StartMetricsServer(cfg *config.Config, m *metrics.Metrics) *http.Server {
+	r := chi.NewRouter()
+	r.Handle(cfg.METRICS_PATH, m.Handler())
+
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.METRICS_PORT),
+		Handler: r,
+	}
+}
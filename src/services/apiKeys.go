@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	// apiKeyPrefix starts every secret, so leaked keys are easy to spot
+	apiKeyPrefix = "gsn_"
+	// apiKeyShownPrefix is the length of the part of the secret kept in clear
+	apiKeyShownPrefix = len(apiKeyPrefix) + 8
+	// touchInterval limits how often the last use of a key is written
+	touchInterval = time.Minute
+)
+
+// ? Errors of Authenticate, all of them mean the caller is not authenticated
+var (
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	ErrAPIKeyExpired = errors.New("API key has expired")
+	ErrAPIKeyRevoked = errors.New("API key has been revoked")
+)
+
+// APIKeyService manages the API keys and checks the ones presented by callers.
+// Secrets are only returned when a key is created or rotated, never stored.
+type APIKeyService interface {
+	Create(ctx context.Context, payload *db.CreateAPIKey) (*db.APIKey, string, error)
+	List(ctx context.Context) ([]db.APIKey, error)
+	Rotate(ctx context.Context, id string) (*db.APIKey, string, error)
+	Revoke(ctx context.Context, id string) (*db.APIKey, error)
+	Authenticate(ctx context.Context, secret string) (*db.APIKey, error)
+}
+
+type apiKeyService struct {
+	store db.APIKeyStore
+}
+
+func NewAPIKeyService(store db.APIKeyStore) APIKeyService {
+	return &apiKeyService{store: store}
+}
+
+func (s *apiKeyService) Create(ctx context.Context, payload *db.CreateAPIKey) (*db.APIKey, string, error) {
+	now := time.Now().UTC()
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(now) {
+		return nil, "", &utils.ValidationError{Errors: []utils.FieldError{{
+			Field: "expires_at", Rule: "future", Message: "expires_at must be in the future",
+		}}}
+	}
+
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &db.APIKey{
+		ID:        bson.NewObjectID(),
+		Name:      payload.Name,
+		Prefix:    secret[:apiKeyShownPrefix],
+		Hash:      hashAPIKey(secret),
+		Scopes:    payload.Scopes,
+		CreatedAt: now,
+		ExpiresAt: payload.ExpiresAt,
+	}
+	if err := s.store.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+func (s *apiKeyService) List(ctx context.Context) ([]db.APIKey, error) {
+	return s.store.ListAPIKeys(ctx)
+}
+
+// Rotate gives a key a new secret, keeping its name, scopes and expiry. Revoked keys cannot be rotated.
+func (s *apiKeyService) Rotate(ctx context.Context, id string) (*db.APIKey, string, error) {
+	current, err := s.store.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if current.RevokedAt != nil {
+		return nil, "", &db.RepositoryError{Kind: db.KindConflict, Op: "RotateAPIKey", Detail: "API key has been revoked"}
+	}
+
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key, err := s.store.ReplaceAPIKeySecret(ctx, id, secret[:apiKeyShownPrefix], hashAPIKey(secret))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, id string) (*db.APIKey, error) {
+	return s.store.RevokeAPIKey(ctx, id, time.Now().UTC())
+}
+
+// Authenticate returns the key matching secret when it can be used. Its last
+// use is recorded at most once per touchInterval, and a failure to record it
+// does not fail the request.
+func (s *apiKeyService) Authenticate(ctx context.Context, secret string) (*db.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.store.FindAPIKeyByHash(ctx, hashAPIKey(secret))
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case key.RevokedAt != nil:
+		return nil, ErrAPIKeyRevoked
+	case key.Expired(now):
+		return nil, ErrAPIKeyExpired
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		if err := s.store.TouchAPIKey(ctx, key.ID, now); err == nil {
+			key.LastUsedAt = &now
+		}
+	}
+
+	return key, nil
+}
+
+// newAPIKeySecret returns a random secret carrying 256 bits of entropy
+func newAPIKeySecret() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// hashAPIKey hashes a secret for storage. Secrets are random and long, so a
+// fast hash is enough and lets keys be looked up by their hash.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"cmp"
+	"encoding/json"
+	"reflect"
+	"slices"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/utils"
+)
+
+// ? JSON names of the task fields a patch may change, every other field is read-only
+var patchableTaskFields = []string{"title", "completed", "timestamp"}
+
+// taskPatchFromDocument compares a task document before and after a patch. Changes
+// to read-only fields are rejected, and so are editable fields left out or set to
+// null since every task has them. The others are validated with the rules of db.UpdateTask.
+func taskPatchFromDocument(original, patched []byte) (*db.TaskPatch, error) {
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(original, &before); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil || after == nil {
+		return nil, &utils.PatchError{Msg: "patch must leave the task a JSON object"}
+	}
+
+	var fieldErrs []utils.FieldError
+	for field, value := range after {
+		if slices.Contains(patchableTaskFields, field) {
+			continue
+		}
+		if _, known := before[field]; !known {
+			fieldErrs = append(fieldErrs, utils.FieldError{Field: field, Rule: "unknown", Message: field + " is not a task field"})
+		} else if !sameJSON(before[field], value) {
+			fieldErrs = append(fieldErrs, utils.FieldError{Field: field, Rule: "readonly", Message: field + " can not be changed"})
+		}
+	}
+	for field := range before {
+		if _, kept := after[field]; !kept && !slices.Contains(patchableTaskFields, field) {
+			fieldErrs = append(fieldErrs, utils.FieldError{Field: field, Rule: "readonly", Message: field + " can not be removed"})
+		}
+	}
+	for _, field := range patchableTaskFields {
+		if value, ok := after[field]; !ok || string(value) == "null" {
+			fieldErrs = append(fieldErrs, utils.FieldError{Field: field, Rule: "required", Message: field + " can not be removed"})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		slices.SortFunc(fieldErrs, func(a, b utils.FieldError) int { return cmp.Compare(a.Field, b.Field) })
+		return nil, &utils.ValidationError{Errors: fieldErrs}
+	}
+
+	patch := &db.TaskPatch{}
+	editable := make(map[string]json.RawMessage, len(patchableTaskFields))
+	for _, field := range patchableTaskFields {
+		editable[field] = after[field]
+	}
+
+	raw, err := json.Marshal(editable)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.UnmarshalStrict(raw, &patch.Set); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateStruct(&patch.Set); err != nil {
+		return nil, err
+	}
+
+	return patch, nil
+}
+
+// sameJSON reports whether two JSON values are equal regardless of formatting
+func sameJSON(a, b json.RawMessage) bool {
+	var left, right any
+	if json.Unmarshal(a, &left) != nil || json.Unmarshal(b, &right) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(left, right)
+}
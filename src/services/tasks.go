@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/utils"
+)
+
+// TaskService holds the task use cases served over HTTP. Handlers only talk to
+// this interface, the storage behind it is reached through db.TaskStore.
+type TaskService interface {
+	Create(ctx context.Context, payload *db.CreateNewTask) (*db.Tasks, error)
+	List(ctx context.Context, query *db.TaskListQuery) (*db.TaskPage, error)
+	Get(ctx context.Context, id string) (*db.Tasks, error)
+	Replace(ctx context.Context, id string, payload *db.CreateNewTask, expectedVersion *int64) (*db.Tasks, error)
+	Patch(ctx context.Context, id string, expectedVersion *int64, contentType string, patch []byte) (*db.Tasks, error)
+	Delete(ctx context.Context, id string, expectedVersion *int64) error
+	Restore(ctx context.Context, id string) (*db.Tasks, error)
+	Purge(ctx context.Context, id string) error
+	History(ctx context.Context, id string, query *db.HistoryQuery) (*db.HistoryPage, error)
+	Bulk(ctx context.Context, ops []db.BulkOperation, opts db.BulkOptions) ([]db.BulkItemResult, error)
+	UpdateByFilter(ctx context.Context, query *db.TaskWriteQuery, payload *db.UpdateTask) (*db.FilterWriteResult, error)
+	DeleteByFilter(ctx context.Context, query *db.TaskWriteQuery) (*db.FilterWriteResult, error)
+}
+
+type taskService struct {
+	store   db.TaskStore
+	history db.HistoryStore
+	cursors *db.CursorCodec
+}
+
+func NewTaskService(store db.TaskStore, history db.HistoryStore, cursors *db.CursorCodec) TaskService {
+	return &taskService{store: store, history: history, cursors: cursors}
+}
+
+func (s *taskService) Create(ctx context.Context, payload *db.CreateNewTask) (*db.Tasks, error) {
+	return s.store.CreateTodo(ctx, payload)
+}
+
+// List verifies the cursor of the query, if any, and fills in the cursors of the returned page
+func (s *taskService) List(ctx context.Context, query *db.TaskListQuery) (*db.TaskPage, error) {
+	if query.CursorToken != "" {
+		cursor, err := s.cursors.Decode(query.CursorToken, query)
+		if err != nil {
+			return nil, err
+		}
+		query.Cursor = cursor
+	}
+
+	page, err := s.store.GetAllTasks(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cursors.Paginate(query, page)
+	return page, nil
+}
+
+func (s *taskService) Get(ctx context.Context, id string) (*db.Tasks, error) {
+	return s.store.GetTaskById(ctx, id)
+}
+
+func (s *taskService) Replace(ctx context.Context, id string, payload *db.CreateNewTask, expectedVersion *int64) (*db.Tasks, error) {
+	return s.store.ReplaceTask(ctx, id, payload, expectedVersion)
+}
+
+// Patch applies a merge patch or JSON patch to the current version of a task
+func (s *taskService) Patch(ctx context.Context, id string, expectedVersion *int64, contentType string, patch []byte) (*db.Tasks, error) {
+	return s.store.PatchTask(ctx, id, expectedVersion, func(current *db.Tasks) (*db.TaskPatch, error) {
+		document, err := json.Marshal(current)
+		if err != nil {
+			return nil, err
+		}
+
+		patched, err := utils.ApplyPatch(contentType, document, patch)
+		if err != nil {
+			return nil, err
+		}
+
+		return taskPatchFromDocument(document, patched)
+	})
+}
+
+func (s *taskService) Delete(ctx context.Context, id string, expectedVersion *int64) error {
+	_, err := s.store.DeleteTask(ctx, id, expectedVersion)
+	return err
+}
+
+func (s *taskService) Restore(ctx context.Context, id string) (*db.Tasks, error) {
+	return s.store.RestoreTask(ctx, id)
+}
+
+func (s *taskService) Purge(ctx context.Context, id string) error {
+	_, err := s.store.PurgeTask(ctx, id)
+	return err
+}
+
+func (s *taskService) History(ctx context.Context, id string, query *db.HistoryQuery) (*db.HistoryPage, error) {
+	return s.history.ListByTask(ctx, id, query)
+}
+
+func (s *taskService) Bulk(ctx context.Context, ops []db.BulkOperation, opts db.BulkOptions) ([]db.BulkItemResult, error) {
+	return s.store.BulkWrite(ctx, ops, opts)
+}
+
+// UpdateByFilter applies payload to the tasks matching the query, or only previews them on a dry run
+func (s *taskService) UpdateByFilter(ctx context.Context, query *db.TaskWriteQuery, payload *db.UpdateTask) (*db.FilterWriteResult, error) {
+	if query.DryRun {
+		return s.store.PreviewByFilter(ctx, query.Filter)
+	}
+
+	return s.store.UpdateByFilter(ctx, query.Filter, payload)
+}
+
+// DeleteByFilter trashes the tasks matching the query, or only previews them on a dry run
+func (s *taskService) DeleteByFilter(ctx context.Context, query *db.TaskWriteQuery) (*db.FilterWriteResult, error) {
+	if query.DryRun {
+		return s.store.PreviewByFilter(ctx, query.Filter)
+	}
+
+	return s.store.DeleteByFilter(ctx, query.Filter)
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ? Identifies a command between its started and finished events
+type commandKey struct {
+	connection string
+	request    int64
+}
+
+// CommandMonitor opens a client span for every command the Mongo driver sends
+// on behalf of a traced operation, so repository calls show up as children of
+// the request span. Commands run outside of a trace, like startup migrations
+// or pings, are not recorded.
+func (t *Tracing) CommandMonitor() *event.CommandMonitor {
+	var spans sync.Map
+
+	finish := func(key commandKey, err error) {
+		value, ok := spans.LoadAndDelete(key)
+		if !ok {
+			return
+		}
+
+		span := value.(trace.Span)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				return
+			}
+
+			attrs := []trace.SpanStartOption{
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemNameMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+				),
+			}
+
+			name := e.CommandName
+			if collection := commandCollection(e.Command, e.CommandName); collection != "" {
+				name += " " + collection
+				attrs = append(attrs, trace.WithAttributes(semconv.DBCollectionName(collection)))
+			}
+
+			_, span := t.tracer.Start(ctx, name, attrs...)
+			spans.Store(commandKey{e.ConnectionID, e.RequestID}, span)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(commandKey{e.ConnectionID, e.RequestID}, nil)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(commandKey{e.ConnectionID, e.RequestID}, e.Failure)
+		},
+	}
+}
+
+// commandCollection returns the collection a command targets, which Mongo
+// sends as the value of the command name, e.g. {find: "tasks", ...}
+func commandCollection(command bson.Raw, name string) string {
+	value, err := command.LookupErr(name)
+	if err != nil {
+		return ""
+	}
+
+	collection, ok := value.StringValueOK()
+	if !ok {
+		return ""
+	}
+
+	return collection
+}
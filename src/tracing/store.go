@@ -0,0 +1,168 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TaskStore opens a span for every operation of the wrapped store. With Mongo
+// the spans of the driver commands are nested under it, the other backends
+// only have this one.
+type TaskStore struct {
+	next    db.TaskStore
+	tracing *Tracing
+	backend string
+}
+
+// HistoryStore opens a span for every operation of the wrapped store
+type HistoryStore struct {
+	next    db.HistoryStore
+	tracing *Tracing
+	backend string
+}
+
+var (
+	_ db.TaskStore    = (*TaskStore)(nil)
+	_ db.HistoryStore = (*HistoryStore)(nil)
+)
+
+// InstrumentTaskStore wraps store, backend is the STORAGE_BACKEND it belongs to
+func (t *Tracing) InstrumentTaskStore(store db.TaskStore, backend string) *TaskStore {
+	return &TaskStore{next: store, tracing: t, backend: backend}
+}
+
+// InstrumentHistoryStore wraps store, backend is the STORAGE_BACKEND it belongs to
+func (t *Tracing) InstrumentHistoryStore(store db.HistoryStore, backend string) *HistoryStore {
+	return &HistoryStore{next: store, tracing: t, backend: backend}
+}
+
+// startStore opens the span of a store operation. Like the driver commands,
+// operations run outside of a trace, such as the trash purge, are not recorded.
+func (t *Tracing) startStore(ctx context.Context, store, backend, operation string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	return t.tracer.Start(ctx, store+"."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			attribute.String("storage.backend", backend),
+			semconv.DBOperationName(operation),
+		),
+	)
+}
+
+// endStore closes the span of a store operation. Errors the client caused, like
+// a missing task, are only labelled with their kind, the others fail the span.
+func endStore(span trace.Span, err error) {
+	if err != nil {
+		var repoErr *db.RepositoryError
+		switch {
+		case errors.As(err, &repoErr) && repoErr.Kind != db.KindUnavailable:
+			span.SetAttributes(semconv.ErrorTypeKey.String(string(repoErr.Kind)))
+		default:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+	span.End()
+}
+
+func (s *TaskStore) CreateTodo(ctx context.Context, payload *db.CreateNewTask) (task *db.Tasks, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "CreateTodo")
+	defer func() { endStore(span, err) }()
+	return s.next.CreateTodo(ctx, payload)
+}
+
+func (s *TaskStore) GetAllTasks(ctx context.Context, query *db.TaskListQuery) (page *db.TaskPage, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "GetAllTasks")
+	defer func() { endStore(span, err) }()
+	return s.next.GetAllTasks(ctx, query)
+}
+
+func (s *TaskStore) GetTaskById(ctx context.Context, id string) (task *db.Tasks, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "GetTaskById")
+	defer func() { endStore(span, err) }()
+	return s.next.GetTaskById(ctx, id)
+}
+
+func (s *TaskStore) ModifyTask(ctx context.Context, id string, payload *db.UpdateTask, expectedVersion *int64) (task *db.Tasks, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "ModifyTask")
+	defer func() { endStore(span, err) }()
+	return s.next.ModifyTask(ctx, id, payload, expectedVersion)
+}
+
+func (s *TaskStore) ReplaceTask(ctx context.Context, id string, payload *db.CreateNewTask, expectedVersion *int64) (task *db.Tasks, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "ReplaceTask")
+	defer func() { endStore(span, err) }()
+	return s.next.ReplaceTask(ctx, id, payload, expectedVersion)
+}
+
+func (s *TaskStore) PatchTask(ctx context.Context, id string, expectedVersion *int64, build func(*db.Tasks) (*db.TaskPatch, error)) (task *db.Tasks, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "PatchTask")
+	defer func() { endStore(span, err) }()
+	return s.next.PatchTask(ctx, id, expectedVersion, build)
+}
+
+func (s *TaskStore) DeleteTask(ctx context.Context, id string, expectedVersion *int64) (deleted bson.ObjectID, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "DeleteTask")
+	defer func() { endStore(span, err) }()
+	return s.next.DeleteTask(ctx, id, expectedVersion)
+}
+
+func (s *TaskStore) RestoreTask(ctx context.Context, id string) (task *db.Tasks, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "RestoreTask")
+	defer func() { endStore(span, err) }()
+	return s.next.RestoreTask(ctx, id)
+}
+
+func (s *TaskStore) PurgeTask(ctx context.Context, id string) (purged bson.ObjectID, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "PurgeTask")
+	defer func() { endStore(span, err) }()
+	return s.next.PurgeTask(ctx, id)
+}
+
+func (s *TaskStore) PurgeTrash(ctx context.Context, cutoff time.Time) (purged int64, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "PurgeTrash")
+	defer func() { endStore(span, err) }()
+	return s.next.PurgeTrash(ctx, cutoff)
+}
+
+func (s *TaskStore) BulkWrite(ctx context.Context, ops []db.BulkOperation, opts db.BulkOptions) (results []db.BulkItemResult, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "BulkWrite")
+	span.SetAttributes(attribute.Int("bulk.operations", len(ops)))
+	defer func() { endStore(span, err) }()
+	return s.next.BulkWrite(ctx, ops, opts)
+}
+
+func (s *TaskStore) PreviewByFilter(ctx context.Context, filter db.TaskFilter) (result *db.FilterWriteResult, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "PreviewByFilter")
+	defer func() { endStore(span, err) }()
+	return s.next.PreviewByFilter(ctx, filter)
+}
+
+func (s *TaskStore) UpdateByFilter(ctx context.Context, filter db.TaskFilter, payload *db.UpdateTask) (result *db.FilterWriteResult, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "UpdateByFilter")
+	defer func() { endStore(span, err) }()
+	return s.next.UpdateByFilter(ctx, filter, payload)
+}
+
+func (s *TaskStore) DeleteByFilter(ctx context.Context, filter db.TaskFilter) (result *db.FilterWriteResult, err error) {
+	ctx, span := s.tracing.startStore(ctx, "TaskStore", s.backend, "DeleteByFilter")
+	defer func() { endStore(span, err) }()
+	return s.next.DeleteByFilter(ctx, filter)
+}
+
+func (s *HistoryStore) ListByTask(ctx context.Context, id string, query *db.HistoryQuery) (page *db.HistoryPage, err error) {
+	ctx, span := s.tracing.startStore(ctx, "HistoryStore", s.backend, "ListByTask")
+	defer func() { endStore(span, err) }()
+	return s.next.ListByTask(ctx, id, query)
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters selectable with TRACING_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+const instrumentationName = "github.com/gsn_manager_service"
+
+// Options selects where spans are sent and how many of them are kept
+type Options struct {
+	Exporter    string
+	ServiceName string
+	// Endpoint of the OTLP/HTTP collector, e.g. localhost:4318. The exporter
+	// falls back to OTEL_EXPORTER_OTLP_ENDPOINT and its own default when empty.
+	Endpoint string
+	Insecure bool
+	// SampleRatio is the share of new traces recorded, traces started upstream
+	// follow the decision of their parent
+	SampleRatio float64
+}
+
+// Tracing owns the tracer provider of the service along with the propagator
+// used to continue traces from incoming requests
+type Tracing struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New builds the tracing of the configured exporter. It returns nil when the
+// exporter is none, callers then leave the service uninstrumented.
+func New(ctx context.Context, opts Options) (*Tracing, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch opts.Exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	case ExporterOTLP:
+		clientOpts := []otlptracehttp.Option{}
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	default:
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newTracing(opts, sdktrace.WithBatcher(exporter)), nil
+}
+
+// NewWithExporter sends every span to exporter as soon as it ends, which lets
+// tests read them from an in-memory exporter
+func NewWithExporter(exporter sdktrace.SpanExporter, opts Options) *Tracing {
+	return newTracing(opts, sdktrace.WithSyncer(exporter))
+}
+
+func newTracing(opts Options, export sdktrace.TracerProviderOption) *Tracing {
+	ratio := opts.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(opts.ServiceName))),
+	)
+
+	return &Tracing{
+		provider:   provider,
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+}
+
+// Install makes the provider and the W3C propagator the global ones, so
+// outgoing calls instrumented by libraries carry the traceparent too
+func (t *Tracing) Install() {
+	otel.SetTracerProvider(t.provider)
+	otel.SetTextMapPropagator(t.propagator)
+}
+
+// Shutdown flushes the spans still buffered and stops the exporter
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
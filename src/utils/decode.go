@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const MaxPayloadBytes = 1 << 20
+
+// DecodeError reports a request body that is not an acceptable JSON payload.
+// Its message is written for clients and never contains Go type names.
+type DecodeError struct {
+	Msg string
+}
+
+func (e *DecodeError) Error() string {
+	return e.Msg
+}
+
+// DecodeJSON strictly decodes a single JSON value from the request body into dst,
+// rejecting unknown fields, trailing data and oversized bodies
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	return decodeStrict(http.MaxBytesReader(w, r.Body, MaxPayloadBytes), dst)
+}
+
+// UnmarshalStrict decodes a JSON value embedded in a larger payload with the same rules as DecodeJSON
+func UnmarshalStrict(data []byte, dst any) error {
+	return decodeStrict(bytes.NewReader(data), dst)
+}
+
+func decodeStrict(r io.Reader, dst any) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return &DecodeError{Msg: "request body must contain a single JSON value"}
+	}
+
+	return nil
+}
+
+// DecodeAndValidate decodes the request body into dst and runs its validate tags
+func DecodeAndValidate(w http.ResponseWriter, r *http.Request, dst any) error {
+	if err := DecodeJSON(w, r, dst); err != nil {
+		return err
+	}
+
+	return ValidateStruct(dst)
+}
+
+func decodeError(err error) error {
+	var (
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		maxBytesErr *http.MaxBytesError
+		timeErr     *time.ParseError
+	)
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Msg: "request body must not be empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Msg: "request body contains malformed JSON"}
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Msg: fmt.Sprintf("request body contains malformed JSON at position %d", syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &DecodeError{Msg: fmt.Sprintf("request body must be a JSON object, got %s", typeErr.Value)}
+		}
+		return &DecodeError{Msg: fmt.Sprintf("field %q must not be a JSON %s", typeErr.Field, typeErr.Value)}
+	case errors.As(err, &timeErr):
+		return &DecodeError{Msg: "timestamps must be RFC 3339 strings"}
+	case errors.As(err, &maxBytesErr):
+		return &DecodeError{Msg: fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit)}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return &DecodeError{Msg: "unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	default:
+		return &DecodeError{Msg: "request body could not be decoded"}
+	}
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrPreconditionFailed reports an If-Match header that can not match any version
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// PreconditionError reports a conditional request header that could not be parsed
+type PreconditionError struct {
+	Header string
+	Reason string
+}
+
+func (e *PreconditionError) Error() string {
+	return fmt.Sprintf("invalid %s header: %s", e.Header, e.Reason)
+}
+
+// ETag returns the strong entity tag of a resource version
+func ETag(version int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(version, 10))
+}
+
+// ParseIfMatch returns the versions an If-Match header accepts, or nil when
+// the header is absent or "*". A list of entity tags matches when any of them
+// does (RFC 9110 section 13.1.1). Weak or foreign entity tags never match a
+// version under strong comparison, a header made only of them yields
+// ErrPreconditionFailed.
+func ParseIfMatch(header string) ([]int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return nil, nil
+	}
+
+	var versions []int64
+	for _, tag := range splitEntityTags(header) {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case tag == "":
+			// ? Empty list elements are allowed and ignored
+			continue
+		case tag == "*":
+			return nil, nil
+		case strings.HasPrefix(tag, "W/"):
+			continue
+		}
+
+		unquoted, err := strconv.Unquote(tag)
+		if err != nil || !strings.HasPrefix(tag, `"`) {
+			return nil, &PreconditionError{Header: "If-Match", Reason: "entity tags must be quoted"}
+		}
+
+		if version, err := strconv.ParseInt(unquoted, 10, 64); err == nil {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrPreconditionFailed
+	}
+
+	return versions, nil
+}
+
+// splitEntityTags splits a list of entity tags on the commas outside of quotes,
+// since an entity tag may contain one
+func splitEntityTags(header string) []string {
+	var tags []string
+	quoted, start := false, 0
+	for i, r := range header {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			tags = append(tags, header[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(tags, header[start:])
+}
+
+// IfNoneMatch reports whether an If-None-Match header matches etag, using the
+// weak comparison that RFC 9110 requires for this header
+func IfNoneMatch(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
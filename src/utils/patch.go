@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// AcceptPatch lists the accepted patch formats, as sent in the Accept-Patch header
+const AcceptPatch = MergePatchContentType + ", " + JSONPatchContentType
+
+// ErrUnsupportedPatch reports a PATCH body in a format other than merge patch or JSON patch
+var ErrUnsupportedPatch = errors.New("unsupported patch media type")
+
+// ErrPatchTestFailed reports a JSON patch test operation that did not hold on the current document
+var ErrPatchTestFailed = errors.New("patch test operation failed")
+
+// PatchError reports a well formed patch that can not be applied to the document
+type PatchError struct {
+	Msg string
+}
+
+func (e *PatchError) Error() string {
+	return e.Msg
+}
+
+// PatchMediaType returns the patch format named by a Content-Type header, or
+// ErrUnsupportedPatch when it is neither merge patch nor JSON patch
+func PatchMediaType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != MergePatchContentType && mediaType != JSONPatchContentType) {
+		return "", ErrUnsupportedPatch
+	}
+
+	return mediaType, nil
+}
+
+// ApplyPatch applies a merge patch (RFC 7386) or a JSON patch (RFC 6902) to
+// document, depending on the media type of the request
+func ApplyPatch(contentType string, document, patch []byte) ([]byte, error) {
+	mediaType, err := PatchMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case MergePatchContentType:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(patch, &fields); err != nil || fields == nil {
+			return nil, &DecodeError{Msg: "merge patch must be a JSON object"}
+		}
+
+		return jsonpatch.MergePatch(document, patch)
+	case JSONPatchContentType:
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, &DecodeError{Msg: "JSON patch must be an array of operations"}
+		}
+
+		patched, err := operations.Apply(document)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, ErrPatchTestFailed
+		}
+		if err != nil {
+			return nil, &PatchError{Msg: err.Error()}
+		}
+
+		return patched, nil
+	default:
+		return nil, ErrUnsupportedPatch
+	}
+}
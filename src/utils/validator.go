@@ -1,5 +1,120 @@
 package utils
 
-import "github.com/go-playground/validator/v10"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 
-var Validate = validator.New()
+	"github.com/go-playground/validator/v10"
+)
+
+var Validate = newValidator()
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError holds every field that failed validation on a payload
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Message)
+	}
+
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// newValidator reports fields by their JSON name instead of the Go one
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			return ""
+		case "":
+			return field.Name
+		default:
+			return name
+		}
+	})
+
+	return v
+}
+
+// ValidateStruct runs the validate tags of payload and returns a *ValidationError
+// listing every failed field, or nil when the payload is valid
+func ValidateStruct(payload any) error {
+	err := Validate.Struct(payload)
+	if err == nil {
+		return nil
+	}
+
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return err
+	}
+
+	fields := make([]FieldError, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(e),
+			Rule:    e.Tag(),
+			Param:   e.Param(),
+			Message: fieldMessage(e),
+		})
+	}
+
+	return &ValidationError{Errors: fields}
+}
+
+// fieldPath drops the root struct name from the namespace, leaving the JSON path
+func fieldPath(e validator.FieldError) string {
+	_, path, found := strings.Cut(e.Namespace(), ".")
+	if !found {
+		return e.Field()
+	}
+
+	return path
+}
+
+func fieldMessage(e validator.FieldError) string {
+	field := fieldPath(e)
+
+	unit := ""
+	switch e.Kind() {
+	case reflect.String:
+		unit = " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	}
+
+	switch e.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "min", "gte":
+		return fmt.Sprintf("%s must be at least %s%s", field, e.Param(), unit)
+	case "max", "lte":
+		return fmt.Sprintf("%s must be at most %s%s", field, e.Param(), unit)
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", field, e.Param())
+	case "lt":
+		return fmt.Sprintf("%s must be less than %s", field, e.Param())
+	case "len":
+		return fmt.Sprintf("%s must be exactly %s%s", field, e.Param(), unit)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(e.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field, e.Tag())
+	}
+}
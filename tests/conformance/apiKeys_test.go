@@ -0,0 +1,70 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// runAPIKeyStoreSuite checks that an API key store finds keys by the hash of
+// their secret and keeps rotation, revocation and last use
+func runAPIKeyStoreSuite(t *testing.T, store db.APIKeyStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	expiresAt := now.Add(time.Hour)
+
+	key := &db.APIKey{
+		ID:        bson.NewObjectID(),
+		Name:      "ci",
+		Prefix:    "gsn_abcdefgh",
+		Hash:      "hash-1",
+		Scopes:    []db.APIKeyScope{db.ScopeRead, db.ScopeWrite},
+		CreatedAt: now,
+		ExpiresAt: &expiresAt,
+	}
+	require.NoError(t, store.CreateAPIKey(ctx, key))
+
+	found, err := store.FindAPIKeyByHash(ctx, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, found.ID)
+	assert.Equal(t, key.Scopes, found.Scopes)
+	assert.True(t, expiresAt.Equal(*found.ExpiresAt))
+	assert.Nil(t, found.LastUsedAt)
+
+	_, err = store.FindAPIKeyByHash(ctx, "missing")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = store.GetAPIKey(ctx, "not-an-id")
+	assert.ErrorIs(t, err, db.ErrInvalidID)
+
+	require.NoError(t, store.TouchAPIKey(ctx, key.ID, now))
+	found, err = store.GetAPIKey(ctx, key.ID.Hex())
+	require.NoError(t, err)
+	require.NotNil(t, found.LastUsedAt)
+	assert.True(t, now.Equal(*found.LastUsedAt))
+
+	rotated, err := store.ReplaceAPIKeySecret(ctx, key.ID.Hex(), "gsn_ijklmnop", "hash-2")
+	require.NoError(t, err)
+	assert.Equal(t, "gsn_ijklmnop", rotated.Prefix)
+	_, err = store.FindAPIKeyByHash(ctx, "hash-1")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	revoked, err := store.RevokeAPIKey(ctx, key.ID.Hex(), now)
+	require.NoError(t, err)
+	require.NotNil(t, revoked.RevokedAt)
+	again, err := store.RevokeAPIKey(ctx, key.ID.Hex(), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, now.Equal(*again.RevokedAt))
+
+	_, err = store.ReplaceAPIKeySecret(ctx, key.ID.Hex(), "gsn_qrstuvwx", "hash-3")
+	assert.Error(t, err)
+
+	keys, err := store.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, "ci", keys[0].Name)
+}
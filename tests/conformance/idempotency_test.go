@@ -0,0 +1,92 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idempotencyLease is the reservation lease the stores under test are built with
+const idempotencyLease = 200 * time.Millisecond
+
+// runIdempotencyStoreSuite checks that an idempotency store hands a key out
+// once and replays the stored response afterwards
+func runIdempotencyStoreSuite(t *testing.T, store db.IdempotencyStore) {
+	ctx := context.Background()
+
+	existing, token, err := store.Reserve(ctx, "POST /tasks/new:key-1", "fingerprint")
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+	assert.NotEmpty(t, token)
+
+	existing, other, err := store.Reserve(ctx, "POST /tasks/new:key-1", "other")
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Empty(t, other)
+	assert.Equal(t, "fingerprint", existing.Fingerprint)
+	assert.False(t, existing.Completed)
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	assert.ErrorIs(t, store.Complete(ctx, "POST /tasks/new:key-1", "not-the-token", 201, headers, nil), db.ErrConflict)
+	require.NoError(t, store.Complete(ctx, "POST /tasks/new:key-1", token, 201, headers, []byte(`{"id":"1"}`)))
+
+	existing, _, err = store.Reserve(ctx, "POST /tasks/new:key-1", "fingerprint")
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.True(t, existing.Completed)
+	assert.Equal(t, 201, existing.Status)
+	assert.Equal(t, headers, existing.Headers)
+	assert.Equal(t, `{"id":"1"}`, string(existing.Body))
+
+	require.NoError(t, store.Release(ctx, "POST /tasks/new:key-1", token))
+	existing, _, err = store.Reserve(ctx, "POST /tasks/new:key-1", "fingerprint")
+	require.NoError(t, err)
+	assert.Nil(t, existing)
+
+	// ? key-2 is left reserved as by a crashed request, key-3 is completed
+	_, crashed, err := store.Reserve(ctx, "POST /tasks/new:key-2", "crashed")
+	require.NoError(t, err)
+	_, completed, err := store.Reserve(ctx, "POST /tasks/new:key-3", "fingerprint")
+	require.NoError(t, err)
+	require.NoError(t, store.Complete(ctx, "POST /tasks/new:key-3", completed, 201, headers, []byte(`{"id":"3"}`)))
+
+	existing, _, err = store.Reserve(ctx, "POST /tasks/new:key-2", "retry")
+	require.NoError(t, err)
+	require.NotNil(t, existing, "a reservation within its lease should be kept")
+
+	time.Sleep(idempotencyLease + 50*time.Millisecond)
+
+	existing, retry, err := store.Reserve(ctx, "POST /tasks/new:key-2", "retry")
+	require.NoError(t, err)
+	assert.Nil(t, existing, "a stale reservation should be taken over")
+	assert.NotEqual(t, crashed, retry)
+
+	existing, _, err = store.Reserve(ctx, "POST /tasks/new:key-2", "other")
+	require.NoError(t, err)
+	require.NotNil(t, existing, "a taken over reservation should be held again")
+	assert.Equal(t, "retry", existing.Fingerprint)
+
+	existing, _, err = store.Reserve(ctx, "POST /tasks/new:key-3", "fingerprint")
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.True(t, existing.Completed, "a completed record should not be taken over")
+
+	// ? The request that lost key-2 comes back, it must not touch the retry's reservation
+	assert.ErrorIs(t, store.Complete(ctx, "POST /tasks/new:key-2", crashed, 500, nil, nil), db.ErrConflict)
+	assert.ErrorIs(t, store.Release(ctx, "POST /tasks/new:key-2", crashed), db.ErrConflict)
+
+	existing, _, err = store.Reserve(ctx, "POST /tasks/new:key-2", "retry")
+	require.NoError(t, err)
+	require.NotNil(t, existing, "the retry should still hold the key")
+	assert.False(t, existing.Completed)
+
+	require.NoError(t, store.Complete(ctx, "POST /tasks/new:key-2", retry, 201, headers, []byte(`{"id":"2"}`)))
+	existing, _, err = store.Reserve(ctx, "POST /tasks/new:key-2", "retry")
+	require.NoError(t, err)
+	require.NotNil(t, existing)
+	assert.Equal(t, `{"id":"2"}`, string(existing.Body))
+}
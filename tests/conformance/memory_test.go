@@ -0,0 +1,23 @@
+package conformance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+)
+
+func TestMemoryStore(t *testing.T) {
+	runTaskStoreSuite(t, func(t *testing.T) backend {
+		store := db.NewMemoryStore()
+		return backend{Tasks: store, History: store}
+	})
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	runIdempotencyStoreSuite(t, db.NewMemoryIdempotencyStore(time.Hour, idempotencyLease))
+}
+
+func TestMemoryAPIKeyStore(t *testing.T) {
+	runAPIKeyStoreSuite(t, db.NewMemoryAPIKeyStore())
+}
@@ -0,0 +1,149 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/migrations"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// TestMongoMigrations runs the task migrations on legacy documents of a fresh database
+func TestMongoMigrations(t *testing.T) {
+	client := connectMongo(t)
+	database := client.Database(mongoDatabase(t, client))
+	ctx := context.Background()
+
+	tasks := database.Collection("tasks")
+	_, err := tasks.InsertMany(ctx, []any{
+		bson.M{"title": "Legacy task", "completed": false, "timestamp": time.Now(), "deleted_at": nil},
+		bson.M{"title": "Current task", "completed": true, "timestamp": time.Now(), "created_at": time.Now(), "updated_at": time.Now(), "version": int64(3)},
+	})
+	require.NoError(t, err)
+
+	runner := migrations.NewRunner(database, migrations.TaskMigrations("tasks"), zerolog.Nop())
+
+	t.Run("Should only count the documents on a dry run", func(t *testing.T) {
+		results, err := runner.Up(ctx, 0, true)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		for _, result := range results {
+			assert.Equal(t, int64(1), result.Affected, result.Name)
+			assert.True(t, result.DryRun)
+		}
+
+		statuses, err := runner.Status(ctx)
+		require.NoError(t, err)
+		for _, status := range statuses {
+			assert.Nil(t, status.AppliedAt, status.Name)
+		}
+	})
+
+	t.Run("Should apply pending migrations once", func(t *testing.T) {
+		results, err := runner.Up(ctx, 0, false)
+		require.NoError(t, err)
+		assert.Len(t, results, 3)
+
+		var legacy bson.M
+		require.NoError(t, tasks.FindOne(ctx, bson.M{"title": "Legacy task"}).Decode(&legacy))
+		assert.Equal(t, int64(1), legacy["version"])
+		assert.Contains(t, legacy, "created_at")
+		assert.Contains(t, legacy, "updated_at")
+		assert.NotContains(t, legacy, "deleted_at")
+
+		results, err = runner.Up(ctx, 0, false)
+		require.NoError(t, err)
+		assert.Empty(t, results)
+
+		count, err := database.Collection(migrations.Collection).CountDocuments(ctx, bson.M{})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), count, "the lock document should be released")
+	})
+
+	t.Run("Should roll back down to the target version", func(t *testing.T) {
+		results, err := runner.Down(ctx, 2, false)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		assert.Equal(t, 3, results[0].Version)
+
+		_, err = runner.Down(ctx, 0, false)
+		assert.ErrorContains(t, err, "can not be rolled back")
+	})
+
+	t.Run("Should wait while another replica holds the lock", func(t *testing.T) {
+		other := migrations.NewRunner(database, migrations.TaskMigrations("tasks"), zerolog.Nop())
+		other.Owner = "another-replica"
+		_, err := database.Collection(migrations.Collection).InsertOne(ctx, bson.M{
+			"_id": "lock", "owner": other.Owner, "expires_at": time.Now().Add(time.Minute),
+		})
+		require.NoError(t, err)
+
+		waitCtx, cancel := context.WithTimeout(ctx, 1500*time.Millisecond)
+		defer cancel()
+		_, err = runner.Up(waitCtx, 0, false)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, err = database.Collection(migrations.Collection).UpdateByID(ctx, "lock", bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Second)}})
+		require.NoError(t, err)
+		results, err := runner.Up(ctx, 0, false)
+		require.NoError(t, err)
+		assert.Len(t, results, 1, "an expired lock should be taken over")
+	})
+}
+
+// TestMongoMigrationLock checks the lock is kept while a long step runs
+func TestMongoMigrationLock(t *testing.T) {
+	client := connectMongo(t)
+	database := client.Database(mongoDatabase(t, client))
+	ctx := context.Background()
+	locks := database.Collection(migrations.Collection)
+
+	t.Run("Should extend the lock while a step runs", func(t *testing.T) {
+		var expiries []time.Time
+		slow := func(ctx context.Context, database *mongo.Database, dryRun bool) (int64, error) {
+			for range 3 {
+				time.Sleep(300 * time.Millisecond)
+				var lock struct {
+					ExpiresAt time.Time `bson:"expires_at"`
+				}
+				if err := locks.FindOne(ctx, bson.M{"_id": "lock"}).Decode(&lock); err != nil {
+					return 0, err
+				}
+				expiries = append(expiries, lock.ExpiresAt)
+			}
+			return 0, nil
+		}
+		runner := migrations.NewRunner(database, []migrations.Migration{{Version: 1, Name: "slow", Up: slow}}, zerolog.Nop())
+		runner.LockTTL = 450 * time.Millisecond
+
+		_, err := runner.Up(ctx, 0, false)
+		require.NoError(t, err)
+		require.Len(t, expiries, 3)
+		assert.True(t, expiries[2].After(expiries[0]), "the lock should have been extended")
+	})
+
+	t.Run("Should abort the step when another runner takes the lock", func(t *testing.T) {
+		stolen := func(ctx context.Context, database *mongo.Database, dryRun bool) (int64, error) {
+			_, err := locks.UpdateByID(ctx, "lock", bson.M{"$set": bson.M{"owner": "another-replica", "expires_at": time.Now().Add(time.Minute)}})
+			if err != nil {
+				return 0, err
+			}
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		runner := migrations.NewRunner(database, []migrations.Migration{{Version: 2, Name: "stolen", Up: stolen}}, zerolog.Nop())
+		runner.LockTTL = 300 * time.Millisecond
+
+		_, err := runner.Up(ctx, 0, false)
+		assert.ErrorIs(t, err, migrations.ErrLockLost)
+
+		count, err := locks.CountDocuments(ctx, bson.M{"_id": 2})
+		require.NoError(t, err)
+		assert.Zero(t, count, "an aborted step should not be recorded")
+	})
+}
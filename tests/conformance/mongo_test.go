@@ -0,0 +1,112 @@
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// TestMongoStore runs against the server given in TEST_MONGO_URI, each case in
+// a database of its own that is dropped afterwards
+func TestMongoStore(t *testing.T) {
+	client := connectMongo(t)
+
+	runTaskStoreSuite(t, func(t *testing.T) backend {
+		dbName := mongoDatabase(t, client)
+
+		tasks := db.NewTaskRepository(client, dbName, "tasks", zerolog.Nop())
+		tasks.History = db.NewHistoryRepository(client, dbName, "task_history")
+
+		return backend{Tasks: tasks, History: tasks.History}
+	})
+}
+
+func TestMongoIdempotencyStore(t *testing.T) {
+	client := connectMongo(t)
+
+	runIdempotencyStoreSuite(t, db.NewIdempotencyRepository(client, mongoDatabase(t, client), "idempotency_keys", idempotencyLease))
+}
+
+func TestMongoAPIKeyStore(t *testing.T) {
+	client := connectMongo(t)
+
+	runAPIKeyStoreSuite(t, db.NewAPIKeyRepository(client, mongoDatabase(t, client), "api_keys"))
+}
+
+func connectMongo(t *testing.T) *mongo.Client {
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI is not set")
+	}
+
+	client, err := adapters.ConnectToMongoDb(adapters.MongoOptions{URI: uri}, zerolog.Nop())
+	require.NoError(t, err)
+	t.Cleanup(func() { adapters.DisconnectMongo(client, zerolog.Nop()) })
+
+	return client
+}
+
+// mongoDatabase returns the name of a fresh database, dropped when the test ends
+func mongoDatabase(t *testing.T, client *mongo.Client) string {
+	dbName := fmt.Sprintf("conformance_%d", time.Now().UnixNano())
+	t.Cleanup(func() { _ = client.Database(dbName).Drop(context.Background()) })
+
+	return dbName
+}
+
+func TestMongoIndexes(t *testing.T) {
+	client := connectMongo(t)
+	database := client.Database(mongoDatabase(t, client))
+	registry := db.IndexRegistry{db.TaskIndexes("tasks"), db.HistoryIndexes("task_history")}
+
+	report, err := registry.Ensure(context.Background(), database)
+	require.NoError(t, err)
+	for _, index := range report.Indexes {
+		assert.Equal(t, db.IndexCreated, index.State, index.Name)
+	}
+
+	report, err = registry.Ensure(context.Background(), database)
+	require.NoError(t, err)
+	for _, index := range report.Indexes {
+		assert.Equal(t, db.IndexOK, index.State, index.Name)
+	}
+}
+
+func TestMongoTaskValidator(t *testing.T) {
+	client := connectMongo(t)
+	database := client.Database(mongoDatabase(t, client))
+
+	require.NoError(t, db.ApplyTaskValidator(context.Background(), database, "tasks", db.ValidationError))
+	require.NoError(t, db.ApplyTaskValidator(context.Background(), database, "tasks", db.ValidationError))
+
+	tasks := db.NewTaskRepository(client, database.Name(), "tasks", zerolog.Nop())
+	_, err := tasks.CreateTodo(context.Background(), &db.CreateNewTask{Title: "Valid task", Timestamp: ptr(time.Now())})
+	require.NoError(t, err)
+
+	// Documents written around the repository are checked too
+	_, err = database.Collection("tasks").InsertOne(context.Background(), bson.M{"title": 42})
+	var serverErr mongo.ServerError
+	require.ErrorAs(t, err, &serverErr)
+	assert.True(t, serverErr.HasErrorCode(121))
+
+	// Tasks missing an editable field or with a short title are rejected as well
+	now := time.Now()
+	for _, doc := range []bson.M{
+		{"title": "No timestamp", "completed": false, "created_at": now, "updated_at": now, "version": 1},
+		{"title": "ab", "completed": false, "timestamp": now, "created_at": now, "updated_at": now, "version": 1},
+	} {
+		_, err = database.Collection("tasks").InsertOne(context.Background(), doc)
+		require.ErrorAs(t, err, &serverErr)
+		assert.True(t, serverErr.HasErrorCode(121))
+	}
+}
@@ -0,0 +1,83 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgresStore runs against the server given in TEST_POSTGRES_URI, each case
+// in a schema of its own that is dropped afterwards
+func TestPostgresStore(t *testing.T) {
+	uri := postgresURI(t)
+
+	runTaskStoreSuite(t, func(t *testing.T) backend {
+		store := db.NewSQLStore(openPostgres(t, uri), db.Postgres)
+		return backend{Tasks: store, History: store}
+	})
+}
+
+func TestPostgresIdempotencyStore(t *testing.T) {
+	runIdempotencyStoreSuite(t, db.NewSQLIdempotencyStore(openPostgres(t, postgresURI(t)), db.Postgres, time.Hour, idempotencyLease))
+}
+
+func TestPostgresAPIKeyStore(t *testing.T) {
+	runAPIKeyStoreSuite(t, db.NewSQLAPIKeyStore(openPostgres(t, postgresURI(t)), db.Postgres))
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	conn := openPostgres(t, postgresURI(t))
+
+	var before int
+	require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&before))
+	assert.Positive(t, before)
+
+	require.NoError(t, db.MigrateSQL(context.Background(), conn, db.Postgres))
+
+	var after int
+	require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&after))
+	assert.Equal(t, before, after)
+}
+
+func postgresURI(t *testing.T) string {
+	uri := os.Getenv("TEST_POSTGRES_URI")
+	if uri == "" {
+		t.Skip("TEST_POSTGRES_URI is not set")
+	}
+
+	return uri
+}
+
+// openPostgres returns a pool whose connections all use a fresh, migrated schema,
+// dropped when the test ends
+func openPostgres(t *testing.T, uri string) *sql.DB {
+	admin, err := db.Postgres.Open(uri)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = admin.Close() })
+
+	schema := fmt.Sprintf("conformance_%d", time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { _, _ = admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	dsn, err := url.Parse(uri)
+	require.NoError(t, err)
+	query := dsn.Query()
+	query.Set("search_path", schema)
+	dsn.RawQuery = query.Encode()
+
+	conn, err := db.Postgres.Open(dsn.String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.NoError(t, db.MigrateSQL(context.Background(), conn, db.Postgres))
+	return conn
+}
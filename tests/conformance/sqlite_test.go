@@ -0,0 +1,56 @@
+package conformance
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openSQLite returns a migrated database in a temporary directory
+func openSQLite(t *testing.T) *sql.DB {
+	conn, err := db.SQLite.Open(filepath.Join(t.TempDir(), "tasks.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	require.NoError(t, db.MigrateSQL(context.Background(), conn, db.SQLite))
+	return conn
+}
+
+func TestSQLiteStore(t *testing.T) {
+	runTaskStoreSuite(t, func(t *testing.T) backend {
+		store := db.NewSQLStore(openSQLite(t), db.SQLite)
+		return backend{Tasks: store, History: store}
+	})
+}
+
+func TestSQLiteIdempotencyStore(t *testing.T) {
+	runIdempotencyStoreSuite(t, db.NewSQLIdempotencyStore(openSQLite(t), db.SQLite, time.Hour, idempotencyLease))
+}
+
+func TestSQLiteAPIKeyStore(t *testing.T) {
+	runAPIKeyStoreSuite(t, db.NewSQLAPIKeyStore(openSQLite(t), db.SQLite))
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	conn := openSQLite(t)
+
+	var before int
+	require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&before))
+	assert.Positive(t, before)
+
+	require.NoError(t, db.MigrateSQL(context.Background(), conn, db.SQLite))
+
+	var after int
+	require.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&after))
+	assert.Equal(t, before, after)
+
+	_, err := conn.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", after+1, time.Now().UnixMilli())
+	require.NoError(t, err)
+	assert.ErrorContains(t, db.MigrateSQL(context.Background(), conn, db.SQLite), "is newer than")
+}
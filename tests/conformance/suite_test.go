@@ -0,0 +1,469 @@
+package conformance
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// backend is a storage implementation under test
+type backend struct {
+	Tasks   db.TaskStore
+	History db.HistoryStore
+}
+
+// newBackend returns an empty backend, cleaned up when the test ends
+type newBackend func(t *testing.T) backend
+
+// runTaskStoreSuite checks that a storage backend behaves like every other one.
+// Each case starts from an empty backend.
+func runTaskStoreSuite(t *testing.T, newBackend newBackend) {
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, b backend)
+	}{
+		{"Should create and read tasks", testCreateAndGet},
+		{"Should classify failures", testErrors},
+		{"Should filter, sort and page through tasks", testList},
+		{"Should page through tasks with cursors", testCursors},
+		{"Should replace and patch tasks", testReplaceAndPatch},
+		{"Should keep every field of a task through patch documents", testPatchDocuments},
+		{"Should trash, restore and purge tasks", testTrash},
+		{"Should record the history newest first", testHistory},
+		{"Should run bulk batches", testBulk},
+		{"Should update and delete by filter", testWriteByFilter},
+		{"Should not lose concurrent writes", testConcurrentWrites},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newBackend(t))
+		})
+	}
+}
+
+func newTask(title string, completed bool, timestamp time.Time) *db.CreateNewTask {
+	return &db.CreateNewTask{Title: title, Completed: completed, Timestamp: &timestamp}
+}
+
+func createTasks(t *testing.T, store db.TaskStore, titles ...string) []*db.Tasks {
+	tasks := make([]*db.Tasks, 0, len(titles))
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, title := range titles {
+		task, err := store.CreateTodo(context.Background(), newTask(title, i%2 == 1, base.Add(time.Duration(i)*time.Hour)))
+		require.NoError(t, err)
+		tasks = append(tasks, task)
+	}
+
+	return tasks
+}
+
+func titles(tasks []db.Tasks) []string {
+	result := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		result = append(result, task.Title)
+	}
+	return result
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testCreateAndGet(t *testing.T, b backend) {
+	ctx := context.Background()
+	timestamp := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	created, err := b.Tasks.CreateTodo(ctx, newTask("Groceries", false, timestamp))
+	require.NoError(t, err)
+	assert.False(t, created.ID.IsZero())
+	assert.Equal(t, int64(1), created.Version)
+
+	task, err := b.Tasks.GetTaskById(ctx, created.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "Groceries", task.Title)
+	assert.False(t, task.Completed)
+	assert.True(t, timestamp.Equal(task.Timestamp))
+	assert.WithinDuration(t, created.CreatedAt, task.CreatedAt, time.Millisecond)
+	assert.Equal(t, int64(1), task.Version)
+	assert.Nil(t, task.DeletedAt)
+}
+
+func testErrors(t *testing.T, b backend) {
+	ctx := context.Background()
+	task := createTasks(t, b.Tasks, "Versioned")[0]
+	missing := "507f1f77bcf86cd799439011"
+
+	_, err := b.Tasks.GetTaskById(ctx, "not-an-id")
+	assert.ErrorIs(t, err, db.ErrInvalidID)
+
+	_, err = b.Tasks.GetTaskById(ctx, missing)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = b.Tasks.ModifyTask(ctx, missing, &db.UpdateTask{Title: ptr("Missing")}, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = b.Tasks.ModifyTask(ctx, task.ID.Hex(), &db.UpdateTask{}, nil)
+	assert.ErrorIs(t, err, db.ErrValidation)
+
+	_, err = b.Tasks.ModifyTask(ctx, task.ID.Hex(), &db.UpdateTask{Title: ptr("Stale")}, ptr(int64(7)))
+	assert.ErrorIs(t, err, db.ErrConflict)
+	assert.ErrorIs(t, err, db.ErrVersionMismatch)
+
+	_, err = b.Tasks.DeleteTask(ctx, task.ID.Hex(), ptr(int64(7)))
+	assert.ErrorIs(t, err, db.ErrVersionMismatch)
+
+	_, err = b.Tasks.PurgeTask(ctx, missing)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = b.Tasks.RestoreTask(ctx, task.ID.Hex())
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = b.History.ListByTask(ctx, "not-an-id", &db.HistoryQuery{Limit: 10})
+	assert.ErrorIs(t, err, db.ErrInvalidID)
+}
+
+func testList(t *testing.T, b backend) {
+	ctx := context.Background()
+	// Tasks at odd positions are completed, timestamps are an hour apart
+	tasks := createTasks(t, b.Tasks, "Buy milk", "Call mom", "buy bread", "Write report", "Clean house")
+
+	list := func(query *db.TaskListQuery) *db.TaskPage {
+		page, err := b.Tasks.GetAllTasks(ctx, query)
+		require.NoError(t, err)
+		return page
+	}
+
+	page := list(db.DefaultTaskListQuery())
+	assert.Equal(t, int64(5), page.Total)
+	assert.Equal(t, []string{"Buy milk", "Call mom", "buy bread", "Write report", "Clean house"}, titles(page.Items))
+
+	query := db.DefaultTaskListQuery()
+	query.Filter.Title = "BUY"
+	assert.ElementsMatch(t, []string{"Buy milk", "buy bread"}, titles(list(query).Items))
+
+	query = db.DefaultTaskListQuery()
+	query.Filter.Completed = ptr(true)
+	assert.ElementsMatch(t, []string{"Call mom", "Write report"}, titles(list(query).Items))
+
+	query = db.DefaultTaskListQuery()
+	query.Filter.TimestampFrom = ptr(tasks[1].Timestamp)
+	query.Filter.TimestampTo = ptr(tasks[3].Timestamp)
+	assert.ElementsMatch(t, []string{"Call mom", "buy bread"}, titles(list(query).Items))
+
+	query = db.DefaultTaskListQuery()
+	query.Sort = db.TaskSort{Field: "timestamp", Desc: true}
+	query.Limit, query.Offset = 2, 1
+	page = list(query)
+	assert.Equal(t, []string{"Write report", "buy bread"}, titles(page.Items))
+	assert.Equal(t, int64(5), page.Total)
+	assert.True(t, page.HasMore)
+	assert.True(t, page.HasPrev)
+
+	query = db.DefaultTaskListQuery()
+	query.Sort = db.TaskSort{Field: "completed"}
+	query.Offset = 4
+	page = list(query)
+	assert.Equal(t, []string{"Write report"}, titles(page.Items))
+	assert.False(t, page.HasMore)
+}
+
+func testCursors(t *testing.T, b backend) {
+	ctx := context.Background()
+	createTasks(t, b.Tasks, "Alpha", "Bravo", "Charlie", "Delta", "Echo")
+	service := services.NewTaskService(b.Tasks, b.History, db.NewCursorCodec(nil))
+
+	list := func(cursor string) *db.TaskPage {
+		query := db.DefaultTaskListQuery()
+		query.Sort = db.TaskSort{Field: "title", Desc: true}
+		query.Limit = 2
+		query.CursorToken = cursor
+
+		page, err := service.List(ctx, query)
+		require.NoError(t, err)
+		return page
+	}
+
+	first := list("")
+	assert.Equal(t, []string{"Echo", "Delta"}, titles(first.Items))
+	require.NotEmpty(t, first.NextCursor)
+
+	second := list(first.NextCursor)
+	assert.Equal(t, []string{"Charlie", "Bravo"}, titles(second.Items))
+	assert.True(t, second.HasPrev)
+
+	last := list(second.NextCursor)
+	assert.Equal(t, []string{"Alpha"}, titles(last.Items))
+	assert.False(t, last.HasMore)
+
+	back := list(second.PrevCursor)
+	assert.Equal(t, []string{"Echo", "Delta"}, titles(back.Items))
+	assert.False(t, back.HasPrev)
+}
+
+func testReplaceAndPatch(t *testing.T, b backend) {
+	ctx := context.Background()
+	task := createTasks(t, b.Tasks, "Draft")[0]
+	timestamp := time.Date(2025, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	replaced, err := b.Tasks.ReplaceTask(ctx, task.ID.Hex(), newTask("Final", true, timestamp), ptr(int64(1)))
+	require.NoError(t, err)
+	assert.Equal(t, "Final", replaced.Title)
+	assert.True(t, replaced.Completed)
+	assert.Equal(t, int64(2), replaced.Version)
+
+	patched, err := b.Tasks.PatchTask(ctx, task.ID.Hex(), nil, func(current *db.Tasks) (*db.TaskPatch, error) {
+		assert.Equal(t, "Final", current.Title)
+		return &db.TaskPatch{Set: db.UpdateTask{Completed: ptr(false)}}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), patched.Version)
+
+	stored, err := b.Tasks.GetTaskById(ctx, task.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, "Final", stored.Title)
+	assert.False(t, stored.Completed)
+	assert.True(t, timestamp.Equal(stored.Timestamp))
+	assert.Equal(t, int64(3), stored.Version)
+
+	unchanged, err := b.Tasks.PatchTask(ctx, task.ID.Hex(), ptr(int64(3)), func(*db.Tasks) (*db.TaskPatch, error) {
+		return &db.TaskPatch{Set: db.UpdateTask{Title: ptr("Final")}}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), unchanged.Version)
+
+	_, err = b.Tasks.PatchTask(ctx, task.ID.Hex(), ptr(int64(2)), func(*db.Tasks) (*db.TaskPatch, error) {
+		return &db.TaskPatch{Set: db.UpdateTask{Title: ptr("Late")}}, nil
+	})
+	assert.ErrorIs(t, err, db.ErrVersionMismatch)
+}
+
+func testPatchDocuments(t *testing.T, b backend) {
+	ctx := context.Background()
+	service := services.NewTaskService(b.Tasks, b.History, db.NewCursorCodec(nil))
+	task := createTasks(t, b.Tasks, "Draft", "Done")[1]
+	require.True(t, task.Completed)
+
+	for _, patch := range []string{`{"title":null}`, `{"completed":null}`, `{"timestamp":null}`} {
+		_, err := service.Patch(ctx, task.ID.Hex(), nil, utils.MergePatchContentType, []byte(patch))
+		var validationErr *utils.ValidationError
+		assert.ErrorAs(t, err, &validationErr, patch)
+	}
+	_, err := service.Patch(ctx, task.ID.Hex(), nil, utils.JSONPatchContentType, []byte(`[{"op":"remove","path":"/completed"}]`))
+	var validationErr *utils.ValidationError
+	assert.ErrorAs(t, err, &validationErr)
+
+	patched, err := service.Patch(ctx, task.ID.Hex(), nil, utils.MergePatchContentType, []byte(`{"completed":false}`))
+	require.NoError(t, err)
+	assert.True(t, task.Timestamp.Equal(patched.Timestamp))
+
+	// ? A patched task must still match filters and keyset pages on its fields
+	list := func(cursor string) *db.TaskPage {
+		query := db.DefaultTaskListQuery()
+		query.Filter.Completed = ptr(false)
+		query.Sort = db.TaskSort{Field: "timestamp"}
+		query.Limit = 1
+		query.CursorToken = cursor
+
+		page, err := service.List(ctx, query)
+		require.NoError(t, err)
+		return page
+	}
+
+	first := list("")
+	require.NotEmpty(t, first.NextCursor)
+	second := list(first.NextCursor)
+	assert.Equal(t, []string{"Draft", "Done"}, append(titles(first.Items), titles(second.Items)...))
+}
+
+func testTrash(t *testing.T, b backend) {
+	ctx := context.Background()
+	tasks := createTasks(t, b.Tasks, "Keep", "Trash")
+	id := tasks[1].ID.Hex()
+
+	_, err := b.Tasks.DeleteTask(ctx, id, ptr(int64(1)))
+	require.NoError(t, err)
+
+	_, err = b.Tasks.GetTaskById(ctx, id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = b.Tasks.DeleteTask(ctx, id, nil)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	query := db.DefaultTaskListQuery()
+	query.Filter.Trashed = true
+	page, err := b.Tasks.GetAllTasks(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "Trash", page.Items[0].Title)
+	assert.NotNil(t, page.Items[0].DeletedAt)
+
+	restored, err := b.Tasks.RestoreTask(ctx, id)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, int64(3), restored.Version)
+
+	_, err = b.Tasks.DeleteTask(ctx, id, nil)
+	require.NoError(t, err)
+
+	purged, err := b.Tasks.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	purged, err = b.Tasks.PurgeTrash(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	history, err := b.History.ListByTask(ctx, id, &db.HistoryQuery{Limit: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, history.Items)
+	assert.Equal(t, db.ActionPurged, history.Items[0].Action)
+	assert.Equal(t, "system", history.Items[0].Actor, "the purge job is attributed to the system actor")
+
+	_, err = b.Tasks.RestoreTask(ctx, id)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = b.Tasks.PurgeTask(ctx, tasks[0].ID.Hex())
+	require.NoError(t, err)
+
+	page, err = b.Tasks.GetAllTasks(ctx, db.DefaultTaskListQuery())
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+}
+
+func testHistory(t *testing.T, b backend) {
+	ctx := db.WithAudit(context.Background(), db.Audit{Actor: "alice", RequestID: "req-1"})
+	task, err := b.Tasks.CreateTodo(ctx, newTask("Tracked", false, time.Now()))
+	require.NoError(t, err)
+
+	_, err = b.Tasks.ModifyTask(ctx, task.ID.Hex(), &db.UpdateTask{Title: ptr("Renamed")}, nil)
+	require.NoError(t, err)
+	_, err = b.Tasks.DeleteTask(ctx, task.ID.Hex(), nil)
+	require.NoError(t, err)
+
+	page, err := b.History.ListByTask(ctx, task.ID.Hex(), &db.HistoryQuery{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), page.Total)
+	assert.True(t, page.HasMore)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, db.ActionDeleted, page.Items[0].Action)
+	assert.Equal(t, db.ActionUpdated, page.Items[1].Action)
+	assert.Equal(t, "alice", page.Items[1].Actor)
+	assert.Equal(t, "req-1", page.Items[1].RequestID)
+	require.Len(t, page.Items[1].Changes, 1)
+	assert.Equal(t, "title", page.Items[1].Changes[0].Field)
+	assert.Equal(t, "Renamed", page.Items[1].Changes[0].After)
+
+	page, err = b.History.ListByTask(ctx, task.ID.Hex(), &db.HistoryQuery{Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, db.ActionCreated, page.Items[0].Action)
+	assert.False(t, page.HasMore)
+}
+
+func testBulk(t *testing.T, b backend) {
+	ctx := context.Background()
+	tasks := createTasks(t, b.Tasks, "Update me", "Delete me")
+
+	results, err := b.Tasks.BulkWrite(ctx, []db.BulkOperation{
+		{Kind: db.BulkCreate, Create: newTask("Bulk created", false, time.Now())},
+		{Kind: db.BulkUpdate, ID: tasks[0].ID.Hex(), Version: ptr(int64(1)), Update: &db.UpdateTask{Completed: ptr(true)}},
+		{Kind: db.BulkDelete, ID: "507f1f77bcf86cd799439011"},
+		{Kind: db.BulkDelete, ID: tasks[1].ID.Hex()},
+	}, db.BulkOptions{Ordered: true})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.Equal(t, db.BulkCreated, results[0].Status)
+	assert.Equal(t, db.BulkUpdated, results[1].Status)
+	assert.Equal(t, int64(2), results[1].Version)
+	assert.Equal(t, db.BulkFailed, results[2].Status)
+	assert.Equal(t, string(db.KindNotFound), results[2].Error.Code)
+	assert.Equal(t, db.BulkSkipped, results[3].Status)
+
+	created, err := b.Tasks.GetTaskById(ctx, results[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Bulk created", created.Title)
+
+	updated, err := b.Tasks.GetTaskById(ctx, tasks[0].ID.Hex())
+	require.NoError(t, err)
+	assert.True(t, updated.Completed)
+
+	_, err = b.Tasks.GetTaskById(ctx, tasks[1].ID.Hex())
+	assert.NoError(t, err)
+
+	results, err = b.Tasks.BulkWrite(ctx, []db.BulkOperation{
+		{Kind: db.BulkDelete, ID: tasks[1].ID.Hex()},
+		{Kind: db.BulkUpdate, ID: tasks[0].ID.Hex(), Version: ptr(int64(1)), Update: &db.UpdateTask{Title: ptr("Stale")}},
+	}, db.BulkOptions{Atomic: true})
+	require.NoError(t, err)
+	assert.Equal(t, "aborted", results[0].Error.Code)
+	assert.Equal(t, string(db.KindConflict), results[1].Error.Code)
+
+	_, err = b.Tasks.GetTaskById(ctx, tasks[1].ID.Hex())
+	assert.NoError(t, err)
+}
+
+func testWriteByFilter(t *testing.T, b backend) {
+	ctx := context.Background()
+	// Tasks at odd positions are completed
+	createTasks(t, b.Tasks, "Open 1", "Done 1", "Open 2", "Done 2", "Open 3")
+	open := db.TaskFilter{Completed: ptr(false)}
+
+	preview, err := b.Tasks.PreviewByFilter(ctx, open)
+	require.NoError(t, err)
+	assert.True(t, preview.DryRun)
+	assert.Equal(t, int64(3), preview.Matched)
+	assert.Len(t, preview.SampleIDs, 3)
+
+	_, err = b.Tasks.UpdateByFilter(ctx, open, &db.UpdateTask{})
+	assert.ErrorIs(t, err, db.ErrValidation)
+
+	updated, err := b.Tasks.UpdateByFilter(ctx, db.TaskFilter{Title: "open"}, &db.UpdateTask{Completed: ptr(true)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), updated.Matched)
+	assert.Equal(t, int64(3), updated.Affected)
+	assert.Equal(t, int64(0), updated.Failed)
+
+	preview, err = b.Tasks.PreviewByFilter(ctx, open)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), preview.Matched)
+
+	deleted, err := b.Tasks.DeleteByFilter(ctx, db.TaskFilter{Title: "done"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted.Affected)
+
+	page, err := b.Tasks.GetAllTasks(ctx, db.DefaultTaskListQuery())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Open 1", "Open 2", "Open 3"}, titles(page.Items))
+}
+
+func testConcurrentWrites(t *testing.T, b backend) {
+	ctx := context.Background()
+	task := createTasks(t, b.Tasks, "Contended")[0]
+	const writers = 20
+
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.Tasks.ModifyTask(ctx, task.ID.Hex(), &db.UpdateTask{Completed: ptr(i%2 == 0)}, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	stored, err := b.Tasks.GetTaskById(ctx, task.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, int64(writers+1), stored.Version)
+
+	page, err := b.History.ListByTask(ctx, task.ID.Hex(), &db.HistoryQuery{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(writers+1), page.Total)
+}
@@ -16,13 +16,23 @@ func TestTaskRepository(client *mongo.Client, database *mongo.Database, collecti
 	}
 }
 
+func TestHistoryRepository(collection db.CollectionInterface) *db.HistoryRepository {
+	return &db.HistoryRepository{
+		Collection: collection,
+	}
+}
+
 // MockCollection implements MongoCollection for testing
 type MockCollection struct {
 	InsertOneFunc        func(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error)
 	FindFunc             func(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
+	CountDocumentsFunc   func(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error)
 	FindOneFunc          func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
 	FindOneAndUpdateFunc func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult
+	UpdateOneFunc        func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error)
 	DeleteOneFunc        func(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error)
+	DeleteManyFunc       func(ctx context.Context, filter any, opts ...options.Lister[options.DeleteManyOptions]) (*mongo.DeleteResult, error)
+	BulkWriteFunc        func(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error)
 }
 
 func (m *MockCollection) InsertOne(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
@@ -39,6 +49,13 @@ func (m *MockCollection) Find(ctx context.Context, filter any, opts ...options.L
 	return nil, nil
 }
 
+func (m *MockCollection) CountDocuments(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	if m.CountDocumentsFunc != nil {
+		return m.CountDocumentsFunc(ctx, filter, opts...)
+	}
+	return 0, nil
+}
+
 func (m *MockCollection) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
 	if m.FindOneFunc != nil {
 		return m.FindOneFunc(ctx, filter, opts...)
@@ -53,9 +70,30 @@ func (m *MockCollection) FindOneAndUpdate(ctx context.Context, filter any, updat
 	return nil
 }
 
+func (m *MockCollection) UpdateOne(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	if m.UpdateOneFunc != nil {
+		return m.UpdateOneFunc(ctx, filter, update, opts...)
+	}
+	return nil, nil
+}
+
 func (m *MockCollection) DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
 	if m.DeleteOneFunc != nil {
 		return m.DeleteOneFunc(ctx, filter, opts...)
 	}
 	return nil, nil
 }
+
+func (m *MockCollection) DeleteMany(ctx context.Context, filter any, opts ...options.Lister[options.DeleteManyOptions]) (*mongo.DeleteResult, error) {
+	if m.DeleteManyFunc != nil {
+		return m.DeleteManyFunc(ctx, filter, opts...)
+	}
+	return nil, nil
+}
+
+func (m *MockCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error) {
+	if m.BulkWriteFunc != nil {
+		return m.BulkWriteFunc(ctx, models, opts...)
+	}
+	return &mongo.BulkWriteResult{}, nil
+}
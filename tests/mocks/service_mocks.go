@@ -0,0 +1,108 @@
+package mocks
+
+import (
+	"context"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+)
+
+// FakeTaskService implements services.TaskService with overridable functions.
+// Methods without a function return db.ErrNotFound.
+type FakeTaskService struct {
+	CreateFunc         func(ctx context.Context, payload *db.CreateNewTask) (*db.Tasks, error)
+	ListFunc           func(ctx context.Context, query *db.TaskListQuery) (*db.TaskPage, error)
+	GetFunc            func(ctx context.Context, id string) (*db.Tasks, error)
+	ReplaceFunc        func(ctx context.Context, id string, payload *db.CreateNewTask, expectedVersion *int64) (*db.Tasks, error)
+	PatchFunc          func(ctx context.Context, id string, expectedVersion *int64, contentType string, patch []byte) (*db.Tasks, error)
+	DeleteFunc         func(ctx context.Context, id string, expectedVersion *int64) error
+	RestoreFunc        func(ctx context.Context, id string) (*db.Tasks, error)
+	PurgeFunc          func(ctx context.Context, id string) error
+	HistoryFunc        func(ctx context.Context, id string, query *db.HistoryQuery) (*db.HistoryPage, error)
+	BulkFunc           func(ctx context.Context, ops []db.BulkOperation, opts db.BulkOptions) ([]db.BulkItemResult, error)
+	UpdateByFilterFunc func(ctx context.Context, query *db.TaskWriteQuery, payload *db.UpdateTask) (*db.FilterWriteResult, error)
+	DeleteByFilterFunc func(ctx context.Context, query *db.TaskWriteQuery) (*db.FilterWriteResult, error)
+}
+
+func (f *FakeTaskService) Create(ctx context.Context, payload *db.CreateNewTask) (*db.Tasks, error) {
+	if f.CreateFunc != nil {
+		return f.CreateFunc(ctx, payload)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) List(ctx context.Context, query *db.TaskListQuery) (*db.TaskPage, error) {
+	if f.ListFunc != nil {
+		return f.ListFunc(ctx, query)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) Get(ctx context.Context, id string) (*db.Tasks, error) {
+	if f.GetFunc != nil {
+		return f.GetFunc(ctx, id)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) Replace(ctx context.Context, id string, payload *db.CreateNewTask, expectedVersion *int64) (*db.Tasks, error) {
+	if f.ReplaceFunc != nil {
+		return f.ReplaceFunc(ctx, id, payload, expectedVersion)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) Patch(ctx context.Context, id string, expectedVersion *int64, contentType string, patch []byte) (*db.Tasks, error) {
+	if f.PatchFunc != nil {
+		return f.PatchFunc(ctx, id, expectedVersion, contentType, patch)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) Delete(ctx context.Context, id string, expectedVersion *int64) error {
+	if f.DeleteFunc != nil {
+		return f.DeleteFunc(ctx, id, expectedVersion)
+	}
+	return db.ErrNotFound
+}
+
+func (f *FakeTaskService) Restore(ctx context.Context, id string) (*db.Tasks, error) {
+	if f.RestoreFunc != nil {
+		return f.RestoreFunc(ctx, id)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) Purge(ctx context.Context, id string) error {
+	if f.PurgeFunc != nil {
+		return f.PurgeFunc(ctx, id)
+	}
+	return db.ErrNotFound
+}
+
+func (f *FakeTaskService) History(ctx context.Context, id string, query *db.HistoryQuery) (*db.HistoryPage, error) {
+	if f.HistoryFunc != nil {
+		return f.HistoryFunc(ctx, id, query)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) Bulk(ctx context.Context, ops []db.BulkOperation, opts db.BulkOptions) ([]db.BulkItemResult, error) {
+	if f.BulkFunc != nil {
+		return f.BulkFunc(ctx, ops, opts)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) UpdateByFilter(ctx context.Context, query *db.TaskWriteQuery, payload *db.UpdateTask) (*db.FilterWriteResult, error) {
+	if f.UpdateByFilterFunc != nil {
+		return f.UpdateByFilterFunc(ctx, query, payload)
+	}
+	return nil, db.ErrNotFound
+}
+
+func (f *FakeTaskService) DeleteByFilter(ctx context.Context, query *db.TaskWriteQuery) (*db.FilterWriteResult, error) {
+	if f.DeleteByFilterFunc != nil {
+		return f.DeleteByFilterFunc(ctx, query)
+	}
+	return nil, db.ErrNotFound
+}
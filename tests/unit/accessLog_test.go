@@ -0,0 +1,94 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gsn_manager_service/src/server/middlewares"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAccessLogRouter(buf *bytes.Buffer, opts middlewares.AccessLogOptions) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(middlewares.AccessLog(zerolog.New(buf), opts))
+	router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router.Get("/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		middlewares.LoggerFrom(r.Context(), zerolog.Nop()).Info().Msg("from handler")
+		_, _ = w.Write([]byte("hello"))
+	})
+	router.Get("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	return router
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &fields))
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Run("Should log the request fields and hand the request logger to handlers", func(t *testing.T) {
+		var buf bytes.Buffer
+		router := newAccessLogRouter(&buf, middlewares.AccessLogOptions{SampleRate: 1})
+
+		serve(router, http.MethodGet, "/tasks/42", "", map[string]string{"User-Agent": "tests"})
+
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "from handler", lines[0]["message"])
+		assert.Equal(t, lines[1]["request_id"], lines[0]["request_id"])
+		assert.NotEmpty(t, lines[1]["request_id"])
+
+		access := lines[1]
+		assert.Equal(t, "info", access["level"])
+		assert.Equal(t, "GET", access["method"])
+		assert.Equal(t, "/tasks/{id}", access["route"])
+		assert.Equal(t, float64(http.StatusOK), access["status"])
+		assert.Equal(t, float64(5), access["bytes"])
+		assert.Equal(t, "192.0.2.1", access["remote_ip"])
+		assert.Equal(t, "tests", access["user_agent"])
+		assert.Contains(t, access, "duration_ms")
+	})
+
+	t.Run("Should skip excluded paths", func(t *testing.T) {
+		var buf bytes.Buffer
+		router := newAccessLogRouter(&buf, middlewares.AccessLogOptions{SampleRate: 1, Exclude: []string{"/healthz"}})
+
+		serve(router, http.MethodGet, "/healthz", "", nil)
+
+		assert.Empty(t, buf.String())
+	})
+
+	t.Run("Should sample successful requests but keep errors", func(t *testing.T) {
+		var buf bytes.Buffer
+		router := newAccessLogRouter(&buf, middlewares.AccessLogOptions{SampleRate: 0})
+
+		serve(router, http.MethodGet, "/tasks/42", "", nil)
+		serve(router, http.MethodGet, "/missing", "", nil)
+
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "from handler", lines[0]["message"])
+		assert.Equal(t, "warn", lines[1]["level"])
+		assert.Equal(t, float64(http.StatusNotFound), lines[1]["status"])
+	})
+}
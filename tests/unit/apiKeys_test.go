@@ -0,0 +1,289 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/config"
+	"github.com/gsn_manager_service/src/metrics"
+	"github.com/gsn_manager_service/src/server"
+	"github.com/gsn_manager_service/src/server/middlewares"
+	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createAPIKey(t *testing.T, keys services.APIKeyService, scopes ...db.APIKeyScope) (*db.APIKey, string) {
+	key, secret, err := keys.Create(context.Background(), &db.CreateAPIKey{Name: "test key", Scopes: scopes})
+	require.NoError(t, err)
+	return key, secret
+}
+
+func TestAPIKeyService(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should store only the hash of the secret", func(t *testing.T) {
+		store := db.NewMemoryAPIKeyStore()
+		key, secret := createAPIKey(t, services.NewAPIKeyService(store), db.ScopeRead)
+
+		assert.True(t, strings.HasPrefix(secret, "gsn_"))
+		assert.True(t, strings.HasPrefix(secret, key.Prefix))
+		assert.NotContains(t, key.Hash, secret)
+
+		stored, err := store.GetAPIKey(ctx, key.ID.Hex())
+		require.NoError(t, err)
+		assert.NotEqual(t, secret, stored.Hash)
+		assert.Len(t, stored.Hash, 64)
+	})
+
+	t.Run("Should authenticate a key and record its last use", func(t *testing.T) {
+		keys := services.NewAPIKeyService(db.NewMemoryAPIKeyStore())
+		key, secret := createAPIKey(t, keys, db.ScopeWrite)
+
+		found, err := keys.Authenticate(ctx, secret)
+		require.NoError(t, err)
+		assert.Equal(t, key.ID, found.ID)
+		assert.NotNil(t, found.LastUsedAt)
+		assert.True(t, found.HasScope(db.ScopeRead))
+		assert.False(t, found.HasScope(db.ScopeAdmin))
+
+		_, err = keys.Authenticate(ctx, secret+"x")
+		assert.ErrorIs(t, err, services.ErrInvalidAPIKey)
+		_, err = keys.Authenticate(ctx, "not a key")
+		assert.ErrorIs(t, err, services.ErrInvalidAPIKey)
+	})
+
+	t.Run("Should reject expired and revoked keys", func(t *testing.T) {
+		store := db.NewMemoryAPIKeyStore()
+		keys := services.NewAPIKeyService(store)
+
+		past := time.Now().Add(-time.Hour)
+		_, _, err := keys.Create(ctx, &db.CreateAPIKey{Name: "past", Scopes: []db.APIKeyScope{db.ScopeRead}, ExpiresAt: &past})
+		assert.Error(t, err)
+
+		// ? Keys cannot be created already expired, so an expired copy is put in a store of its own
+		key, secret := createAPIKey(t, keys, db.ScopeRead)
+		stored, err := store.GetAPIKey(ctx, key.ID.Hex())
+		require.NoError(t, err)
+		stored.ExpiresAt = &past
+		expiredStore := db.NewMemoryAPIKeyStore()
+		require.NoError(t, expiredStore.CreateAPIKey(ctx, stored))
+		_, err = services.NewAPIKeyService(expiredStore).Authenticate(ctx, secret)
+		assert.ErrorIs(t, err, services.ErrAPIKeyExpired)
+
+		_, err = keys.Revoke(ctx, key.ID.Hex())
+		require.NoError(t, err)
+		_, err = keys.Authenticate(ctx, secret)
+		assert.ErrorIs(t, err, services.ErrAPIKeyRevoked)
+	})
+
+	t.Run("Should replace the secret on rotation and refuse revoked keys", func(t *testing.T) {
+		keys := services.NewAPIKeyService(db.NewMemoryAPIKeyStore())
+		key, oldSecret := createAPIKey(t, keys, db.ScopeRead)
+
+		rotated, newSecret, err := keys.Rotate(ctx, key.ID.Hex())
+		require.NoError(t, err)
+		assert.Equal(t, key.ID, rotated.ID)
+		assert.NotEqual(t, oldSecret, newSecret)
+
+		_, err = keys.Authenticate(ctx, oldSecret)
+		assert.ErrorIs(t, err, services.ErrInvalidAPIKey)
+		_, err = keys.Authenticate(ctx, newSecret)
+		assert.NoError(t, err)
+
+		_, err = keys.Revoke(ctx, key.ID.Hex())
+		require.NoError(t, err)
+		_, _, err = keys.Rotate(ctx, key.ID.Hex())
+		assert.ErrorIs(t, err, db.ErrConflict)
+	})
+}
+
+func newAuthRouter(keys services.APIKeyService, service services.TaskService) *chi.Mux {
+	auth := middlewares.NewAPIKeyAuth(keys)
+	router := chi.NewRouter()
+	routes.SetupRoutes(router, routes.NewTaskHandler(service, zerolog.Nop()), db.NewMemoryIdempotencyStore(0, 0), nil, nil, auth)
+	routes.SetupAdminRoutes(router, &routes.AdminHandler{APIKeys: keys, Logger: zerolog.Nop()}, auth)
+	return router
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	keys := services.NewAPIKeyService(db.NewMemoryAPIKeyStore())
+	_, readSecret := createAPIKey(t, keys, db.ScopeRead)
+	_, writeSecret := createAPIKey(t, keys, db.ScopeWrite)
+	service := &mocks.FakeTaskService{
+		GetFunc: func(ctx context.Context, id string) (*db.Tasks, error) {
+			return mocks.GetSampleTask("Groceries"), nil
+		},
+		DeleteFunc: func(ctx context.Context, id string, expectedVersion *int64) error {
+			return nil
+		},
+	}
+	router := newAuthRouter(keys, service)
+
+	t.Run("Should answer 401 without a valid key", func(t *testing.T) {
+		rec := serve(router, http.MethodGet, "/tasks/1", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "/problems/unauthorized", decodeProblem(t, rec).Type)
+		assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+
+		rec = serve(router, http.MethodGet, "/tasks/1", "", map[string]string{"Authorization": "Bearer gsn_unknown"})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("Should accept the key as a bearer token or in X-API-Key", func(t *testing.T) {
+		rec := serve(router, http.MethodGet, "/tasks/1", "", map[string]string{"Authorization": "Bearer " + readSecret})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = serve(router, http.MethodGet, "/tasks/1", "", map[string]string{"X-API-Key": readSecret})
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Should answer 403 when the key lacks the scope", func(t *testing.T) {
+		rec := serve(router, http.MethodDelete, "/tasks/1", "", map[string]string{"X-API-Key": readSecret})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Equal(t, "/problems/forbidden", decodeProblem(t, rec).Type)
+
+		rec = serve(router, http.MethodDelete, "/tasks/1", "", map[string]string{"X-API-Key": writeSecret})
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = serve(router, http.MethodGet, "/admin/api-keys", "", map[string]string{"X-API-Key": writeSecret})
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("Should attribute changes to the key whatever X-Actor says", func(t *testing.T) {
+		var actor string
+		key, secret := createAPIKey(t, keys, db.ScopeWrite)
+		router := newAuthRouter(keys, &mocks.FakeTaskService{
+			DeleteFunc: func(ctx context.Context, id string, expectedVersion *int64) error {
+				actor = db.AuditFromContext(ctx).Actor
+				return nil
+			},
+		})
+
+		serve(router, http.MethodDelete, "/tasks/1", "", map[string]string{"X-API-Key": secret, "X-Actor": "someone-else"})
+
+		assert.Equal(t, "api-key:"+key.ID.Hex()+" (test key)", actor)
+	})
+
+	t.Run("Should not share idempotent responses between keys", func(t *testing.T) {
+		_, otherSecret := createAPIKey(t, keys, db.ScopeWrite)
+		router := newAuthRouter(keys, &mocks.FakeTaskService{
+			CreateFunc: func(ctx context.Context, payload *db.CreateNewTask) (*db.Tasks, error) {
+				return mocks.GetSampleTask(payload.Title), nil
+			},
+		})
+		body := `{"title":"Groceries","timestamp":"2025-01-01T00:00:00Z"}`
+
+		rec := serve(router, http.MethodPost, "/tasks/new", body, map[string]string{"X-API-Key": writeSecret, "X-Actor": "ci", "Idempotency-Key": "k1"})
+		require.Equal(t, http.StatusCreated, rec.Code)
+		rec = serve(router, http.MethodPost, "/tasks/new", body, map[string]string{"X-API-Key": otherSecret, "X-Actor": "ci", "Idempotency-Key": "k1"})
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+
+		rec = serve(router, http.MethodPost, "/tasks/new", body, map[string]string{"X-API-Key": otherSecret, "Idempotency-Key": "k1"})
+		assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("Should keep the health check public", func(t *testing.T) {
+		rec := serve(router, http.MethodGet, "/healthz", "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = serve(router, http.MethodGet, "/readyz", "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("Should keep verbose readiness and metrics to admin keys", func(t *testing.T) {
+		_, adminSecret := createAPIKey(t, keys, db.ScopeAdmin)
+
+		assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/readyz?verbose", "", nil).Code)
+		assert.Equal(t, http.StatusForbidden, serve(router, http.MethodGet, "/readyz?verbose", "", map[string]string{"X-API-Key": readSecret}).Code)
+		assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/readyz?verbose", "", map[string]string{"X-API-Key": adminSecret}).Code)
+
+		srv := server.StartServer(&config.Config{METRICS_PATH: "/metrics", ACCESS_LOG_SAMPLE_RATE: 1}, server.Dependencies{
+			Tasks:       &mocks.FakeTaskService{},
+			Idempotency: db.NewMemoryIdempotencyStore(0, 0),
+			Metrics:     metrics.New(),
+			APIKeys:     keys,
+			Logger:      zerolog.Nop(),
+		})
+		assert.Equal(t, http.StatusUnauthorized, serve(srv.Handler, http.MethodGet, "/metrics", "", nil).Code)
+		assert.Equal(t, http.StatusOK, serve(srv.Handler, http.MethodGet, "/metrics", "", map[string]string{"X-API-Key": adminSecret}).Code)
+	})
+
+	t.Run("Should attach the key to the context and the access log", func(t *testing.T) {
+		var buf bytes.Buffer
+		var seen *db.APIKey
+		logged := chi.NewRouter()
+		logged.Use(middleware.RequestID)
+		logged.Use(middlewares.AccessLog(zerolog.New(&buf), middlewares.AccessLogOptions{SampleRate: 1}))
+		logged.With(middlewares.NewAPIKeyAuth(keys).Require(db.ScopeRead)).Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+			seen = middlewares.APIKeyFromContext(r.Context())
+		})
+
+		rec := serve(logged, http.MethodGet, "/whoami", "", map[string]string{"X-API-Key": readSecret})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		require.NotNil(t, seen)
+		assert.Equal(t, "test key", seen.Name)
+		assert.Contains(t, buf.String(), `"api_key_id":"`+seen.ID.Hex()+`"`)
+		assert.Contains(t, buf.String(), `"api_key_name":"test key"`)
+	})
+}
+
+func TestAdminAPIKeys(t *testing.T) {
+	keys := services.NewAPIKeyService(db.NewMemoryAPIKeyStore())
+	_, adminSecret := createAPIKey(t, keys, db.ScopeAdmin)
+	router := newAuthRouter(keys, &mocks.FakeTaskService{})
+	admin := map[string]string{"X-API-Key": adminSecret}
+
+	rec := serve(router, http.MethodPost, "/admin/api-keys", `{"name":"deploy bot","scopes":["write"]}`, admin)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	var created struct {
+		ID     string   `json:"id"`
+		Key    string   `json:"key"`
+		Hash   string   `json:"hash"`
+		Scopes []string `json:"scopes"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Key)
+	assert.Empty(t, created.Hash)
+	assert.Equal(t, []string{"write"}, created.Scopes)
+
+	rec = serve(router, http.MethodPost, "/admin/api-keys", `{"name":"x","scopes":["root"]}`, admin)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	rec = serve(router, http.MethodGet, "/admin/api-keys", "", admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"deploy bot"`)
+	assert.NotContains(t, rec.Body.String(), created.Key)
+
+	rec = serve(router, http.MethodPost, "/admin/api-keys/"+created.ID+"/rotate", "", admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var rotated struct {
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rotated))
+	assert.NotEqual(t, created.Key, rotated.Key)
+
+	rec = serve(router, http.MethodDelete, "/admin/api-keys/"+created.ID, "", admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"revoked_at"`)
+
+	rec = serve(router, http.MethodGet, "/tasks/all", "", map[string]string{"X-API-Key": rotated.Key})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(router, http.MethodDelete, "/admin/api-keys/nope", "", admin)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,308 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// bulkCollection returns a collection holding tasks that reports every update
+// as matched, and the writes it received as write models
+func bulkCollection(tasks ...*db.Tasks) (*mocks.MockCollection, *[]mongo.WriteModel) {
+	var received []mongo.WriteModel
+	mockCollection := &mocks.MockCollection{}
+
+	mockCollection.FindFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+		docs := make([]any, 0, len(tasks))
+		for _, task := range tasks {
+			docs = append(docs, task)
+		}
+		return mongo.NewCursorFromDocuments(docs, nil, nil)
+	}
+
+	mockCollection.InsertOneFunc = func(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
+		received = append(received, mongo.NewInsertOneModel().SetDocument(document))
+		return &mongo.InsertOneResult{}, nil
+	}
+
+	mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+		received = append(received, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update))
+		return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+	}
+
+	return mockCollection, &received
+}
+
+// unmatchedUpdates makes the updates of mockCollection on the tasks in raced match nothing
+func unmatchedUpdates(mockCollection *mocks.MockCollection, raced ...*db.Tasks) {
+	matched := mockCollection.UpdateOneFunc
+	mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+		for _, task := range raced {
+			if filter.(bson.M)["_id"] == task.ID {
+				return &mongo.UpdateResult{}, nil
+			}
+		}
+		return matched(ctx, filter, update, opts...)
+	}
+}
+
+func existingTask(title string, version int64) *db.Tasks {
+	task := mocks.GetSampleTask(title)
+	task.ID = bson.NewObjectID()
+	task.Version = version
+	return task
+}
+
+func TestBulkWrite(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should apply creates, updates and deletes", func(t *testing.T) {
+		toUpdate, toDelete := existingTask("Update me", 2), existingTask("Delete me", 1)
+		mockCollection, received := bulkCollection(toUpdate, toDelete)
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		ops := []db.BulkOperation{
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+			{Kind: db.BulkUpdate, ID: toUpdate.ID.Hex(), Update: mocks.GetSampleUpdateTaskPayload()},
+			{Kind: db.BulkDelete, ID: toDelete.ID.Hex()},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{Ordered: true})
+
+		assert.NoError(t, err)
+		assert.Len(t, *received, 3)
+		assert.Equal(t, db.BulkCreated, results[0].Status)
+		assert.Equal(t, int64(1), results[0].Version)
+		assert.NotEmpty(t, results[0].ID)
+		assert.Equal(t, db.BulkUpdated, results[1].Status)
+		assert.Equal(t, int64(3), results[1].Version)
+		assert.Equal(t, db.BulkDeleted, results[2].Status)
+		for _, result := range results {
+			assert.Nil(t, result.Error)
+		}
+	})
+
+	t.Run("Should stop an ordered batch at the first failure", func(t *testing.T) {
+		mockCollection, received := bulkCollection()
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		ops := []db.BulkOperation{
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+			{Kind: db.BulkDelete, ID: bson.NewObjectID().Hex()},
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{Ordered: true})
+
+		assert.NoError(t, err)
+		assert.Len(t, *received, 1)
+		assert.Equal(t, db.BulkCreated, results[0].Status)
+		assert.Equal(t, db.BulkFailed, results[1].Status)
+		assert.Equal(t, string(db.KindNotFound), results[1].Error.Code)
+		assert.Equal(t, db.BulkSkipped, results[2].Status)
+	})
+
+	t.Run("Should keep going after a failure in an unordered batch", func(t *testing.T) {
+		mockCollection, received := bulkCollection()
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		ops := []db.BulkOperation{
+			{Kind: db.BulkUpdate, ID: "not-an-id", Update: mocks.GetSampleUpdateTaskPayload()},
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{})
+
+		assert.NoError(t, err)
+		assert.Len(t, *received, 1)
+		assert.Equal(t, string(db.KindInvalidID), results[0].Error.Code)
+		assert.Equal(t, db.BulkCreated, results[1].Status)
+	})
+
+	t.Run("Should report a batch whose history can not be written", func(t *testing.T) {
+		mockCollection, received := bulkCollection()
+		historyCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+		repo.History = mocks.TestHistoryRepository(historyCollection)
+
+		attempts := 0
+		historyCollection.InsertOneFunc = func(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, errors.New("history unavailable")
+			}
+			return &mongo.InsertOneResult{}, nil
+		}
+
+		ops := []db.BulkOperation{
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{})
+
+		assert.ErrorContains(t, err, "history entry could not be recorded")
+		assert.Nil(t, results)
+		assert.Len(t, *received, 2)
+		assert.Equal(t, 2, attempts, "the other entries should still be recorded")
+	})
+
+	t.Run("Should reject a stale version and a second operation on the same task", func(t *testing.T) {
+		task := existingTask("Versioned", 4)
+		mockCollection, _ := bulkCollection(task)
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		stale := int64(3)
+		ops := []db.BulkOperation{
+			{Kind: db.BulkUpdate, ID: task.ID.Hex(), Version: &stale, Update: mocks.GetSampleUpdateTaskPayload()},
+			{Kind: db.BulkDelete, ID: task.ID.Hex()},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, string(db.KindConflict), results[0].Error.Code)
+		assert.Equal(t, "duplicate_target", results[1].Error.Code)
+	})
+
+	t.Run("Should report an update without id after a create as an invalid id", func(t *testing.T) {
+		mockCollection, _ := bulkCollection()
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		ops := []db.BulkOperation{
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+			{Kind: db.BulkUpdate, Update: mocks.GetSampleUpdateTaskPayload()},
+			{Kind: db.BulkDelete},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, db.BulkCreated, results[0].Status)
+		assert.Equal(t, string(db.KindInvalidID), results[1].Error.Code)
+		assert.Equal(t, string(db.KindInvalidID), results[2].Error.Code)
+	})
+
+	t.Run("Should report updates that matched nothing as conflicts", func(t *testing.T) {
+		task := existingTask("Raced", 1)
+		mockCollection, _ := bulkCollection(task)
+		unmatchedUpdates(mockCollection, task)
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		ops := []db.BulkOperation{{Kind: db.BulkUpdate, ID: task.ID.Hex(), Update: mocks.GetSampleUpdateTaskPayload()}}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, db.BulkFailed, results[0].Status)
+		assert.Equal(t, "conflict", results[0].Error.Code)
+	})
+
+	t.Run("Should stop an ordered batch at an update that matched nothing", func(t *testing.T) {
+		raced, next := existingTask("Raced", 1), existingTask("Next", 1)
+		mockCollection, received := bulkCollection(raced, next)
+		unmatchedUpdates(mockCollection, raced)
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		ops := []db.BulkOperation{
+			{Kind: db.BulkUpdate, ID: raced.ID.Hex(), Update: mocks.GetSampleUpdateTaskPayload()},
+			{Kind: db.BulkDelete, ID: next.ID.Hex()},
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{Ordered: true})
+
+		assert.NoError(t, err)
+		assert.Empty(t, *received, "no write should follow the conflict")
+		assert.Equal(t, "conflict", results[0].Error.Code)
+		assert.Equal(t, db.BulkSkipped, results[1].Status)
+		assert.Equal(t, db.BulkSkipped, results[2].Status)
+	})
+
+	t.Run("Should not write anything when an operation of an atomic batch is invalid", func(t *testing.T) {
+		mockCollection, received := bulkCollection()
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		ops := []db.BulkOperation{
+			{Kind: db.BulkCreate, Create: mocks.GetSampleCreateTaskPayload()},
+			{Kind: db.BulkCreate, Err: &db.BulkItemError{Code: "validation", Message: "payload failed validation"}},
+		}
+
+		results, err := repo.BulkWrite(ctx, ops, db.BulkOptions{Atomic: true})
+
+		assert.NoError(t, err)
+		assert.Nil(t, *received)
+		assert.Equal(t, db.BulkSkipped, results[0].Status)
+		assert.Equal(t, "aborted", results[0].Error.Code)
+		assert.Equal(t, db.BulkFailed, results[1].Status)
+	})
+}
+
+func TestWriteByFilter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should update every matching task with version guarded writes", func(t *testing.T) {
+		first, second := existingTask("First", 1), existingTask("Second", 5)
+		mockCollection, received := bulkCollection(first, second)
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		completed := true
+		result, err := repo.UpdateByFilter(ctx, db.TaskFilter{}, &db.UpdateTask{Completed: &completed})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), result.Matched)
+		assert.Equal(t, int64(2), result.Affected)
+		assert.Equal(t, int64(0), result.Failed)
+		assert.Len(t, *received, 2)
+
+		filter := (*received)[1].(*mongo.UpdateOneModel).Filter.(bson.M)
+		assert.Equal(t, second.ID, filter["_id"])
+		assert.Equal(t, int64(5), filter["version"])
+	})
+
+	t.Run("Should count tasks modified in between as failed", func(t *testing.T) {
+		raced := existingTask("Raced", 1)
+		mockCollection, _ := bulkCollection(raced)
+		unmatchedUpdates(mockCollection, raced)
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		result, err := repo.DeleteByFilter(ctx, db.TaskFilter{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), result.Matched)
+		assert.Equal(t, int64(0), result.Affected)
+		assert.Equal(t, int64(1), result.Failed)
+	})
+
+	t.Run("Should reject an empty update", func(t *testing.T) {
+		repo := mocks.TestTaskRepository(nil, nil, &mocks.MockCollection{})
+
+		_, err := repo.UpdateByFilter(ctx, db.TaskFilter{}, &db.UpdateTask{})
+
+		assert.ErrorIs(t, err, db.ErrValidation)
+	})
+
+	t.Run("Should count matches and return sample ids on a dry run without writing", func(t *testing.T) {
+		task := existingTask("Preview", 1)
+		mockCollection, received := bulkCollection(task)
+		mockCollection.CountDocumentsFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+			return 42, nil
+		}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		result, err := repo.PreviewByFilter(ctx, db.TaskFilter{})
+
+		assert.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.Equal(t, int64(42), result.Matched)
+		assert.Equal(t, []string{task.ID.Hex()}, result.SampleIDs)
+		assert.Nil(t, *received)
+	})
+}
@@ -0,0 +1,41 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/gsn_manager_service/src/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("Should accept the known validation actions", func(t *testing.T) {
+		t.Setenv("MONGO_VALIDATION", "warn")
+
+		cfg, err := config.LoadConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "warn", cfg.MONGO_VALIDATION)
+	})
+
+	t.Run("Should reject an unknown validation action", func(t *testing.T) {
+		t.Setenv("MONGO_VALIDATION", "strict")
+
+		_, err := config.LoadConfig()
+		assert.ErrorContains(t, err, "MONGO_VALIDATION")
+	})
+
+	t.Run("Should accept the known storage backends", func(t *testing.T) {
+		t.Setenv("STORAGE_BACKEND", config.BackendSQLite)
+
+		cfg, err := config.LoadConfig()
+		require.NoError(t, err)
+		assert.Equal(t, config.BackendSQLite, cfg.STORAGE_BACKEND)
+	})
+
+	t.Run("Should reject an unknown storage backend", func(t *testing.T) {
+		t.Setenv("STORAGE_BACKEND", "mongodb")
+
+		_, err := config.LoadConfig()
+		assert.ErrorContains(t, err, "STORAGE_BACKEND")
+	})
+}
@@ -0,0 +1,85 @@
+package unit
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorCodec(t *testing.T) {
+	codec := db.NewCursorCodec([]byte("test-secret"))
+	task := mocks.GetSampleTask("Task 1")
+
+	parse := func(values url.Values) *db.TaskListQuery {
+		query, err := db.ParseTaskListQuery(values)
+		assert.Nil(t, err)
+		return query
+	}
+
+	t.Run("Should decode a cursor it issued for every sortable field", func(t *testing.T) {
+		for _, sort := range []string{"id", "title:desc", "completed", "timestamp:desc", "created_at", "updated_at:desc"} {
+			query := parse(url.Values{"sort": {sort}, "completed": {"false"}})
+
+			token := codec.Encode(query, task, true)
+			cursor, err := codec.Decode(token, query)
+
+			assert.Nil(t, err, sort)
+			assert.Equal(t, task.ID, cursor.ID)
+			assert.True(t, cursor.Backward)
+		}
+	})
+
+	t.Run("Should reject a cursor issued for a different filter", func(t *testing.T) {
+		issued := parse(url.Values{"completed": {"true"}})
+		token := codec.Encode(issued, task, false)
+
+		_, err := codec.Decode(token, parse(url.Values{"completed": {"false"}}))
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "different filter or sort")
+	})
+
+	t.Run("Should reject a cursor issued for a different sort", func(t *testing.T) {
+		token := codec.Encode(parse(url.Values{"sort": {"title"}}), task, false)
+
+		_, err := codec.Decode(token, parse(url.Values{"sort": {"title:desc"}}))
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Should reject a tampered cursor", func(t *testing.T) {
+		query := parse(url.Values{})
+		token := codec.Encode(query, task, false)
+		payload, signature, _ := strings.Cut(token, ".")
+
+		_, err := codec.Decode(payload+"x."+signature, query)
+		assert.NotNil(t, err)
+
+		_, err = db.NewCursorCodec([]byte("another-secret")).Decode(token, query)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "tampered")
+	})
+
+	t.Run("Should only hand out cursors for neighbouring pages that exist", func(t *testing.T) {
+		query := parse(url.Values{})
+		page := &db.TaskPage{Items: mocks.GetMultipleTasks(), HasMore: true}
+
+		codec.Paginate(query, page)
+
+		assert.NotEmpty(t, page.NextCursor)
+		assert.Empty(t, page.PrevCursor)
+	})
+}
+
+func TestParseTaskListQueryCursor(t *testing.T) {
+	t.Run("Should reject a cursor combined with an offset", func(t *testing.T) {
+		_, err := db.ParseTaskListQuery(url.Values{"cursor": {"abc"}, "offset": {"10"}})
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "can not be combined with offset")
+	})
+}
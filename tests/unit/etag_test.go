@@ -0,0 +1,61 @@
+package unit
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	t.Run("Should return no expected version when the header is absent or a wildcard", func(t *testing.T) {
+		for _, header := range []string{"", "*", `"1", *`} {
+			versions, err := utils.ParseIfMatch(header)
+
+			assert.Nil(t, err)
+			assert.Nil(t, versions, header)
+		}
+	})
+
+	t.Run("Should return the version of a strong entity tag", func(t *testing.T) {
+		versions, err := utils.ParseIfMatch(utils.ETag(7))
+
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{7}, versions)
+	})
+
+	t.Run("Should return every version of a list, skipping tags that can never match", func(t *testing.T) {
+		versions, err := utils.ParseIfMatch(`"1", W/"2",, "abc", "a,b","3"`)
+
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{1, 3}, versions)
+	})
+
+	t.Run("Should fail the precondition for tags that can never match", func(t *testing.T) {
+		for _, header := range []string{`W/"7"`, `"abc"`, `W/"1", "abc"`} {
+			_, err := utils.ParseIfMatch(header)
+
+			assert.True(t, errors.Is(err, utils.ErrPreconditionFailed), header)
+		}
+	})
+
+	t.Run("Should reject malformed headers", func(t *testing.T) {
+		for _, header := range []string{`7`, `"1", 2`} {
+			_, err := utils.ParseIfMatch(header)
+
+			var preErr *utils.PreconditionError
+			assert.True(t, errors.As(err, &preErr), header)
+		}
+	})
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	etag := utils.ETag(3)
+
+	assert.True(t, utils.IfNoneMatch(`"3"`, etag))
+	assert.True(t, utils.IfNoneMatch(`"1", W/"3"`, etag))
+	assert.True(t, utils.IfNoneMatch(`*`, etag))
+	assert.False(t, utils.IfNoneMatch(`"2"`, etag))
+	assert.False(t, utils.IfNoneMatch(``, etag))
+}
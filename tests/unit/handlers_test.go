@@ -0,0 +1,189 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ services.TaskService = (*mocks.FakeTaskService)(nil)
+
+func newTestRouter(service services.TaskService) *chi.Mux {
+	router := chi.NewRouter()
+	routes.SetupRoutes(router, routes.NewTaskHandler(service, zerolog.Nop()), db.NewMemoryIdempotencyStore(0, 0), nil, nil, nil)
+	return router
+}
+
+func serve(router http.Handler, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) utils.Problem {
+	var problem utils.Problem
+	assert.Equal(t, utils.ProblemContentType, rec.Header().Get("Content-Type"))
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	return problem
+}
+
+func TestTaskHandlers(t *testing.T) {
+	t.Run("Should create a task and return its ETag", func(t *testing.T) {
+		service := &mocks.FakeTaskService{
+			CreateFunc: func(ctx context.Context, payload *db.CreateNewTask) (*db.Tasks, error) {
+				task := mocks.GetSampleTask(payload.Title)
+				task.Version = 1
+				return task, nil
+			},
+		}
+
+		rec := serve(newTestRouter(service), http.MethodPost, "/tasks/new", `{"title":"Groceries","timestamp":"2025-01-01T00:00:00Z"}`, nil)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+		assert.Contains(t, rec.Body.String(), `"title":"Groceries"`)
+	})
+
+	t.Run("Should reject an invalid payload before reaching the service", func(t *testing.T) {
+		called := false
+		service := &mocks.FakeTaskService{
+			CreateFunc: func(ctx context.Context, payload *db.CreateNewTask) (*db.Tasks, error) {
+				called = true
+				return nil, nil
+			},
+		}
+
+		rec := serve(newTestRouter(service), http.MethodPost, "/tasks/new", `{"title":"ab"}`, nil)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.False(t, called)
+		assert.Len(t, decodeProblem(t, rec).Errors, 2)
+	})
+
+	t.Run("Should map repository errors to problems", func(t *testing.T) {
+		rec := serve(newTestRouter(&mocks.FakeTaskService{}), http.MethodGet, "/tasks/507f1f77bcf86cd799439011", "", nil)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, "/problems/not-found", decodeProblem(t, rec).Type)
+	})
+
+	t.Run("Should answer 304 when If-None-Match matches the current version", func(t *testing.T) {
+		service := &mocks.FakeTaskService{
+			GetFunc: func(ctx context.Context, id string) (*db.Tasks, error) {
+				task := mocks.GetSampleTask("Groceries")
+				task.Version = 7
+				return task, nil
+			},
+		}
+
+		rec := serve(newTestRouter(service), http.MethodGet, "/tasks/507f1f77bcf86cd799439011", "", map[string]string{"If-None-Match": `"7"`})
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("Should pass the If-Match version to the service", func(t *testing.T) {
+		var received *int64
+		service := &mocks.FakeTaskService{
+			DeleteFunc: func(ctx context.Context, id string, expectedVersion *int64) error {
+				received = expectedVersion
+				return nil
+			},
+		}
+
+		rec := serve(newTestRouter(service), http.MethodDelete, "/tasks/507f1f77bcf86cd799439011", "", map[string]string{"If-Match": `"3"`})
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int64(3), *received)
+	})
+
+	t.Run("Should expect the current version when If-Match lists it", func(t *testing.T) {
+		var received *int64
+		service := &mocks.FakeTaskService{
+			GetFunc: func(ctx context.Context, id string) (*db.Tasks, error) {
+				task := mocks.GetSampleTask("Task 1")
+				task.Version = 5
+				return task, nil
+			},
+			DeleteFunc: func(ctx context.Context, id string, expectedVersion *int64) error {
+				received = expectedVersion
+				return nil
+			},
+		}
+		router := newTestRouter(service)
+
+		rec := serve(router, http.MethodDelete, "/tasks/507f1f77bcf86cd799439011", "", map[string]string{"If-Match": `"4", W/"5", "5"`})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, int64(5), *received)
+
+		received = nil
+		rec = serve(router, http.MethodDelete, "/tasks/507f1f77bcf86cd799439011", "", map[string]string{"If-Match": `"3", "4"`})
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Nil(t, received)
+	})
+
+	t.Run("Should list trashed tasks with the parsed query", func(t *testing.T) {
+		var received *db.TaskListQuery
+		service := &mocks.FakeTaskService{
+			ListFunc: func(ctx context.Context, query *db.TaskListQuery) (*db.TaskPage, error) {
+				received = query
+				return &db.TaskPage{Items: []db.Tasks{}}, nil
+			},
+		}
+
+		rec := serve(newTestRouter(service), http.MethodGet, "/tasks/trash?completed=true&limit=5", "", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, received.Filter.Trashed)
+		assert.True(t, *received.Filter.Completed)
+		assert.Equal(t, int64(5), received.Limit)
+	})
+
+	t.Run("Should refuse a delete by filter without a filter or confirmation", func(t *testing.T) {
+		rec := serve(newTestRouter(&mocks.FakeTaskService{}), http.MethodDelete, "/tasks", "", nil)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "/problems/invalid-query", decodeProblem(t, rec).Type)
+	})
+
+	t.Run("Should report per item results of a bulk request", func(t *testing.T) {
+		var received []db.BulkOperation
+		service := &mocks.FakeTaskService{
+			BulkFunc: func(ctx context.Context, ops []db.BulkOperation, opts db.BulkOptions) ([]db.BulkItemResult, error) {
+				received = ops
+				return []db.BulkItemResult{
+					{Index: 0, Op: db.BulkCreate, Status: db.BulkCreated},
+					{Index: 1, Op: db.BulkCreate, Status: db.BulkFailed, Error: ops[1].Err},
+				}, nil
+			},
+		}
+
+		body := `{"operations":[
+			{"op":"create","data":{"title":"Groceries","timestamp":"2025-01-01T00:00:00Z"}},
+			{"op":"create","data":{"title":"ab","timestamp":"2025-01-01T00:00:00Z"}}
+		]}`
+		rec := serve(newTestRouter(service), http.MethodPost, "/tasks/bulk", body, nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Nil(t, received[0].Err)
+		assert.Equal(t, "validation", received[1].Err.Code)
+		assert.Contains(t, rec.Body.String(), `"succeeded":1,"failed":1`)
+	})
+}
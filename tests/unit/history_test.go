@@ -0,0 +1,134 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestDiffTasks(t *testing.T) {
+	t.Run("Should list every field of a created task", func(t *testing.T) {
+		task := mocks.GetSampleTask("Task 1")
+
+		changes := db.DiffTasks(nil, task)
+
+		assert.Equal(t, []db.FieldChange{
+			{Field: "title", Before: nil, After: "Task 1"},
+			{Field: "completed", Before: nil, After: false},
+			{Field: "timestamp", Before: nil, After: task.Timestamp},
+		}, changes)
+	})
+
+	t.Run("Should only list the fields that changed", func(t *testing.T) {
+		before := mocks.GetSampleTask("Task 1")
+		after := *before
+		after.Completed = true
+		after.Timestamp = before.Timestamp.In(time.UTC)
+		after.UpdatedAt = time.Now().Add(time.Hour)
+
+		changes := db.DiffTasks(before, &after)
+
+		assert.Equal(t, []db.FieldChange{{Field: "completed", Before: false, After: true}}, changes)
+	})
+}
+
+func TestTaskHistoryRecording(t *testing.T) {
+	ctx := db.WithAudit(context.Background(), db.Audit{Actor: "jane", RequestID: "req-1"})
+
+	t.Run("Should record the before and after values of an update", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		historyCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+		repo.History = mocks.TestHistoryRepository(historyCollection)
+
+		previous := mocks.GetSampleTask("Task 1")
+		payload := mocks.GetSampleUpdateTaskPayload()
+
+		mockCollection.FindOneAndUpdateFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(previous, nil, bson.NewRegistry())
+		}
+
+		var recorded *db.TaskHistoryEntry
+		historyCollection.InsertOneFunc = func(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
+			recorded = document.(*db.TaskHistoryEntry)
+			return &mongo.InsertOneResult{InsertedID: bson.NewObjectID()}, nil
+		}
+
+		updated, err := repo.ModifyTask(ctx, previous.ID.Hex(), payload, nil)
+
+		assert.Nil(t, err)
+		assert.Equal(t, *payload.Title, updated.Title)
+		assert.Equal(t, previous.ID, recorded.TaskID)
+		assert.Equal(t, db.ActionUpdated, recorded.Action)
+		assert.Equal(t, "jane", recorded.Actor)
+		assert.Equal(t, "req-1", recorded.RequestID)
+		assert.Contains(t, recorded.Changes, db.FieldChange{Field: "title", Before: "Task 1", After: *payload.Title})
+	})
+
+	t.Run("Should attribute changes outside of a request to the system", func(t *testing.T) {
+		assert.Equal(t, "system", db.AuditFromContext(context.Background()).Actor)
+	})
+
+	t.Run("Should report a change whose history can not be written", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		historyCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+		repo.History = mocks.TestHistoryRepository(historyCollection)
+
+		mockCollection.InsertOneFunc = func(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
+			return &mongo.InsertOneResult{InsertedID: bson.NewObjectID()}, nil
+		}
+		historyCollection.InsertOneFunc = func(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
+			return nil, errors.New("history unavailable")
+		}
+
+		created, err := repo.CreateTodo(ctx, mocks.GetSampleCreateTaskPayload())
+
+		assert.ErrorContains(t, err, "history entry could not be recorded")
+		assert.Nil(t, created)
+	})
+}
+
+func TestListTaskHistory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should return one page of history entries", func(t *testing.T) {
+		historyCollection := &mocks.MockCollection{}
+		repo := mocks.TestHistoryRepository(historyCollection)
+		taskID := bson.NewObjectID()
+
+		historyCollection.CountDocumentsFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+			return 3, nil
+		}
+		historyCollection.FindFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+			entry := db.TaskHistoryEntry{ID: bson.NewObjectID(), TaskID: taskID, Action: db.ActionCreated, Actor: "jane"}
+			return mongo.NewCursorFromDocuments([]any{entry}, nil, nil)
+		}
+
+		query, _ := db.ParseHistoryQuery(url.Values{"limit": {"1"}})
+		page, err := repo.ListByTask(ctx, taskID.Hex(), query)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(page.Items))
+		assert.Equal(t, int64(3), page.Total)
+		assert.True(t, page.HasMore)
+	})
+
+	t.Run("Should reject a malformed task id", func(t *testing.T) {
+		repo := mocks.TestHistoryRepository(&mocks.MockCollection{})
+
+		page, err := repo.ListByTask(ctx, "nope", &db.HistoryQuery{Limit: 10})
+
+		assert.Nil(t, page)
+		assert.True(t, errors.Is(err, db.ErrInvalidID))
+	})
+}
@@ -0,0 +1,107 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/server/middlewares"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func idempotentHandler(calls *atomic.Int32, status int, delay time.Duration) http.Handler {
+	store := db.NewMemoryIdempotencyStore(0, 0)
+
+	return middlewares.Idempotency(store, zerolog.Nop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"call": %d}`, n)))
+	}))
+}
+
+func sendIdempotent(handler http.Handler, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/tasks/new", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	t.Run("Should replay the stored response for a retry with the same body", func(t *testing.T) {
+		var calls atomic.Int32
+		handler := idempotentHandler(&calls, http.StatusCreated, 0)
+
+		first := sendIdempotent(handler, "key-1", `{"title": "Buy milk", "completed": false}`)
+		retry := sendIdempotent(handler, "key-1", `{"completed":false,"title":"Buy milk"}`)
+
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+		assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("Should reject a reused key with a different body", func(t *testing.T) {
+		var calls atomic.Int32
+		handler := idempotentHandler(&calls, http.StatusCreated, 0)
+
+		sendIdempotent(handler, "key-1", `{"title": "Buy milk"}`)
+		reused := sendIdempotent(handler, "key-1", `{"title": "Buy bread"}`)
+
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	})
+
+	t.Run("Should only run one of several concurrent duplicates", func(t *testing.T) {
+		var calls atomic.Int32
+		handler := idempotentHandler(&calls, http.StatusCreated, 50*time.Millisecond)
+
+		var wg sync.WaitGroup
+		codes := make([]int, 5)
+		for i := range codes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes[i] = sendIdempotent(handler, "key-1", `{"title": "Buy milk"}`).Code
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Contains(t, codes, http.StatusCreated)
+		assert.Contains(t, codes, http.StatusConflict)
+	})
+
+	t.Run("Should let a request be retried after a server error", func(t *testing.T) {
+		var calls atomic.Int32
+		handler := idempotentHandler(&calls, http.StatusServiceUnavailable, 0)
+
+		sendIdempotent(handler, "key-1", `{}`)
+		sendIdempotent(handler, "key-1", `{}`)
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Should not interfere with requests without a key", func(t *testing.T) {
+		var calls atomic.Int32
+		handler := idempotentHandler(&calls, http.StatusCreated, 0)
+
+		sendIdempotent(handler, "", `{}`)
+		sendIdempotent(handler, "", `{}`)
+
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
@@ -0,0 +1,107 @@
+package unit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	declared := db.TaskIndexes("tasks")
+	byTimestamp := declared.Indexes[0]
+
+	states := func(statuses []db.IndexStatus) map[string]db.IndexState {
+		result := map[string]db.IndexState{}
+		for _, status := range statuses {
+			result[status.Name] = status.State
+		}
+		return result
+	}
+
+	t.Run("Should report every declared index as missing on an empty collection", func(t *testing.T) {
+		statuses := db.DiffIndexes(declared, []db.IndexDescription{{Name: "_id_", Keys: bson.D{{Key: "_id", Value: int32(1)}}}})
+
+		assert.Len(t, statuses, len(declared.Indexes))
+		for _, status := range statuses {
+			assert.Equal(t, db.IndexMissing, status.State)
+			assert.Empty(t, status.Actual)
+		}
+	})
+
+	t.Run("Should match indexes whatever the numeric type of their directions", func(t *testing.T) {
+		actual := db.IndexDescription{Name: byTimestamp.Name, Keys: bson.D{
+			{Key: "deleted_at", Value: int32(1)},
+			{Key: "timestamp", Value: float64(1)},
+			{Key: "_id", Value: int64(1)},
+		}}
+
+		statuses := db.DiffIndexes(declared, []db.IndexDescription{actual})
+
+		assert.Equal(t, db.IndexOK, states(statuses)[byTimestamp.Name])
+	})
+
+	t.Run("Should report an index with other keys as drifted", func(t *testing.T) {
+		actual := db.IndexDescription{Name: byTimestamp.Name, Keys: bson.D{{Key: "timestamp", Value: int32(-1)}}}
+
+		statuses := db.DiffIndexes(declared, []db.IndexDescription{actual})
+
+		assert.Equal(t, db.IndexDrifted, statuses[0].State)
+		assert.Equal(t, "keys differ", statuses[0].Detail)
+		assert.Equal(t, "{timestamp: -1}", statuses[0].Actual)
+	})
+
+	t.Run("Should report an equivalent index under another name as drifted", func(t *testing.T) {
+		actual := db.IndexDescription{Name: "deleted_at_1_timestamp_1__id_1", Keys: byTimestamp.Keys}
+
+		statuses := db.DiffIndexes(declared, []db.IndexDescription{actual})
+
+		assert.Equal(t, db.IndexDrifted, statuses[0].State)
+		assert.Contains(t, statuses[0].Detail, `exists as "deleted_at_1_timestamp_1__id_1"`)
+		assert.NotContains(t, states(statuses), "deleted_at_1_timestamp_1__id_1")
+	})
+
+	t.Run("Should report a TTL index with another expiry as drifted", func(t *testing.T) {
+		declared := db.IdempotencyIndexes("idempotency_keys", time.Hour)
+		expireAfter := int64(60)
+		actual := db.IndexDescription{Name: "created_at_ttl", Keys: bson.D{{Key: "created_at", Value: int32(1)}}, ExpireAfter: &expireAfter}
+
+		statuses := db.DiffIndexes(declared, []db.IndexDescription{actual})
+
+		assert.Equal(t, db.IndexDrifted, statuses[0].State)
+		assert.Equal(t, "TTL is 60s instead of 3600s", statuses[0].Detail)
+	})
+
+	t.Run("Should list undeclared indexes as unmanaged", func(t *testing.T) {
+		actual := db.IndexDescription{Name: "title_1", Keys: bson.D{{Key: "title", Value: int32(1)}}}
+
+		statuses := db.DiffIndexes(declared, []db.IndexDescription{actual})
+
+		assert.Equal(t, db.IndexUnmanaged, states(statuses)["title_1"])
+	})
+}
+
+func TestTaskValidator(t *testing.T) {
+	t.Run("Should describe every field of the Tasks struct", func(t *testing.T) {
+		schema := db.TaskValidator()["$jsonSchema"].(bson.M)
+		properties := schema["properties"].(bson.M)
+
+		fields := reflect.TypeFor[db.Tasks]()
+		for i := range fields.NumField() {
+			name, _, _ := strings.Cut(fields.Field(i).Tag.Get("bson"), ",")
+			assert.Contains(t, properties, name)
+		}
+		assert.Len(t, properties, fields.NumField())
+	})
+
+	t.Run("Should require the fields of CreateNewTask with its rules", func(t *testing.T) {
+		schema := db.TaskValidator()["$jsonSchema"].(bson.M)
+
+		assert.Subset(t, schema["required"], bson.A{"title", "completed", "timestamp"})
+		assert.Equal(t, bson.M{"bsonType": "string", "minLength": 3, "maxLength": 100}, schema["properties"].(bson.M)["title"])
+	})
+}
@@ -0,0 +1,156 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/config"
+	"github.com/gsn_manager_service/src/server/middlewares"
+	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	redactor, err := adapters.NewRedactor([]string{"password", "Authorization"}, []string{"email", "bearer"})
+	require.NoError(t, err)
+
+	t.Run("Should mask configured fields at any depth", func(t *testing.T) {
+		line := redactor.Redact([]byte(`{"level":"info","password":"hunter2","headers":{"authorization":"secret"},"message":"login"}` + "\n"))
+
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(line, &fields))
+		assert.Equal(t, "[REDACTED]", fields["password"])
+		assert.Equal(t, "[REDACTED]", fields["headers"].(map[string]any)["authorization"])
+		assert.Equal(t, "login", fields["message"])
+		assert.True(t, strings.HasSuffix(string(line), "\n"))
+	})
+
+	t.Run("Should mask patterns inside strings", func(t *testing.T) {
+		line := redactor.Redact([]byte(`{"error":"user jane@example.com sent Bearer abc.def"}`))
+
+		assert.Equal(t, `{"error":"user [REDACTED] sent [REDACTED]"}`+"\n", string(line))
+	})
+
+	t.Run("Should leave clean lines untouched", func(t *testing.T) {
+		clean := []byte(`{"level":"info","message":"ok","count":3}` + "\n")
+
+		assert.Equal(t, clean, redactor.Redact(clean))
+	})
+
+	t.Run("Should reject unknown patterns", func(t *testing.T) {
+		_, err := adapters.NewRedactor(nil, []string{"phone"})
+		assert.Error(t, err)
+	})
+}
+
+func newFileLogging(t *testing.T, levels ...string) (*adapters.Logging, string) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	logging, err := adapters.NewLogger(&config.Config{
+		ENVIRONMENT:         "dev",
+		LOG_LEVEL:           "info",
+		LOG_LEVELS:          levels,
+		LOG_OUTPUT:          adapters.LogOutputFile,
+		LOG_FILE_PATH:       path,
+		LOG_REDACT_FIELDS:   []string{"password"},
+		LOG_REDACT_PATTERNS: []string{"email"},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = logging.Close() })
+
+	return logging, path
+}
+
+func readLog(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestLogging(t *testing.T) {
+	t.Run("Should write redacted JSON lines to the log file", func(t *testing.T) {
+		logging, path := newFileLogging(t)
+
+		logger := logging.Logger()
+		logger.Info().Str("password", "hunter2").Msg("signed up jane@example.com")
+
+		content := readLog(t, path)
+		assert.Contains(t, content, `"message":"signed up [REDACTED]"`)
+		assert.NotContains(t, content, "hunter2")
+	})
+
+	t.Run("Should follow the level of each component, also when changed at runtime", func(t *testing.T) {
+		logging, path := newFileLogging(t, "storage=debug")
+
+		storage, server := logging.Component("storage"), logging.Component("server")
+		storage.Debug().Msg("storage debug")
+		server.Debug().Msg("server debug")
+
+		logging.Levels.Set("server", zerolog.DebugLevel)
+		logging.Levels.Set("storage", zerolog.ErrorLevel)
+		storage.Warn().Msg("storage warn")
+		server.Debug().Msg("server debug again")
+
+		content := readLog(t, path)
+		assert.Contains(t, content, `"component":"storage"`)
+		assert.Contains(t, content, "storage debug")
+		assert.NotContains(t, content, `"server debug"`)
+		assert.NotContains(t, content, "storage warn")
+		assert.Contains(t, content, "server debug again")
+	})
+
+	t.Run("Should reject invalid component levels and outputs", func(t *testing.T) {
+		_, err := adapters.NewLogger(&config.Config{LOG_LEVELS: []string{"storage"}})
+		assert.Error(t, err)
+
+		_, err = adapters.NewLogger(&config.Config{LOG_OUTPUT: "syslog"})
+		assert.Error(t, err)
+	})
+}
+
+func TestAdminLogLevels(t *testing.T) {
+	levels := adapters.NewLogLevels(zerolog.InfoLevel)
+	keys := services.NewAPIKeyService(db.NewMemoryAPIKeyStore())
+	_, secret := createAPIKey(t, keys, db.ScopeAdmin)
+	admin := map[string]string{"X-API-Key": secret}
+	router := chi.NewRouter()
+	routes.SetupAdminRoutes(router, &routes.AdminHandler{LogLevels: levels}, middlewares.NewAPIKeyAuth(keys))
+
+	rec := serve(router, http.MethodPut, "/admin/log-levels", `{"component":"storage","level":"debug"}`, admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, zerolog.DebugLevel, levels.Level("storage"))
+	assert.JSONEq(t, `{"default":"info","components":{"storage":"debug"}}`, rec.Body.String())
+
+	rec = serve(router, http.MethodPut, "/admin/log-levels", `{"level":"loud"}`, admin)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, zerolog.InfoLevel, levels.Level(""))
+
+	rec = serve(router, http.MethodDelete, "/admin/log-levels/storage", "", admin)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, zerolog.InfoLevel, levels.Level("storage"))
+
+	rec = serve(router, http.MethodPut, "/admin/log-levels", `{"level":"debug"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminLogLevelsWithoutAuth(t *testing.T) {
+	levels := adapters.NewLogLevels(zerolog.InfoLevel)
+	router := chi.NewRouter()
+	routes.SetupAdminRoutes(router, &routes.AdminHandler{LogLevels: levels}, nil)
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/admin/log-levels", "", nil).Code)
+
+	rec := serve(router, http.MethodPut, "/admin/log-levels", `{"level":"debug"}`, nil)
+	assert.NotEqual(t, http.StatusOK, rec.Code)
+	assert.Equal(t, zerolog.InfoLevel, levels.Level(""))
+	assert.NotEqual(t, http.StatusOK, serve(router, http.MethodDelete, "/admin/log-levels/storage", "", nil).Code)
+}
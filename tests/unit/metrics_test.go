@@ -0,0 +1,80 @@
+package unit
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/metrics"
+	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("Should count requests by route pattern and status", func(t *testing.T) {
+		m := metrics.New()
+		service := &mocks.FakeTaskService{
+			GetFunc: func(ctx context.Context, id string) (*db.Tasks, error) {
+				return nil, &db.RepositoryError{Kind: db.KindNotFound}
+			},
+		}
+		router := chi.NewRouter()
+		router.Use(m.Middleware)
+		routes.SetupRoutes(router, routes.NewTaskHandler(service, zerolog.Nop()), db.NewMemoryIdempotencyStore(0, 0), nil, nil, nil)
+
+		serve(router, http.MethodGet, "/tasks/507f1f77bcf86cd799439011", "", nil)
+		serve(router, http.MethodGet, "/tasks/507f1f77bcf86cd799439012", "", nil)
+		serve(router, http.MethodGet, "/nowhere", "", nil)
+
+		body := scrape(t, m)
+		assert.Contains(t, body, `gsn_http_requests_total{method="GET",route="/tasks/{id}",status="404"} 2`)
+		assert.Contains(t, body, `gsn_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+		assert.Contains(t, body, `gsn_http_request_duration_seconds_count{method="GET",route="/tasks/{id}",status="404"} 2`)
+		assert.Contains(t, body, "gsn_http_requests_in_flight 0")
+		assert.Contains(t, body, "go_goroutines")
+	})
+
+	t.Run("Should time store operations and count failures by kind", func(t *testing.T) {
+		m := metrics.New()
+		store := m.InstrumentTaskStore(db.NewMemoryStore())
+
+		_, err := store.CreateTodo(context.Background(), &db.CreateNewTask{Title: "Task 1", Timestamp: &mocks.GetSampleTask("Task 1").Timestamp})
+		require.NoError(t, err)
+		_, err = store.GetTaskById(context.Background(), "507f1f77bcf86cd799439011")
+		require.Error(t, err)
+
+		body := scrape(t, m)
+		assert.Contains(t, body, `gsn_store_operation_duration_seconds_count{operation="CreateTodo"} 1`)
+		assert.Contains(t, body, `gsn_store_operation_errors_total{kind="not_found",operation="GetTaskById"} 1`)
+		assert.NotContains(t, body, `gsn_store_operation_errors_total{kind="not_found",operation="CreateTodo"}`)
+	})
+
+	t.Run("Should follow the MongoDB pool events", func(t *testing.T) {
+		m := metrics.New()
+		for _, eventType := range []string{event.ConnectionCreated, event.ConnectionCreated, event.ConnectionCheckedOut, event.ConnectionClosed} {
+			m.ObservePoolEvent(&event.PoolEvent{Type: eventType, Address: "mongo:27017"})
+		}
+
+		body := scrape(t, m)
+		assert.Contains(t, body, `gsn_mongo_pool_connections{address="mongo:27017"} 1`)
+		assert.Contains(t, body, `gsn_mongo_pool_connections_in_use{address="mongo:27017"} 1`)
+	})
+}
@@ -0,0 +1,219 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/gsn_manager_service/src/services"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestApplyPatch(t *testing.T) {
+	document := []byte(`{"title":"Groceries","completed":false,"version":2}`)
+
+	t.Run("Should merge a merge patch and remove null members", func(t *testing.T) {
+		patched, err := utils.ApplyPatch("application/merge-patch+json", document, []byte(`{"completed":true,"title":null}`))
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"completed":true,"version":2}`, string(patched))
+	})
+
+	t.Run("Should apply a JSON patch whose test operations hold", func(t *testing.T) {
+		patch := `[{"op":"test","path":"/version","value":2},{"op":"replace","path":"/title","value":"Errands"}]`
+
+		patched, err := utils.ApplyPatch("application/json-patch+json; charset=utf-8", document, []byte(patch))
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"title":"Errands","completed":false,"version":2}`, string(patched))
+	})
+
+	t.Run("Should report a failed test operation", func(t *testing.T) {
+		patch := `[{"op":"test","path":"/version","value":1},{"op":"remove","path":"/title"}]`
+
+		_, err := utils.ApplyPatch(utils.JSONPatchContentType, document, []byte(patch))
+
+		assert.ErrorIs(t, err, utils.ErrPatchTestFailed)
+	})
+
+	t.Run("Should reject patches that can not be applied or decoded", func(t *testing.T) {
+		var patchErr *utils.PatchError
+		_, err := utils.ApplyPatch(utils.JSONPatchContentType, document, []byte(`[{"op":"remove","path":"/priority"}]`))
+		assert.True(t, errors.As(err, &patchErr))
+
+		var decodeErr *utils.DecodeError
+		_, err = utils.ApplyPatch(utils.MergePatchContentType, document, []byte(`["title"]`))
+		assert.True(t, errors.As(err, &decodeErr))
+
+		_, err = utils.ApplyPatch("application/json", document, []byte(`{}`))
+		assert.ErrorIs(t, err, utils.ErrUnsupportedPatch)
+	})
+}
+
+func TestPatchTask(t *testing.T) {
+	ctx := context.Background()
+	setTitle := func(title string) func(*db.Tasks) (*db.TaskPatch, error) {
+		return func(*db.Tasks) (*db.TaskPatch, error) {
+			return &db.TaskPatch{Set: db.UpdateTask{Title: &title}}, nil
+		}
+	}
+
+	t.Run("Should start over when the task changes before the write", func(t *testing.T) {
+		task := existingTask("Original", 1)
+		mockCollection := &mocks.MockCollection{}
+		mockCollection.FindOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(task, nil, bson.NewRegistry())
+		}
+
+		var updates []bson.M
+		mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+			updates = append(updates, update.(bson.M))
+			if len(updates) == 1 {
+				task.Version++
+				return &mongo.UpdateResult{MatchedCount: 0}, nil
+			}
+			return &mongo.UpdateResult{MatchedCount: 1}, nil
+		}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		result, err := repo.PatchTask(ctx, task.ID.Hex(), nil, setTitle("Patched"))
+
+		assert.NoError(t, err)
+		assert.Len(t, updates, 2)
+		assert.Equal(t, "Patched", result.Title)
+		assert.Equal(t, int64(3), result.Version)
+		assert.NotContains(t, updates[1], "$unset")
+	})
+
+	t.Run("Should report a version mismatch when If-Match is stale", func(t *testing.T) {
+		task := existingTask("Original", 4)
+		mockCollection := &mocks.MockCollection{}
+		mockCollection.FindOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(task, nil, bson.NewRegistry())
+		}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		stale := int64(3)
+		_, err := repo.PatchTask(ctx, task.ID.Hex(), &stale, setTitle("Patched"))
+
+		assert.ErrorIs(t, err, db.ErrVersionMismatch)
+	})
+
+	t.Run("Should give up with a conflict when the task keeps changing", func(t *testing.T) {
+		task := existingTask("Original", 1)
+		mockCollection := &mocks.MockCollection{}
+		mockCollection.FindOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(task, nil, bson.NewRegistry())
+		}
+		mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+			return &mongo.UpdateResult{MatchedCount: 0}, nil
+		}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		_, err := repo.PatchTask(ctx, task.ID.Hex(), nil, setTitle("Patched"))
+
+		assert.ErrorIs(t, err, db.ErrConflict)
+	})
+}
+
+func TestPatchTaskService(t *testing.T) {
+	task := existingTask("Groceries", 2)
+	mockCollection := &mocks.MockCollection{}
+	mockCollection.FindOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+		return mongo.NewSingleResultFromDocument(task, nil, bson.NewRegistry())
+	}
+	mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+		return &mongo.UpdateResult{MatchedCount: 1}, nil
+	}
+	service := services.NewTaskService(mocks.TestTaskRepository(nil, nil, mockCollection), nil, nil)
+	handler := routes.NewTaskHandler(service, zerolog.Nop())
+
+	router := chi.NewRouter()
+	router.Patch("/tasks/{id}", handler.PatchTask)
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/tasks/"+task.ID.Hex(), strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Should apply a merge patch and return the new ETag", func(t *testing.T) {
+		rec := patch(utils.MergePatchContentType, `{"completed":true}`)
+
+		var body db.Tasks
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.True(t, body.Completed)
+		assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	})
+
+	t.Run("Should refuse changes to read-only fields", func(t *testing.T) {
+		rec := patch(utils.JSONPatchContentType, `[{"op":"replace","path":"/version","value":10}]`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "version can not be changed")
+	})
+
+	t.Run("Should validate the patched task with the update rules", func(t *testing.T) {
+		rec := patch(utils.MergePatchContentType, `{"title":"ab"}`)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		assert.Contains(t, rec.Body.String(), "title must be at least 3 characters long")
+	})
+
+	t.Run("Should answer 409 when a test operation fails", func(t *testing.T) {
+		rec := patch(utils.JSONPatchContentType, `[{"op":"test","path":"/title","value":"Errands"}]`)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("Should answer 415 with Accept-Patch for other media types", func(t *testing.T) {
+		rec := patch("application/json", `{"completed":true}`)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.Equal(t, utils.AcceptPatch, rec.Header().Get("Accept-Patch"))
+	})
+
+	t.Run("Should answer 415 before looking up the task", func(t *testing.T) {
+		called := false
+		service := &mocks.FakeTaskService{
+			GetFunc: func(ctx context.Context, id string) (*db.Tasks, error) {
+				called = true
+				return nil, db.ErrNotFound
+			},
+			PatchFunc: func(ctx context.Context, id string, expectedVersion *int64, contentType string, patch []byte) (*db.Tasks, error) {
+				called = true
+				return nil, db.ErrNotFound
+			},
+		}
+
+		rec := serve(newTestRouter(service), http.MethodPatch, "/tasks/"+bson.NewObjectID().Hex(), `{"completed":true}`, map[string]string{
+			"Content-Type": "text/plain",
+			"If-Match":     `"1", "2"`,
+		})
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.False(t, called, "the service should not be called")
+	})
+
+	t.Run("Should accept media type parameters", func(t *testing.T) {
+		rec := patch(utils.MergePatchContentType+"; charset=utf-8", `{"completed":false}`)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -0,0 +1,193 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/config"
+	"github.com/gsn_manager_service/src/connections"
+	"github.com/gsn_manager_service/src/health"
+	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/gsn_manager_service/tests/mocks"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadiness(t *testing.T) {
+	var ready atomic.Bool
+	service := &mocks.FakeTaskService{
+		GetFunc: func(ctx context.Context, id string) (*db.Tasks, error) {
+			return mocks.GetSampleTask("Task 1"), nil
+		},
+	}
+	checker := health.NewChecker(time.Second, health.Check{Name: "startup", Run: func(context.Context) error {
+		if !ready.Load() {
+			return errors.New("waiting for the database")
+		}
+		return nil
+	}})
+	router := chi.NewRouter()
+	routes.SetupRoutes(router, routes.NewTaskHandler(service, zerolog.Nop()), db.NewMemoryIdempotencyStore(0, 0), ready.Load, checker, nil)
+
+	t.Run("Should answer 503 while the database is not ready", func(t *testing.T) {
+		rec := serve(router, http.MethodGet, "/tasks/507f1f77bcf86cd799439011", "", nil)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "5", rec.Header().Get("Retry-After"))
+		assert.Equal(t, "/problems/service-unavailable", decodeProblem(t, rec).Type)
+		assert.Equal(t, http.StatusServiceUnavailable, serve(router, http.MethodGet, "/readyz", "", nil).Code)
+		assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/healthz", "", nil).Code)
+	})
+
+	t.Run("Should serve requests once the database is ready", func(t *testing.T) {
+		ready.Store(true)
+
+		assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/tasks/507f1f77bcf86cd799439011", "", nil).Code)
+		assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/readyz", "", nil).Code)
+	})
+}
+
+func TestReadyz(t *testing.T) {
+	newRouter := func(checker *health.Checker) *chi.Mux {
+		router := chi.NewRouter()
+		routes.SetupRoutes(router, routes.NewTaskHandler(&mocks.FakeTaskService{}, zerolog.Nop()), db.NewMemoryIdempotencyStore(0, 0), nil, checker, nil)
+		return router
+	}
+	decodeReport := func(t *testing.T, rec *httptest.ResponseRecorder) health.Report {
+		var report health.Report
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		return report
+	}
+	failing := health.Check{Name: "mongo", Run: func(context.Context) error { return errors.New("connection refused") }}
+	passing := health.Check{Name: "sql", Run: func(context.Context) error { return nil }}
+
+	t.Run("Should report the status and latency of every check", func(t *testing.T) {
+		rec := serve(newRouter(health.NewChecker(time.Second, passing)), http.MethodGet, "/readyz", "", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		report := decodeReport(t, rec)
+		assert.Equal(t, health.StatusOK, report.Status)
+		assert.Equal(t, []string{"shutdown", "sql"}, []string{report.Checks[0].Name, report.Checks[1].Name})
+		assert.GreaterOrEqual(t, report.Checks[1].LatencyMs, 0.0)
+	})
+
+	t.Run("Should only explain failures in verbose mode", func(t *testing.T) {
+		router := newRouter(health.NewChecker(time.Second, passing, failing))
+
+		rec := serve(router, http.MethodGet, "/readyz", "", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Empty(t, decodeReport(t, rec).Checks[2].Detail)
+
+		rec = serve(router, http.MethodGet, "/readyz?verbose", "", nil)
+		report := decodeReport(t, rec)
+		assert.Equal(t, health.StatusError, report.Checks[2].Status)
+		assert.Equal(t, "connection refused", report.Checks[2].Detail)
+		assert.Equal(t, health.StatusOK, report.Checks[1].Status)
+	})
+
+	t.Run("Should fail a check that outlives the timeout", func(t *testing.T) {
+		slow := health.Check{Name: "mongo", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}
+
+		rec := serve(newRouter(health.NewChecker(10*time.Millisecond, slow)), http.MethodGet, "/readyz?verbose", "", nil)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, context.DeadlineExceeded.Error(), decodeReport(t, rec).Checks[1].Detail)
+	})
+
+	t.Run("Should turn not ready while draining but stay alive", func(t *testing.T) {
+		checker := health.NewChecker(time.Second, passing)
+		router := newRouter(checker)
+		checker.Drain()
+
+		rec := serve(router, http.MethodGet, "/readyz?verbose", "", nil)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.Equal(t, "shutting down", decodeReport(t, rec).Checks[0].Detail)
+		assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/livez", "", nil).Code)
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := adapters.RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond}
+
+	t.Run("Should double the backoff up to the maximum, minus jitter", func(t *testing.T) {
+		for attempt, want := range []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond} {
+			backoff := policy.Backoff(attempt)
+			assert.GreaterOrEqual(t, backoff, want/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, backoff, want, "attempt %d", attempt)
+		}
+		assert.LessOrEqual(t, policy.Backoff(200), policy.MaxBackoff)
+	})
+
+	t.Run("Should stop retrying once the attempts are used up", func(t *testing.T) {
+		calls := 0
+		err := policy.Do(context.Background(), zerolog.Nop(), "test", func(ctx context.Context) error {
+			calls++
+			return errors.New("unreachable")
+		})
+
+		assert.EqualError(t, err, "unreachable")
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Should return as soon as the operation succeeds", func(t *testing.T) {
+		calls := 0
+		err := policy.Do(context.Background(), zerolog.Nop(), "test", func(ctx context.Context) error {
+			calls++
+			if calls < 2 {
+				return errors.New("unreachable")
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Should give up retrying forever when the context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		forever := adapters.RetryPolicy{Attempts: -1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+		calls := 0
+		err := forever.Do(ctx, zerolog.Nop(), "test", func(ctx context.Context) error {
+			calls++
+			if calls == 5 {
+				cancel()
+			}
+			return errors.New("unreachable")
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, 5, calls)
+	})
+}
+
+func TestWaitReady(t *testing.T) {
+	t.Run("Should not wait when the database was ready at startup", func(t *testing.T) {
+		conns, err := connections.StartConnections(&config.Config{STORAGE_BACKEND: config.BackendMemory}, zerolog.Nop(), nil, nil)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.True(t, conns.WaitReady(ctx))
+		assert.True(t, conns.Ready())
+	})
+}
+
+func TestStartConnections(t *testing.T) {
+	t.Run("Should refuse an unknown storage backend", func(t *testing.T) {
+		_, err := connections.StartConnections(&config.Config{STORAGE_BACKEND: "mongodb"}, zerolog.Nop(), nil, nil)
+		assert.ErrorContains(t, err, "unknown STORAGE_BACKEND")
+	})
+}
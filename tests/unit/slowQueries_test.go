@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/server/routes"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+)
+
+func marshalCommand(t *testing.T, command bson.D) bson.Raw {
+	raw, err := bson.Marshal(command)
+	require.NoError(t, err)
+	return raw
+}
+
+// runCommand replays the events the driver sends for a command taking duration
+func runCommand(monitor *event.CommandMonitor, ctx context.Context, id int64, name string, command bson.Raw, duration time.Duration) {
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, CommandName: name, DatabaseName: "table", RequestID: id, ConnectionID: "conn"})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{
+		CommandName: name, DatabaseName: "table", RequestID: id, ConnectionID: "conn", Duration: duration,
+	}})
+}
+
+func TestQueryShape(t *testing.T) {
+	t.Run("Should redact values and keep sort directions", func(t *testing.T) {
+		command := marshalCommand(t, bson.D{
+			{Key: "find", Value: "tasks"},
+			{Key: "filter", Value: bson.D{
+				{Key: "title", Value: "jane@example.com"},
+				{Key: "deleted_at", Value: nil},
+				{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: time.Now()}}},
+				{Key: "$or", Value: bson.A{bson.D{{Key: "completed", Value: true}}, bson.D{{Key: "completed", Value: false}}}},
+				{Key: "_id", Value: bson.D{{Key: "$in", Value: bson.A{1, 2, 3}}}},
+			}},
+			{Key: "sort", Value: bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: 1}}},
+		})
+
+		shape := adapters.QueryShapeOf(command, []string{"filter", "sort"})
+
+		assert.Equal(t, "filter={$or: [{completed: ?}], _id: {$in: ?}, deleted_at: ?, timestamp: {$gte: ?}, title: ?} sort={timestamp: -1, _id: 1}", shape)
+		assert.NotContains(t, shape, "jane")
+	})
+
+	t.Run("Should give the same shape whatever the order of the filter", func(t *testing.T) {
+		a := marshalCommand(t, bson.D{{Key: "count", Value: "tasks"}, {Key: "query", Value: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 2}}}})
+		b := marshalCommand(t, bson.D{{Key: "count", Value: "tasks"}, {Key: "query", Value: bson.D{{Key: "b", Value: 3}, {Key: "a", Value: 4}}}})
+
+		assert.Equal(t, adapters.QueryShapeOf(a, []string{"query"}), adapters.QueryShapeOf(b, []string{"query"}))
+	})
+}
+
+func TestSlowQueries(t *testing.T) {
+	find := func(field string) bson.Raw {
+		return marshalCommand(t, bson.D{{Key: "find", Value: "tasks"}, {Key: "filter", Value: bson.D{{Key: field, Value: 1}}}})
+	}
+
+	t.Run("Should log commands over the threshold with the request ID", func(t *testing.T) {
+		var buf bytes.Buffer
+		slow := adapters.NewSlowQueries(100*time.Millisecond, 10, zerolog.New(&buf))
+		monitor := slow.Monitor()
+		ctx := db.WithAudit(context.Background(), db.Audit{RequestID: "req-1"})
+
+		runCommand(monitor, ctx, 1, "find", find("title"), 10*time.Millisecond)
+		assert.Empty(t, buf.String())
+
+		runCommand(monitor, ctx, 2, "find", find("title"), 250*time.Millisecond)
+		assert.Contains(t, buf.String(), `"shape":"filter={title: ?}"`)
+		assert.Contains(t, buf.String(), `"collection":"tasks"`)
+		assert.Contains(t, buf.String(), `"duration_ms":250`)
+		assert.Contains(t, buf.String(), `"request_id":"req-1"`)
+	})
+
+	t.Run("Should ignore commands that do not query documents", func(t *testing.T) {
+		var buf bytes.Buffer
+		slow := adapters.NewSlowQueries(time.Millisecond, 10, zerolog.New(&buf))
+
+		runCommand(slow.Monitor(), context.Background(), 1, "ping", marshalCommand(t, bson.D{{Key: "ping", Value: 1}}), time.Second)
+
+		assert.Empty(t, buf.String())
+		assert.Empty(t, slow.Top())
+	})
+
+	t.Run("Should keep the slowest shapes first", func(t *testing.T) {
+		slow := adapters.NewSlowQueries(100*time.Millisecond, 2, zerolog.Nop())
+		monitor := slow.Monitor()
+
+		runCommand(monitor, context.Background(), 1, "find", find("a"), 50*time.Millisecond)
+		runCommand(monitor, context.Background(), 2, "find", find("b"), 300*time.Millisecond)
+		runCommand(monitor, context.Background(), 3, "find", find("c"), 120*time.Millisecond)
+		runCommand(monitor, context.Background(), 4, "find", find("b"), 100*time.Millisecond)
+
+		top := slow.Top()
+		require.Len(t, top, 2)
+		assert.Equal(t, "filter={b: ?}", top[0].Shape)
+		assert.Equal(t, int64(2), top[0].Count)
+		assert.Equal(t, int64(2), top[0].SlowCount)
+		assert.Equal(t, float64(300), top[0].MaxMs)
+		assert.Equal(t, float64(200), top[0].AvgMs)
+		assert.Equal(t, "filter={c: ?}", top[1].Shape)
+	})
+
+	t.Run("Should serve the slowest shapes on the admin endpoint", func(t *testing.T) {
+		slow := adapters.NewSlowQueries(time.Millisecond, 10, zerolog.Nop())
+		runCommand(slow.Monitor(), context.Background(), 1, "find", find("title"), 5*time.Millisecond)
+
+		router := chi.NewRouter()
+		routes.SetupAdminRoutes(router, &routes.AdminHandler{SlowQueries: slow}, nil)
+		rec := serve(router, http.MethodGet, "/admin/slow-queries", "", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"shape":"filter={title: ?}"`)
+	})
+}
@@ -0,0 +1,134 @@
+package unit
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTaskListQuery(t *testing.T) {
+	t.Run("Should return the default query when no parameters are passed", func(t *testing.T) {
+		query, err := db.ParseTaskListQuery(url.Values{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, db.DefaultTaskListQuery(), query)
+	})
+
+	t.Run("Should parse every supported filter, sort and page parameter", func(t *testing.T) {
+		values := url.Values{
+			"completed":      {"true"},
+			"title":          {"groceries"},
+			"timestamp_from": {"2025-01-01T00:00:00Z"},
+			"timestamp_to":   {"2025-02-01T00:00:00Z"},
+			"created_from":   {"2024-12-01T00:00:00Z"},
+			"updated_to":     {"2025-03-01T10:00:00+02:00"},
+			"sort":           {"timestamp:desc"},
+			"limit":          {"50"},
+			"offset":         {"100"},
+		}
+
+		query, err := db.ParseTaskListQuery(values)
+
+		assert.Nil(t, err)
+		assert.True(t, *query.Filter.Completed)
+		assert.Equal(t, "groceries", query.Filter.Title)
+		assert.True(t, query.Filter.TimestampFrom.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.True(t, query.Filter.TimestampTo.Equal(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)))
+		assert.NotNil(t, query.Filter.CreatedFrom)
+		assert.Nil(t, query.Filter.CreatedTo)
+		assert.True(t, query.Filter.UpdatedTo.Equal(time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)))
+		assert.Equal(t, db.TaskSort{Field: "timestamp", Desc: true}, query.Sort)
+		assert.Equal(t, int64(50), query.Limit)
+		assert.Equal(t, int64(100), query.Offset)
+	})
+
+	t.Run("Should reject invalid parameters with the offending parameter name", func(t *testing.T) {
+		cases := map[string]url.Values{
+			"completed":      {"completed": {"maybe"}},
+			"timestamp_from": {"timestamp_from": {"yesterday"}},
+			"created_from":   {"created_from": {"2025-02-01T00:00:00Z"}, "created_to": {"2025-01-01T00:00:00Z"}},
+			"sort":           {"sort": {"priority"}},
+			"limit":          {"limit": {"1000"}},
+			"offset":         {"offset": {"-1"}},
+			"page":           {"page": {"2"}},
+		}
+
+		for param, values := range cases {
+			query, err := db.ParseTaskListQuery(values)
+
+			var queryErr *db.QueryError
+			assert.Nil(t, query)
+			assert.True(t, errors.As(err, &queryErr), param)
+			assert.Equal(t, param, queryErr.Param)
+		}
+	})
+
+	t.Run("Should reject an invalid sort direction", func(t *testing.T) {
+		_, err := db.ParseTaskListQuery(url.Values{"sort": {"title:up"}})
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "direction must be asc or desc")
+	})
+
+	t.Run("Should reject repeated parameters", func(t *testing.T) {
+		_, err := db.ParseTaskListQuery(url.Values{"completed": {"true", "false"}})
+
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "must be provided only once")
+	})
+}
+
+func TestParseTaskWriteQuery(t *testing.T) {
+	t.Run("Should parse the filter and dry run flag", func(t *testing.T) {
+		query, err := db.ParseTaskWriteQuery(url.Values{
+			"timestamp_to": {"2025-01-01T00:00:00Z"},
+			"dry_run":      {"true"},
+		})
+
+		assert.Nil(t, err)
+		assert.True(t, query.Filter.TimestampTo.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.True(t, query.DryRun)
+		assert.False(t, query.Confirmed)
+	})
+
+	t.Run("Should refuse an empty filter unless it is confirmed", func(t *testing.T) {
+		_, err := db.ParseTaskWriteQuery(url.Values{})
+
+		var queryErr *db.QueryError
+		assert.True(t, errors.As(err, &queryErr))
+		assert.Equal(t, "confirm", queryErr.Param)
+
+		query, err := db.ParseTaskWriteQuery(url.Values{"confirm": {"all"}})
+		assert.Nil(t, err)
+		assert.True(t, query.Confirmed)
+		assert.True(t, query.Filter.IsEmpty())
+	})
+
+	t.Run("Should allow a dry run with an empty filter", func(t *testing.T) {
+		query, err := db.ParseTaskWriteQuery(url.Values{"dry_run": {"true"}})
+
+		assert.Nil(t, err)
+		assert.True(t, query.DryRun)
+	})
+
+	t.Run("Should reject listing parameters and unexpected confirmations", func(t *testing.T) {
+		cases := map[string]url.Values{
+			"sort":    {"completed": {"true"}, "sort": {"title"}},
+			"confirm": {"completed": {"true"}, "confirm": {"yes"}},
+			"dry_run": {"completed": {"true"}, "dry_run": {"sure"}},
+		}
+
+		for param, values := range cases {
+			query, err := db.ParseTaskWriteQuery(values)
+
+			var queryErr *db.QueryError
+			assert.Nil(t, query)
+			assert.True(t, errors.As(err, &queryErr), param)
+			assert.Equal(t, param, queryErr.Param)
+		}
+	})
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/gsn_manager_service/src/adapters/db"
 	"github.com/gsn_manager_service/tests/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -81,16 +83,78 @@ func TestGetAllTasks(t *testing.T) {
 			return cursor, err
 		}
 
+		mockCollection.CountDocumentsFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+			return int64(len(expectedTasks)), nil
+		}
+
 		// Act
-		result, err := repo.GetAllTasks(ctx)
+		result, err := repo.GetAllTasks(ctx, db.DefaultTaskListQuery())
 
 		// Assert
 		assert.Nil(t, err)
-		assert.Equal(t, len(result), len(expectedTasks))
+		assert.Equal(t, len(result.Items), len(expectedTasks))
+		assert.Equal(t, result.Total, int64(len(expectedTasks)))
+		assert.Equal(t, result.Limit, int64(db.DefaultTaskListLimit))
+		assert.False(t, result.HasMore)
+
+		for i, task := range result.Items {
+			assert.Equal(t, task.Title, expectedTasks[i].Title)
+		}
+	})
+
+	t.Run("Should report more pages when the total exceeds the current page", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		expectedTasks := append(mocks.GetMultipleTasks(), *mocks.GetSampleTask("Task 3"))
+		query := db.DefaultTaskListQuery()
+		query.Limit = 2
+
+		mockCollection.FindFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+			var docs []any
+			for _, task := range expectedTasks {
+				docs = append(docs, task)
+			}
+
+			return mongo.NewCursorFromDocuments(docs, nil, nil)
+		}
+
+		mockCollection.CountDocumentsFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+			return 5, nil
+		}
+
+		result, err := repo.GetAllTasks(ctx, query)
+
+		assert.Nil(t, err)
+		assert.Equal(t, len(result.Items), 2)
+		assert.Equal(t, result.Total, int64(5))
+		assert.True(t, result.HasMore)
+		assert.False(t, result.HasPrev)
+	})
+
+	t.Run("Should walk backwards from a cursor and keep the requested order", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		first, second := mocks.GetSampleTask("Task 1"), mocks.GetSampleTask("Task 2")
+		query := db.DefaultTaskListQuery()
+		query.Limit = 1
+		query.Cursor = &db.PageCursor{ID: bson.NewObjectID(), Backward: true}
 
-		for i, task := range result {
-			assert.Equal(t, task.Title, result[i].Title)
+		var usedFilter any
+		mockCollection.FindFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+			usedFilter = filter
+			return mongo.NewCursorFromDocuments([]any{second, first}, nil, nil)
 		}
+
+		result, err := repo.GetAllTasks(ctx, query)
+
+		assert.Nil(t, err)
+		assert.Equal(t, len(result.Items), 1)
+		assert.Equal(t, result.Items[0].ID, second.ID)
+		assert.True(t, result.HasMore)
+		assert.True(t, result.HasPrev)
+		assert.Contains(t, usedFilter, "$and")
 	})
 
 	t.Run("Should successfully return an empty slice when there is no tasks", func(t *testing.T) {
@@ -104,12 +168,13 @@ func TestGetAllTasks(t *testing.T) {
 			return cursor, err
 		}
 
-		taskList, err := repo.GetAllTasks(ctx)
+		taskList, err := repo.GetAllTasks(ctx, db.DefaultTaskListQuery())
 
 		assert.Nil(t, err)
 		assert.NotNil(t, taskList)
-		assert.Equal(t, emptyArr, taskList)
-		assert.Equal(t, len(taskList), 0)
+		assert.Equal(t, emptyArr, taskList.Items)
+		assert.Equal(t, len(taskList.Items), 0)
+		assert.Equal(t, taskList.Total, int64(0))
 	})
 
 	t.Run("Should return an error when there is a db failure while retrieving the tasks", func(t *testing.T) {
@@ -121,7 +186,7 @@ func TestGetAllTasks(t *testing.T) {
 			return nil, expectedDbError
 		}
 
-		taskList, err := repo.GetAllTasks(ctx)
+		taskList, err := repo.GetAllTasks(ctx, db.DefaultTaskListQuery())
 
 		assert.Nil(t, taskList)
 		assert.NotNil(t, err)
@@ -156,6 +221,31 @@ func TestGetTaskById(t *testing.T) {
 		assert.False(t, result.Timestamp.IsZero())
 		assert.False(t, result.CreatedAt.IsZero())
 	})
+
+	t.Run("Should return an invalid id error for a malformed ObjectID", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		result, err := repo.GetTaskById(ctx, "not-an-id")
+
+		assert.Nil(t, result)
+		assert.True(t, errors.Is(err, db.ErrInvalidID))
+	})
+
+	t.Run("Should return a not found error when no task matches", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		mockCollection.FindOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, bson.NewRegistry())
+		}
+
+		result, err := repo.GetTaskById(ctx, bson.NewObjectID().Hex())
+
+		assert.Nil(t, result)
+		assert.True(t, errors.Is(err, db.ErrNotFound))
+		assert.False(t, errors.Is(err, db.ErrInvalidID))
+	})
 }
 
 func TestModifyTask(t *testing.T) {
@@ -177,7 +267,7 @@ func TestModifyTask(t *testing.T) {
 		}
 
 		// Act
-		taskUpdated, err := repo.ModifyTask(ctx, taskID, payload)
+		taskUpdated, err := repo.ModifyTask(ctx, taskID, payload, nil)
 
 		assert.Nil(t, err)
 		assert.NotNil(t, taskUpdated)
@@ -195,32 +285,141 @@ func TestModifyTask(t *testing.T) {
 		taskId := bson.NewObjectID()
 		payload := &db.UpdateTask{}
 
-		updatedTask, err := repo.ModifyTask(ctx, taskId.Hex(), payload)
+		updatedTask, err := repo.ModifyTask(ctx, taskId.Hex(), payload, nil)
 
 		assert.NotNil(t, err)
 		assert.Nil(t, updatedTask)
-		assert.Equal(t, err.Error(), "payload can not be empty")
+		assert.True(t, errors.Is(err, db.ErrValidation))
+		assert.Contains(t, err.Error(), "payload can not be empty")
+	})
+}
+
+func TestModifyTaskVersioning(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should bump the version and only match the expected one", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		previous := mocks.GetSampleTask("Task 1")
+		previous.Version = 4
+		expected := int64(4)
+
+		var usedFilter, usedUpdate any
+		mockCollection.FindOneAndUpdateFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+			usedFilter, usedUpdate = filter, update
+			return mongo.NewSingleResultFromDocument(previous, nil, bson.NewRegistry())
+		}
+
+		updated, err := repo.ModifyTask(ctx, previous.ID.Hex(), mocks.GetSampleUpdateTaskPayload(), &expected)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(5), updated.Version)
+		assert.Equal(t, int64(4), usedFilter.(bson.M)["version"])
+		assert.Equal(t, bson.M{"version": 1}, usedUpdate.(bson.M)["$inc"])
+	})
+
+	t.Run("Should return a version mismatch when the task moved on", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		current := mocks.GetSampleTask("Task 1")
+		current.Version = 6
+		expected := int64(4)
+
+		mockCollection.FindOneAndUpdateFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, bson.NewRegistry())
+		}
+		mockCollection.FindOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(current, nil, bson.NewRegistry())
+		}
+
+		updated, err := repo.ModifyTask(ctx, current.ID.Hex(), mocks.GetSampleUpdateTaskPayload(), &expected)
+
+		assert.Nil(t, updated)
+		assert.True(t, errors.Is(err, db.ErrConflict))
+		assert.True(t, errors.Is(err, db.ErrVersionMismatch))
+	})
+
+	t.Run("Should return not found when the task is gone", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+		expected := int64(1)
+
+		notFound := func() *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, bson.NewRegistry())
+		}
+		mockCollection.FindOneAndUpdateFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+			return notFound()
+		}
+		mockCollection.FindOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+			return notFound()
+		}
+		mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+			return &mongo.UpdateResult{MatchedCount: 0}, nil
+		}
+
+		_, err := repo.DeleteTask(ctx, bson.NewObjectID().Hex(), &expected)
+		assert.True(t, errors.Is(err, db.ErrNotFound))
+
+		_, err = repo.ModifyTask(ctx, bson.NewObjectID().Hex(), mocks.GetSampleUpdateTaskPayload(), &expected)
+		assert.True(t, errors.Is(err, db.ErrNotFound))
+		assert.False(t, errors.Is(err, db.ErrVersionMismatch))
+	})
+}
+
+func TestReplaceTask(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Should overwrite every editable field, including the ones left at their zero value", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		previous := mocks.GetSampleTask("Task 1")
+		previous.Completed = true
+
+		var usedUpdate bson.M
+		mockCollection.FindOneAndUpdateFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+			usedUpdate = update.(bson.M)
+			return mongo.NewSingleResultFromDocument(previous, nil, bson.NewRegistry())
+		}
+
+		payload := mocks.GetSampleCreateTaskPayload()
+		replaced, err := repo.ReplaceTask(ctx, previous.ID.Hex(), payload, nil)
+
+		assert.Nil(t, err)
+		assert.False(t, replaced.Completed)
+		assert.Equal(t, payload.Title, replaced.Title)
+
+		set := usedUpdate["$set"].(bson.M)
+		assert.Equal(t, false, set["completed"])
+		assert.Equal(t, payload.Title, set["title"])
+		assert.Equal(t, *payload.Timestamp, set["timestamp"])
 	})
 }
 
 func TestDeleteTask(t *testing.T) {
 	ctx := context.Background()
-	t.Run("Should successfully delete a task and return their ID", func(t *testing.T) {
+	t.Run("Should move a task to the trash and return their ID", func(t *testing.T) {
 		mockCollection := &mocks.MockCollection{}
 		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
 		taskID := bson.NewObjectID()
 
-		mockCollection.DeleteOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
-			return &mongo.DeleteResult{
-				DeletedCount: 1,
+		var usedUpdate any
+		mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+			usedUpdate = update
+			return &mongo.UpdateResult{
+				MatchedCount:  1,
+				ModifiedCount: 1,
 			}, nil
 		}
 
-		deletedId, err := repo.DeleteTask(ctx, taskID.Hex())
+		deletedId, err := repo.DeleteTask(ctx, taskID.Hex(), nil)
 
 		// Assert
 		assert.Nil(t, err)
 		assert.Equal(t, deletedId, taskID)
+		assert.Contains(t, usedUpdate.(bson.M)["$set"], "deleted_at")
 	})
 
 	t.Run("Should return an error when delete process has failed", func(t *testing.T) {
@@ -228,11 +427,11 @@ func TestDeleteTask(t *testing.T) {
 		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
 		taskID := bson.NewObjectID()
 
-		mockCollection.DeleteOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
+		mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
 			return nil, errors.New("Error deleting task")
 		}
 
-		deletedId, err := repo.DeleteTask(ctx, taskID.Hex())
+		deletedId, err := repo.DeleteTask(ctx, taskID.Hex(), nil)
 
 		// Assert
 		assert.NotNil(t, err)
@@ -245,15 +444,113 @@ func TestDeleteTask(t *testing.T) {
 		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
 		taskID := bson.NewObjectID()
 
-		mockCollection.DeleteOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
-			return &mongo.DeleteResult{DeletedCount: 0}, nil
+		mockCollection.UpdateOneFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+			return &mongo.UpdateResult{MatchedCount: 0}, nil
 		}
 
-		deletedId, err := repo.DeleteTask(ctx, taskID.Hex())
+		deletedId, err := repo.DeleteTask(ctx, taskID.Hex(), nil)
 
 		// Assert
-		assert.Equal(t, err, mongo.ErrNoDocuments)
+		assert.True(t, errors.Is(err, db.ErrNotFound))
+		assert.True(t, errors.Is(err, mongo.ErrNoDocuments))
 		assert.Equal(t, deletedId, bson.NilObjectID)
-		assert.Equal(t, err.Error(), "mongo: no documents in result")
+	})
+}
+
+func TestRestoreTask(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Should take a task out of the trash", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+		task := mocks.GetSampleTask("Task 1")
+
+		var usedFilter any
+		mockCollection.FindOneAndUpdateFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+			usedFilter = filter
+			return mongo.NewSingleResultFromDocument(task, nil, bson.NewRegistry())
+		}
+
+		restored, err := repo.RestoreTask(ctx, task.ID.Hex())
+
+		assert.Nil(t, err)
+		assert.Equal(t, restored.ID, task.ID)
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, bson.M{"$ne": nil}, usedFilter.(bson.M)["deleted_at"])
+	})
+
+	t.Run("Should return a not found error when the task is not in the trash", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+
+		mockCollection.FindOneAndUpdateFunc = func(ctx context.Context, filter any, update any, opts ...options.Lister[options.FindOneAndUpdateOptions]) *mongo.SingleResult {
+			return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, bson.NewRegistry())
+		}
+
+		restored, err := repo.RestoreTask(ctx, bson.NewObjectID().Hex())
+
+		assert.Nil(t, restored)
+		assert.True(t, errors.Is(err, db.ErrNotFound))
+	})
+}
+
+func TestPurgeTask(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Should permanently delete a task", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+		taskID := bson.NewObjectID()
+
+		mockCollection.DeleteOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
+			return &mongo.DeleteResult{DeletedCount: 1}, nil
+		}
+
+		purgedId, err := repo.PurgeTask(ctx, taskID.Hex())
+
+		assert.Nil(t, err)
+		assert.Equal(t, purgedId, taskID)
+	})
+
+	t.Run("Should only purge the trash older than the cutoff and record each purge", func(t *testing.T) {
+		mockCollection := &mocks.MockCollection{}
+		historyCollection := &mocks.MockCollection{}
+		repo := mocks.TestTaskRepository(nil, nil, mockCollection)
+		repo.History = mocks.TestHistoryRepository(historyCollection)
+		cutoff := time.Now().Add(-time.Hour)
+		trashed := []bson.ObjectID{bson.NewObjectID(), bson.NewObjectID(), bson.NewObjectID()}
+
+		var usedFilter any
+		mockCollection.FindFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+			usedFilter = filter
+			var docs []any
+			for _, id := range trashed {
+				docs = append(docs, bson.M{"_id": id})
+			}
+			return mongo.NewCursorFromDocuments(docs, nil, nil)
+		}
+		// ? The last task is restored between the listing and its purge
+		mockCollection.DeleteOneFunc = func(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
+			if filter.(bson.M)["_id"] == trashed[2] {
+				return &mongo.DeleteResult{DeletedCount: 0}, nil
+			}
+			return &mongo.DeleteResult{DeletedCount: 1}, nil
+		}
+
+		var recorded []*db.TaskHistoryEntry
+		historyCollection.InsertOneFunc = func(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
+			recorded = append(recorded, document.(*db.TaskHistoryEntry))
+			return &mongo.InsertOneResult{InsertedID: bson.NewObjectID()}, nil
+		}
+
+		purged, err := repo.PurgeTrash(ctx, cutoff)
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), purged)
+		assert.Equal(t, bson.M{"deleted_at": bson.M{"$lt": cutoff}}, usedFilter)
+		require.Len(t, recorded, 2)
+		for i, entry := range recorded {
+			assert.Equal(t, trashed[i], entry.TaskID)
+			assert.Equal(t, db.ActionPurged, entry.Action)
+			assert.Equal(t, "system", entry.Actor)
+		}
 	})
 }
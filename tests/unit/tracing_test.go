@@ -0,0 +1,174 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/gsn_manager_service/src/adapters"
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/tracing"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const parentTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newTestTracing() (*tracing.Tracing, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return tracing.NewWithExporter(exporter, tracing.Options{ServiceName: "test"}), exporter
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	newRouter := func(tr *tracing.Tracing) *chi.Mux {
+		router := chi.NewRouter()
+		router.Use(tr.Middleware)
+		router.Get("/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		router.Get("/broken", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+		return router
+	}
+
+	t.Run("Should name the server span after the route pattern", func(t *testing.T) {
+		tr, exporter := newTestTracing()
+
+		serve(newRouter(tr), http.MethodGet, "/tasks/507f1f77bcf86cd799439011", "", nil)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "GET /tasks/{id}", spans[0].Name)
+		assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+		assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	})
+
+	t.Run("Should continue the incoming traceparent and send it back", func(t *testing.T) {
+		tr, exporter := newTestTracing()
+
+		rec := serve(newRouter(tr), http.MethodGet, "/tasks/1", "", map[string]string{"traceparent": parentTraceparent})
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+spans[0].SpanContext.SpanID().String()+"-01", rec.Header().Get("traceparent"))
+	})
+
+	t.Run("Should fail the span of a server error", func(t *testing.T) {
+		tr, exporter := newTestTracing()
+
+		serve(newRouter(tr), http.MethodGet, "/broken", "", nil)
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+}
+
+func TestTracingCommandMonitor(t *testing.T) {
+	command, err := bson.Marshal(bson.D{{Key: "find", Value: "tasks"}, {Key: "filter", Value: bson.D{}}})
+	require.NoError(t, err)
+
+	started := &event.CommandStartedEvent{Command: command, DatabaseName: "table", CommandName: "find", RequestID: 1, ConnectionID: "conn"}
+	finished := event.CommandFinishedEvent{CommandName: "find", DatabaseName: "table", RequestID: 1, ConnectionID: "conn"}
+
+	t.Run("Should record commands as children of the current span", func(t *testing.T) {
+		tr, exporter := newTestTracing()
+		monitor := tr.CommandMonitor()
+
+		router := chi.NewRouter()
+		router.Use(tr.Middleware)
+		router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			monitor.Started(r.Context(), started)
+			monitor.Failed(r.Context(), &event.CommandFailedEvent{CommandFinishedEvent: finished, Failure: errors.New("boom")})
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 2)
+		assert.Equal(t, "find tasks", spans[0].Name)
+		assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind)
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+		assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	})
+
+	t.Run("Should ignore commands sent outside of a trace", func(t *testing.T) {
+		tr, exporter := newTestTracing()
+		monitor := tr.CommandMonitor()
+
+		monitor.Started(context.Background(), started)
+		monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{CommandFinishedEvent: finished})
+
+		assert.Empty(t, exporter.GetSpans())
+	})
+}
+
+func TestTracingTaskStore(t *testing.T) {
+	t.Run("Should record store operations as children of the current span", func(t *testing.T) {
+		tr, exporter := newTestTracing()
+		store := tr.InstrumentTaskStore(db.NewMemoryStore(), "memory")
+
+		router := chi.NewRouter()
+		router.Use(tr.Middleware)
+		router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			timestamp := time.Now()
+			_, err := store.CreateTodo(r.Context(), &db.CreateNewTask{Title: "Traced", Timestamp: &timestamp})
+			require.NoError(t, err)
+			_, err = store.GetTaskById(r.Context(), bson.NewObjectID().Hex())
+			assert.ErrorIs(t, err, db.ErrNotFound)
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 3)
+		assert.Equal(t, "TaskStore.CreateTodo", spans[0].Name)
+		assert.Equal(t, spans[2].SpanContext.SpanID(), spans[0].Parent.SpanID())
+		assert.Contains(t, spans[0].Attributes, attribute.String("storage.backend", "memory"))
+		assert.Equal(t, "TaskStore.GetTaskById", spans[1].Name)
+		assert.Equal(t, codes.Unset, spans[1].Status.Code)
+		assert.Contains(t, spans[1].Attributes, attribute.String("error.type", "not_found"))
+	})
+
+	t.Run("Should ignore operations run outside of a trace", func(t *testing.T) {
+		tr, exporter := newTestTracing()
+		store := tr.InstrumentTaskStore(db.NewMemoryStore(), "memory")
+
+		_, err := store.PurgeTrash(context.Background(), time.Now())
+		require.NoError(t, err)
+
+		assert.Empty(t, exporter.GetSpans())
+	})
+}
+
+func TestTraceHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Hook(adapters.TraceHook{})
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9},
+		SpanID:  trace.SpanID{0x00, 0xf0},
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanContext)
+
+	logger.Info().Ctx(ctx).Msg("traced")
+	assert.Contains(t, buf.String(), `"trace_id":"`+spanContext.TraceID().String()+`"`)
+	assert.Contains(t, buf.String(), `"span_id":"`+spanContext.SpanID().String()+`"`)
+
+	buf.Reset()
+	logger.Info().Ctx(context.Background()).Msg("untraced")
+	assert.NotContains(t, buf.String(), "trace_id")
+}
@@ -0,0 +1,62 @@
+package unit
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gsn_manager_service/src/adapters/db"
+	"github.com/gsn_manager_service/src/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeTaskPayload(body string) (*db.CreateNewTask, error) {
+	var payload db.CreateNewTask
+	r := httptest.NewRequest("POST", "/tasks/new", strings.NewReader(body))
+
+	err := utils.DecodeAndValidate(httptest.NewRecorder(), r, &payload)
+	return &payload, err
+}
+
+func TestDecodeAndValidate(t *testing.T) {
+	t.Run("Should decode and accept a valid payload", func(t *testing.T) {
+		payload, err := decodeTaskPayload(`{"title": "Buy milk", "timestamp": "2025-01-01T10:00:00Z"}`)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "Buy milk", payload.Title)
+		assert.NotNil(t, payload.Timestamp)
+	})
+
+	t.Run("Should report every invalid field by its JSON name", func(t *testing.T) {
+		_, err := decodeTaskPayload(`{"title": "ab"}`)
+
+		var validationErr *utils.ValidationError
+		assert.True(t, errors.As(err, &validationErr))
+		assert.ElementsMatch(t, []utils.FieldError{
+			{Field: "title", Rule: "min", Param: "3", Message: "title must be at least 3 characters long"},
+			{Field: "timestamp", Rule: "required", Message: "timestamp is required"},
+		}, validationErr.Errors)
+	})
+
+	t.Run("Should reject malformed bodies with a client friendly message", func(t *testing.T) {
+		cases := map[string]string{
+			``:                              "must not be empty",
+			`{"title": "Buy milk"`:          "malformed JSON",
+			`{"title": "Buy milk", "x": 1}`: `unknown field "x"`,
+			`{"title": 123}`:                `field "title" must not be a JSON number`,
+			`{"title": "Buy milk"} {}`:      "single JSON value",
+			`{"timestamp": "yesterday"}`:    "RFC 3339",
+			`[]`:                            "must be a JSON object",
+		}
+
+		for body, expected := range cases {
+			_, err := decodeTaskPayload(body)
+
+			var decodeErr *utils.DecodeError
+			assert.True(t, errors.As(err, &decodeErr), body)
+			assert.Contains(t, err.Error(), expected, body)
+			assert.NotContains(t, err.Error(), "CreateNewTask", body)
+		}
+	})
+}